@@ -0,0 +1,162 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+)
+
+const (
+	// The CFS scheduling period that CPU limits are enforced over, which is Docker's default
+	cpuQuotaPeriodMicroseconds = 100000
+)
+
+/*
+Optional settings for how the Docker engine runs a container, where the zero value of each field leaves the container as
+	Docker would run it by default
+ */
+type ContainerHostOptions struct {
+	// Limits on the container's CPU and memory, which can be changed while the container runs
+	ResourceLimits ContainerResourceLimits
+
+	// The maximum number of processes and threads that can be running in the container at once (0 for unlimited)
+	PidsLimit uint64
+
+	// Limits on the resources of each of the container's processes (as set by ulimit)
+	Ulimits []Ulimit
+
+	// Limits on the rate of the container's I/O to host block devices
+	IoThrottles []IoThrottle
+
+	// Mapping of (mountpoint on container) -> size in bytes of a tmpfs to mount there (0 for the Docker default of half
+	//  the host's memory)
+	TmpfsMounts map[string]uint64
+
+	// Whether to publish the ports the container listens on to ephemeral ports on the Docker host (see
+	//  DockerManager.GetPublishedPorts); other ports the container's image exposes aren't published
+	PublishPorts bool
+}
+
+/*
+Limits on a container's CPU and memory, where 0 leaves that resource unlimited (or, when updating a running container's
+	limits, leaves that limit unchanged)
+ */
+type ContainerResourceLimits struct {
+	// How many CPUs' worth of time the container can use (e.g. 0.5 for half a CPU), enforced as a CFS quota
+	CpuLimit float64
+
+	// The container's CPU weight relative to other containers when CPUs are contended (Docker's default is 1024)
+	CpuShares uint64
+
+	// The maximum memory the container can use before being OOM-killed
+	MemoryBytes uint64
+
+	// The maximum memory plus swap the container can use (-1 for unlimited swap, 0 for Docker's default of twice MemoryBytes)
+	MemorySwapBytes int64
+}
+
+/*
+A limit on a resource of each of a container's processes (see `man setrlimit`)
+ */
+type Ulimit struct {
+	// The name of the resource, as Docker's --ulimit flag takes it (e.g. "nofile" or "nproc")
+	Name string
+
+	Soft int64
+
+	Hard int64
+}
+
+/*
+Limits on the rate of a container's I/O to a host block device, where 0 leaves that rate unlimited
+ */
+type IoThrottle struct {
+	// The path of the block device on the host (e.g. /dev/sda), which must not be a partition
+	DevicePath string
+
+	ReadBytesPerSecond uint64
+
+	WriteBytesPerSecond uint64
+
+	ReadOpsPerSecond uint64
+
+	WriteOpsPerSecond uint64
+}
+
+/*
+Applies the options to the given host config of a container that's about to be created
+
+Args:
+	hostConfig: The host config to apply the options to
+	usedPorts: A "set" of the ports that the container will listen on
+ */
+func (options ContainerHostOptions) apply(hostConfig *container.HostConfig, usedPorts map[nat.Port]bool) {
+	options.ResourceLimits.apply(&hostConfig.Resources)
+	if options.PublishPorts && len(usedPorts) > 0 {
+		hostConfig.PortBindings = nat.PortMap{}
+		for port, _ := range usedPorts {
+			// An empty host port makes Docker pick an ephemeral one
+			hostConfig.PortBindings[port] = []nat.PortBinding{{HostIP: "", HostPort: ""}}
+		}
+	}
+	if options.PidsLimit > 0 {
+		pidsLimit := int64(options.PidsLimit)
+		hostConfig.PidsLimit = &pidsLimit
+	}
+	for _, ulimit := range options.Ulimits {
+		hostConfig.Ulimits = append(hostConfig.Ulimits, &units.Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+
+	for _, throttle := range options.IoThrottles {
+		if throttle.ReadBytesPerSecond > 0 {
+			hostConfig.BlkioDeviceReadBps = append(
+				hostConfig.BlkioDeviceReadBps,
+				&blkiodev.ThrottleDevice{Path: throttle.DevicePath, Rate: throttle.ReadBytesPerSecond})
+		}
+		if throttle.WriteBytesPerSecond > 0 {
+			hostConfig.BlkioDeviceWriteBps = append(
+				hostConfig.BlkioDeviceWriteBps,
+				&blkiodev.ThrottleDevice{Path: throttle.DevicePath, Rate: throttle.WriteBytesPerSecond})
+		}
+		if throttle.ReadOpsPerSecond > 0 {
+			hostConfig.BlkioDeviceReadIOps = append(
+				hostConfig.BlkioDeviceReadIOps,
+				&blkiodev.ThrottleDevice{Path: throttle.DevicePath, Rate: throttle.ReadOpsPerSecond})
+		}
+		if throttle.WriteOpsPerSecond > 0 {
+			hostConfig.BlkioDeviceWriteIOps = append(
+				hostConfig.BlkioDeviceWriteIOps,
+				&blkiodev.ThrottleDevice{Path: throttle.DevicePath, Rate: throttle.WriteOpsPerSecond})
+		}
+	}
+
+	if len(options.TmpfsMounts) > 0 {
+		hostConfig.Tmpfs = map[string]string{}
+		for mountpoint, sizeBytes := range options.TmpfsMounts {
+			mountOptions := ""
+			if sizeBytes > 0 {
+				mountOptions = fmt.Sprintf("size=%v", sizeBytes)
+			}
+			hostConfig.Tmpfs[mountpoint] = mountOptions
+		}
+	}
+}
+
+/*
+Applies the limits to the given resources of a container
+ */
+func (limits ContainerResourceLimits) apply(resources *container.Resources) {
+	if limits.CpuLimit > 0 {
+		resources.CPUPeriod = cpuQuotaPeriodMicroseconds
+		resources.CPUQuota = int64(limits.CpuLimit * cpuQuotaPeriodMicroseconds)
+	}
+	resources.CPUShares = int64(limits.CpuShares)
+	resources.Memory = int64(limits.MemoryBytes)
+	resources.MemorySwap = limits.MemorySwapBytes
+}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/docker/docker/api/types"
@@ -9,6 +10,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
@@ -34,6 +36,9 @@ const (
 	// We use a bridge network because, as of 2020-08-01, we're only running locally; however, this may need to change
 	//  at some point in the future
 	DOCKER_NETWORK_DRIVER = "bridge"
+
+	// The Linux capability needed to modify a container's networking (e.g. its iptables rules)
+	netAdminCapability = "NET_ADMIN"
 )
 
 /*
@@ -169,6 +174,7 @@ Args:
 	envVariables: A key-value mapping of Docker environment variables which will be passed to the container during startup
 	bindMounts: Mapping of (host file) -> (mountpoint on container) that will be mounted on container startup
 	volumeMounts: Mapping of (volume name) -> (mountpoint on container) to mount during container launch
+	hostOptions: Optional settings for how the Docker engine runs the container (e.g. I/O limits)
 
 Returns:
 	The Docker container ID of the newly-created container
@@ -182,7 +188,8 @@ func (manager DockerManager) CreateAndStartContainer(
 			startCmdArgs []string,
 			envVariables map[string]string,
 			bindMounts map[string]string,
-			volumeMounts map[string]string) (containerId string, err error) {
+			volumeMounts map[string]string,
+			hostOptions ContainerHostOptions) (containerId string, err error) {
 
 	imageExistsLocally, err := manager.isImageAvailableLocally(dockerImage)
 	if err != nil {
@@ -208,7 +215,7 @@ func (manager DockerManager) CreateAndStartContainer(
 	if err != nil {
 		return "", stacktrace.Propagate(err, "Failed to configure container from service.")
 	}
-	containerHostConfigPtr, err := manager.getContainerHostConfig(bindMounts, volumeMounts)
+	containerHostConfigPtr, err := manager.getContainerHostConfig(usedPorts, bindMounts, volumeMounts, hostOptions)
 	if err != nil {
 		return "", stacktrace.Propagate(err, "Failed to configure host to container mappings from service.")
 	}
@@ -244,6 +251,66 @@ func (manager DockerManager) StopContainer(context context.Context, containerId
 	return nil
 }
 
+/*
+Freezes all the processes in the container with the given ID (as with `docker pause`), leaving its network and state intact
+
+Args:
+	context: The context that the pausing runs in (useful for cancellation)
+	containerId: ID of the Docker container to pause
+ */
+func (manager DockerManager) PauseContainer(context context.Context, containerId string) error {
+	if err := manager.dockerClient.ContainerPause(context, containerId); err != nil {
+		return stacktrace.Propagate(err, "An error occurred pausing container with ID '%v'", containerId)
+	}
+	return nil
+}
+
+/*
+Resumes the processes in the container with the given ID after they were frozen with PauseContainer
+
+Args:
+	context: The context that the unpausing runs in (useful for cancellation)
+	containerId: ID of the Docker container to unpause
+ */
+func (manager DockerManager) UnpauseContainer(context context.Context, containerId string) error {
+	if err := manager.dockerClient.ContainerUnpause(context, containerId); err != nil {
+		return stacktrace.Propagate(err, "An error occurred unpausing container with ID '%v'", containerId)
+	}
+	return nil
+}
+
+/*
+Sends the given signal to the main process of the container with the given ID (as with `docker kill`). The container
+	isn't removed, so it can be started again with RestartContainer.
+
+Args:
+	context: The context that the killing runs in (useful for cancellation)
+	containerId: ID of the Docker container to send the signal to
+	signal: The signal to send (e.g. "SIGKILL", "SIGTERM", "SIGHUP")
+ */
+func (manager DockerManager) KillContainer(context context.Context, containerId string, signal string) error {
+	if err := manager.dockerClient.ContainerKill(context, containerId, signal); err != nil {
+		return stacktrace.Propagate(err, "An error occurred sending signal %v to container with ID '%v'", signal, containerId)
+	}
+	return nil
+}
+
+/*
+Restarts the container with the given ID (as with `docker restart`), stopping it first if it's running. The container
+	keeps its ID, static IP, and mounts.
+
+Args:
+	context: The context that the restarting runs in (useful for cancellation)
+	containerId: ID of the Docker container to restart
+	stopTimeout: How long to wait for a running container to stop before forcefully terminating it
+ */
+func (manager DockerManager) RestartContainer(context context.Context, containerId string, stopTimeout time.Duration) error {
+	if err := manager.dockerClient.ContainerRestart(context, containerId, &stopTimeout); err != nil {
+		return stacktrace.Propagate(err, "An error occurred restarting container with ID '%v'", containerId)
+	}
+	return nil
+}
+
 /*
 Blocks until the given container exits or the context is cancelled.
 
@@ -270,6 +337,186 @@ func (manager DockerManager) WaitForExit(context context.Context, containerId st
 	return
 }
 
+/*
+Runs a command in the network namespace of the given container, using a short-lived sidecar container that shares the
+	container's network stack and has the NET_ADMIN capability. This lets us manipulate a container's networking (e.g.
+	with iptables or tc) without requiring those tools or any extra privileges in the container's own image.
+
+Args:
+	context: The context that the command runs in (useful for cancellation)
+	containerId: ID of the Docker container whose network namespace the command should run in
+	sidecarImage: The Docker image to run the command with, which must contain the tools the command uses
+	cmd: The command to run in the sidecar
+
+Returns:
+	An error if the sidecar couldn't be run or the command exited with a non-zero exit code (in which case the error
+		contains the command's output)
+ */
+func (manager DockerManager) RunInNetworkNamespace(
+			context context.Context,
+			containerId string,
+			sidecarImage string,
+			cmd []string) error {
+	imageExistsLocally, err := manager.isImageAvailableLocally(sidecarImage)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred checking for local availability of Docker image %v", sidecarImage)
+	}
+	if !imageExistsLocally {
+		if err := manager.pullImage(context, sidecarImage); err != nil {
+			return stacktrace.Propagate(err, "Failed to pull network sidecar image %v", sidecarImage)
+		}
+	}
+
+	containerConfig := &container.Config{
+		Image: sidecarImage,
+		Cmd: cmd,
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode("container:" + containerId),
+		CapAdd: []string{netAdminCapability},
+	}
+	resp, err := manager.dockerClient.ContainerCreate(context, containerConfig, hostConfig, nil, "")
+	if err != nil {
+		return stacktrace.Propagate(err, "Could not create network sidecar for container %v", containerId)
+	}
+	sidecarId := resp.ID
+	defer func() {
+		if err := manager.dockerClient.ContainerRemove(context, sidecarId, types.ContainerRemoveOptions{Force: true}); err != nil {
+			manager.log.Warnf("An error occurred removing network sidecar container %v: %v", sidecarId, err)
+		}
+	}()
+
+	if err := manager.dockerClient.ContainerStart(context, sidecarId, types.ContainerStartOptions{}); err != nil {
+		return stacktrace.Propagate(err, "Could not start network sidecar for container %v", containerId)
+	}
+	exitCode, err := manager.WaitForExit(context, sidecarId)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred waiting for the network sidecar for container %v to exit", containerId)
+	}
+	if exitCode != 0 {
+		output, err := manager.getContainerOutput(context, sidecarId)
+		if err != nil {
+			output = fmt.Sprintf("<output unavailable: %v>", err)
+		}
+		return stacktrace.NewError(
+			"Network sidecar command %v for container %v exited with code %v and output:\n%v",
+			cmd,
+			containerId,
+			exitCode,
+			output)
+	}
+	return nil
+}
+
+
+/*
+Changes the CPU and memory limits of the given running container, leaving the limits that are 0 in the given limits unchanged
+
+Args:
+	context: The context that the update runs in (useful for cancellation)
+	containerId: ID of the Docker container whose limits to change
+	limits: The new limits
+ */
+func (manager DockerManager) UpdateContainerResources(context context.Context, containerId string, limits ContainerResourceLimits) error {
+	updateConfig := container.UpdateConfig{}
+	limits.apply(&updateConfig.Resources)
+	resp, err := manager.dockerClient.ContainerUpdate(context, containerId, updateConfig)
+	if err != nil {
+		return stacktrace.Propagate(err, "Could not update the resource limits of container %v", containerId)
+	}
+	for _, warning := range resp.Warnings {
+		manager.log.Warnf("Updating the resource limits of container %v: %v", containerId, warning)
+	}
+	return nil
+}
+
+/*
+Gets the addresses on the Docker host that the given running container's ports are published to, which is empty unless
+	the container was created with ContainerHostOptions.PublishPorts
+
+Args:
+	context: The context that the lookup runs in (useful for cancellation)
+	containerId: ID of the Docker container whose published ports to get
+
+Returns:
+	Mapping of port on the container -> address on the Docker host (e.g. "0.0.0.0:32768") that it's published to,
+		preferring IPv4 addresses when a port is published to several
+ */
+func (manager DockerManager) GetPublishedPorts(context context.Context, containerId string) (map[nat.Port]string, error) {
+	containerJson, err := manager.dockerClient.ContainerInspect(context, containerId)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Could not inspect container %v", containerId)
+	}
+	result := map[nat.Port]string{}
+	if containerJson.NetworkSettings == nil {
+		return result, nil
+	}
+	for port, bindings := range containerJson.NetworkSettings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+		binding := bindings[0]
+		for _, candidate := range bindings {
+			if net.ParseIP(candidate.HostIP).To4() != nil {
+				binding = candidate
+				break
+			}
+		}
+		result[port] = net.JoinHostPort(binding.HostIP, binding.HostPort)
+	}
+	return result, nil
+}
+
+/*
+Runs a command inside the given running container, as Docker exec does.
+
+Args:
+	context: The context that the command runs in (useful for cancellation)
+	containerId: ID of the running Docker container to run the command in
+	cmd: The command to run, whose executable must exist in the container's image
+
+Returns:
+	The command's combined STDOUT and STDERR, with an error if the command couldn't be run or exited with a non-zero
+		exit code (in which case the error contains the command's output)
+ */
+func (manager DockerManager) RunInContainer(context context.Context, containerId string, cmd []string) (string, error) {
+	execConfig := types.ExecConfig{
+		Cmd: cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	execResp, err := manager.dockerClient.ContainerExecCreate(context, containerId, execConfig)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Could not create exec of command %v in container %v", cmd, containerId)
+	}
+	execId := execResp.ID
+
+	attachResp, err := manager.dockerClient.ContainerExecAttach(context, execId, types.ExecStartCheck{})
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Could not start exec of command %v in container %v", cmd, containerId)
+	}
+	defer attachResp.Close()
+	// The exec has no TTY, so Docker multiplexes STDOUT and STDERR into a single stream that we need to split apart
+	outputBuffer := &bytes.Buffer{}
+	if _, err := stdcopy.StdCopy(outputBuffer, outputBuffer, attachResp.Reader); err != nil {
+		return "", stacktrace.Propagate(err, "An error occurred reading the output of command %v in container %v", cmd, containerId)
+	}
+	output := outputBuffer.String()
+
+	inspectResp, err := manager.dockerClient.ContainerExecInspect(context, execId)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "An error occurred getting the exit code of command %v in container %v", cmd, containerId)
+	}
+	if inspectResp.ExitCode != 0 {
+		return output, stacktrace.NewError(
+			"Command %v in container %v exited with code %v and output:\n%v",
+			cmd,
+			containerId,
+			inspectResp.ExitCode,
+			output)
+	}
+	return output, nil
+}
 
 
 // =================================================================================================================
@@ -314,6 +561,10 @@ func (manager DockerManager) connectToNetwork(networkId string, containerId stri
 		containerId,
 		&network.EndpointSettings{
 			IPAddress: staticIpAddr.String(),
+			// Without an IPAM config, Docker would give the container a different IP if it's restarted
+			IPAMConfig: &network.EndpointIPAMConfig{
+				IPv4Address: staticIpAddr.String(),
+			},
 		})
 	if err != nil {
 		return stacktrace.Propagate(err, "Failed to connect container %s to network with ID %s.", containerId, networkId)
@@ -321,6 +572,24 @@ func (manager DockerManager) connectToNetwork(networkId string, containerId stri
 	return nil
 }
 
+// Gets everything the container has written to STDOUT and STDERR
+func (manager DockerManager) getContainerOutput(context context.Context, containerId string) (string, error) {
+	logsReader, err := manager.dockerClient.ContainerLogs(context, containerId, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", stacktrace.Propagate(err, "An error occurred getting the logs of container %v", containerId)
+	}
+	defer logsReader.Close()
+	// The container has no TTY, so Docker multiplexes STDOUT and STDERR into a single stream that we need to split apart
+	output := &bytes.Buffer{}
+	if _, err := stdcopy.StdCopy(output, output, logsReader); err != nil {
+		return "", stacktrace.Propagate(err, "An error occurred reading the logs of container %v", containerId)
+	}
+	return output.String(), nil
+}
+
 func (manager DockerManager) pullImage(context context.Context, imageName string) (err error) {
 	manager.log.Infof("Pulling image %s...", imageName)
 	out, err := manager.dockerClient.ImagePull(context, imageName, types.ImagePullOptions{})
@@ -343,8 +612,13 @@ Args:
 	volumeMounts: Mapping of (volume name) -> (mountpoint on container) that will be mounted at container startup (used
 		when sharing data between containers). This is distinct from a bind mount because the host filesystem can't easily
 		read from a Docker volume - you need to be inside a Docker container to do so.
+	hostOptions: Optional settings for how the Docker engine runs the container
  */
-func (manager *DockerManager) getContainerHostConfig(bindMounts map[string]string, volumeMounts map[string]string) (hostConfig *container.HostConfig, err error) {
+func (manager *DockerManager) getContainerHostConfig(
+			usedPorts map[nat.Port]bool,
+			bindMounts map[string]string,
+			volumeMounts map[string]string,
+			hostOptions ContainerHostOptions) (hostConfig *container.HostConfig, err error) {
 	bindsList := make([]string, 0, len(bindMounts))
 	for hostFilepath, containerFilepath := range bindMounts {
 		bindsList = append(bindsList, hostFilepath + ":" + containerFilepath)
@@ -361,6 +635,7 @@ func (manager *DockerManager) getContainerHostConfig(bindMounts map[string]strin
 		Binds: bindsList,
 		NetworkMode: container.NetworkMode("default"),
 	}
+	hostOptions.apply(containerHostConfigPtr, usedPorts)
 	return containerHostConfigPtr, nil
 }
 
@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"github.com/docker/go-connections/nat"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	"net"
+	"testing"
+)
+
+func TestConnectToNetworkPinsStaticIp(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	manager, err := NewDockerManager(logrus.StandardLogger(), engine.NewClient())
+	assert.NilError(t, err)
+
+	assert.NilError(t, manager.connectToNetwork("network-id", "container-id", net.ParseIP("172.23.0.5")))
+	networkConnections := engine.GetNetworkConnections()
+	assert.Equal(t, len(networkConnections), 1)
+	assert.Equal(t, networkConnections[0].NetworkId, "network-id")
+	connectRequest := networkConnections[0].Config
+	assert.Equal(t, connectRequest.Container, "container-id")
+	assert.Equal(t, connectRequest.EndpointConfig.IPAddress, "172.23.0.5")
+	// Docker only keeps a container's IP across restarts if the IP is in the endpoint's IPAM config
+	assert.Assert(t, connectRequest.EndpointConfig.IPAMConfig != nil)
+	assert.Equal(t, connectRequest.EndpointConfig.IPAMConfig.IPv4Address, "172.23.0.5")
+}
+
+func TestPublishPortsBindsOnlyUsedPorts(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	manager, err := NewDockerManager(logrus.StandardLogger(), engine.NewClient())
+	assert.NilError(t, err)
+	usedPorts := map[nat.Port]bool{
+		"8080/tcp": true,
+		"9000/udp": true,
+	}
+
+	config, err := manager.getContainerCfg("test-image", usedPorts, []string{}, map[string]string{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config.ExposedPorts, nat.PortSet{"8080/tcp": struct{}{}, "9000/udp": struct{}{}})
+
+	// Each used port is bound to an ephemeral host port, and no other port the image exposes is published
+	hostConfig, err := manager.getContainerHostConfig(usedPorts, map[string]string{}, map[string]string{}, ContainerHostOptions{PublishPorts: true})
+	assert.NilError(t, err)
+	assert.Assert(t, !hostConfig.PublishAllPorts)
+	assert.DeepEqual(t, hostConfig.PortBindings, nat.PortMap{
+		"8080/tcp": []nat.PortBinding{{HostIP: "", HostPort: ""}},
+		"9000/udp": []nat.PortBinding{{HostIP: "", HostPort: ""}},
+	})
+
+	hostConfig, err = manager.getContainerHostConfig(usedPorts, map[string]string{}, map[string]string{}, ContainerHostOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, !hostConfig.PublishAllPorts)
+	assert.Equal(t, len(hostConfig.PortBindings), 0)
+}
@@ -0,0 +1,194 @@
+package dockertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// The Docker API version that clients of the fake engine talk to it with
+	fakeDockerApiVersion = "1.40"
+
+	networkModeContainerPrefix = "container:"
+)
+
+var (
+	// Strips the API version off the paths of requests to the Docker engine, e.g. "/v1.40/containers/create"
+	apiVersionRegex = regexp.MustCompile(`^/v[0-9.]+`)
+
+	// Matches the path of a request connecting a container to a network, capturing the network ID
+	networkConnectPathRegex = regexp.MustCompile(`^/networks/([^/]+)/connect$`)
+)
+
+/*
+A container that was created on the fake Docker engine
+ */
+type CreatedContainer struct {
+	Id string
+
+	Config container.Config
+
+	HostConfig container.HostConfig
+}
+
+/*
+Gets the ID of the container whose network namespace this container joins (e.g. a sidecar that manipulates another
+	container's networking), or empty if it doesn't join another container's network namespace
+ */
+func (createdContainer CreatedContainer) GetNetworkNamespaceContainerId() string {
+	networkMode := string(createdContainer.HostConfig.NetworkMode)
+	if !strings.HasPrefix(networkMode, networkModeContainerPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(networkMode, networkModeContainerPrefix)
+}
+
+/*
+A connection of a container to a network that was made on the fake Docker engine
+ */
+type NetworkConnection struct {
+	NetworkId string
+
+	Config types.NetworkConnect
+}
+
+/*
+A fake Docker engine, served over HTTP, which accepts every request and records the requests it receives, the containers
+	created, and the network connections made, so that tests can check what was asked of Docker without a real engine.
+	Every image is available locally, every network exists, and every container exits with a status code of 0.
+ */
+type FakeDockerEngine struct {
+	t *testing.T
+
+	server *httptest.Server
+
+	mutex *sync.Mutex
+
+	// The requests received, as e.g. "POST /containers/container-1/restart"
+	requests []string
+
+	// The containers created, in order
+	createdContainers []CreatedContainer
+
+	// The connections of containers to networks, in order
+	networkConnections []NetworkConnection
+}
+
+/*
+Starts a new fake Docker engine, which must be closed when the test is done with it
+ */
+func NewFakeDockerEngine(t *testing.T) *FakeDockerEngine {
+	engine := &FakeDockerEngine{
+		t:                  t,
+		mutex:              &sync.Mutex{},
+		requests:           []string{},
+		createdContainers:  []CreatedContainer{},
+		networkConnections: []NetworkConnection{},
+	}
+	engine.server = httptest.NewServer(http.HandlerFunc(engine.handleRequest))
+	return engine
+}
+
+func (engine *FakeDockerEngine) Close() {
+	engine.server.Close()
+}
+
+/*
+Creates a Docker client that talks to the fake engine
+ */
+func (engine *FakeDockerEngine) NewClient() *client.Client {
+	dockerClient, err := client.NewClientWithOpts(
+		client.WithHost("tcp://" + engine.server.Listener.Addr().String()),
+		client.WithHTTPClient(engine.server.Client()),
+		client.WithVersion(fakeDockerApiVersion))
+	if err != nil {
+		engine.t.Fatalf("An error occurred creating a Docker client for the fake Docker engine: %v", err)
+	}
+	return dockerClient
+}
+
+/*
+Gets the requests received so far, as e.g. "POST /containers/container-1/restart"
+ */
+func (engine *FakeDockerEngine) GetRequests() []string {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return append([]string{}, engine.requests...)
+}
+
+/*
+Gets the containers created so far, in order
+ */
+func (engine *FakeDockerEngine) GetCreatedContainers() []CreatedContainer {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return append([]CreatedContainer{}, engine.createdContainers...)
+}
+
+/*
+Gets the connections of containers to networks made so far, in order
+ */
+func (engine *FakeDockerEngine) GetNetworkConnections() []NetworkConnection {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return append([]NetworkConnection{}, engine.networkConnections...)
+}
+
+func (engine *FakeDockerEngine) handleRequest(writer http.ResponseWriter, request *http.Request) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	path := apiVersionRegex.ReplaceAllString(request.URL.Path, "")
+	engine.requests = append(engine.requests, fmt.Sprintf("%v %v", request.Method, path))
+	writer.Header().Set("Content-Type", "application/json")
+	switch {
+	case request.Method == http.MethodGet && (path == "/images/json" || path == "/networks"):
+		// Every image is available locally and every network exists
+		writer.Write([]byte(`[{"Id": "fake"}]`))
+	case request.Method == http.MethodPost && path == "/containers/create":
+		createConfig := struct {
+			container.Config
+			HostConfig *container.HostConfig
+		}{}
+		if err := json.NewDecoder(request.Body).Decode(&createConfig); err != nil {
+			engine.t.Errorf("The fake Docker engine couldn't decode a container create request: %v", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		createdContainer := CreatedContainer{
+			Id:     fmt.Sprintf("container-%v", len(engine.createdContainers) + 1),
+			Config: createConfig.Config,
+		}
+		if createConfig.HostConfig != nil {
+			createdContainer.HostConfig = *createConfig.HostConfig
+		}
+		engine.createdContainers = append(engine.createdContainers, createdContainer)
+		writer.WriteHeader(http.StatusCreated)
+		writer.Write([]byte(fmt.Sprintf(`{"Id": "%v"}`, createdContainer.Id)))
+	case request.Method == http.MethodPost && strings.HasSuffix(path, "/wait"):
+		writer.Write([]byte(`{"StatusCode": 0}`))
+	case request.Method == http.MethodPost && networkConnectPathRegex.MatchString(path):
+		connection := NetworkConnection{NetworkId: networkConnectPathRegex.FindStringSubmatch(path)[1]}
+		if err := json.NewDecoder(request.Body).Decode(&connection.Config); err != nil {
+			engine.t.Errorf("The fake Docker engine couldn't decode a network connect request: %v", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		engine.networkConnections = append(engine.networkConnections, connection)
+		writer.WriteHeader(http.StatusOK)
+	case request.Method == http.MethodPost && strings.HasPrefix(path, "/networks/"):
+		writer.WriteHeader(http.StatusOK)
+	default:
+		// Starting, restarting, stopping, and removing containers have no response body
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,195 @@
+package networks
+
+import (
+	"fmt"
+	"github.com/docker/distribution/uuid"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// The directory, in the test volume, holding the libfaketime libraries and the files services' faked times are read from
+	clockSkewDirname = "clock-skew"
+
+	// How long, in seconds, libfaketime caches the faked time before re-reading it, which bounds how long a change to a
+	//  service's clock skew takes to be seen by the service
+	fakeTimeCacheDurationSeconds = 1
+
+	// The faked time of a service whose clock isn't skewed
+	noSkewFakeTimeSpec = "+0"
+)
+
+/*
+A skew of a service's clock relative to the real time
+ */
+type ClockSkew struct {
+	// How far ahead (positive) or behind (negative) the real time the service's clock is
+	Offset time.Duration
+
+	// How many times faster than real time the service's clock runs, as measured by libfaketime from the start of each of
+	//  the service's processes (0 for real speed)
+	Rate float64
+}
+
+func (skew ClockSkew) validate() error {
+	if math.IsNaN(skew.Rate) || math.IsInf(skew.Rate, 0) || skew.Rate < 0 {
+		return stacktrace.NewError("Clock rate must be a non-negative number, but was %v", skew.Rate)
+	}
+	return nil
+}
+
+func (skew ClockSkew) isZero() bool {
+	return skew.Offset == 0 && (skew.Rate == 0 || skew.Rate == 1)
+}
+
+/*
+Skews the clock of the given service, e.g. SetClockSkew("node3", ClockSkew{Offset: 30 * time.Second}) makes node3's clock
+	run 30 seconds ahead. The skew replaces any skew previously set for the service, and takes up to a second to be seen
+	by the service's processes.
+
+The service's configuration must have been added with ServiceConfigurationOptions.FakeTimeLibraryFilepath set, and the
+	skew only affects processes that are dynamically linked against libc (e.g. not statically-linked Go binaries).
+
+Args:
+	serviceId: The ID of the service whose clock to skew
+	skew: The skew to apply to the service's clock
+ */
+func (network *ServiceNetwork) SetClockSkew(serviceId ServiceID, skew ClockSkew) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if _, found := network.serviceNodes[serviceId]; !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	fakeTimeFilepath, found := network.fakeTimeFilepaths[serviceId]
+	if !found {
+		return stacktrace.NewError(
+			"Can't skew the clock of service %v because its configuration doesn't set a libfaketime library",
+			serviceId)
+	}
+	if err := skew.validate(); err != nil {
+		return stacktrace.Propagate(err, "Invalid clock skew for service %v", serviceId)
+	}
+
+	fakeTimeSpec := getFakeTimeSpec(skew)
+	logrus.Debugf("Setting the faked time of service %v to '%v'", serviceId, fakeTimeSpec)
+	if err := writeFakeTimeFile(fakeTimeFilepath, fakeTimeSpec); err != nil {
+		return stacktrace.Propagate(err, "An error occurred skewing the clock of service %v", serviceId)
+	}
+	if skew.isZero() {
+		delete(network.clockSkews, serviceId)
+	} else {
+		network.clockSkews[serviceId] = skew
+	}
+	return nil
+}
+
+/*
+Sets the clock of the given service back to the real time
+ */
+func (network *ServiceNetwork) ResetClockSkew(serviceId ServiceID) error {
+	if err := network.SetClockSkew(serviceId, ClockSkew{}); err != nil {
+		return stacktrace.Propagate(err, "An error occurred resetting the clock of service %v", serviceId)
+	}
+	return nil
+}
+
+/*
+Gets the skew currently applied to the clock of the given service, which is the zero value if it's not skewed
+ */
+func (network *ServiceNetwork) GetClockSkew(serviceId ServiceID) ClockSkew {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.clockSkews[serviceId]
+}
+
+/*
+Creates the files that libfaketime needs to skew the clock of a new service launched with the given configuration.
+
+Returns:
+	map[string]string: The environment variables to launch the service's container with
+	string: The filepath, on the controller, of the file that the service's faked time is read from
+ */
+func (network *ServiceNetwork) createFakeTimeFiles(config serviceConfig) (map[string]string, string, error) {
+	controllerClockSkewDirpath := filepath.Join(network.testVolumeControllerDirpath, clockSkewDirname)
+	if err := os.MkdirAll(controllerClockSkewDirpath, os.ModePerm); err != nil {
+		return nil, "", stacktrace.Propagate(err, "An error occurred creating the clock skew directory at '%v'", controllerClockSkewDirpath)
+	}
+
+	libraryFilepath := config.options.FakeTimeLibraryFilepath
+	libraryFilename, found := network.fakeTimeLibraryFilenames[libraryFilepath]
+	if !found {
+		libraryFilename = fmt.Sprintf("libfaketime-%v.so", uuid.Generate().String())
+		if err := copyFile(libraryFilepath, filepath.Join(controllerClockSkewDirpath, libraryFilename)); err != nil {
+			return nil, "", stacktrace.Propagate(err, "An error occurred copying libfaketime library '%v' to the test volume", libraryFilepath)
+		}
+		network.fakeTimeLibraryFilenames[libraryFilepath] = libraryFilename
+	}
+
+	fakeTimeFilename := fmt.Sprintf("faketime-%v", uuid.Generate().String())
+	controllerFakeTimeFilepath := filepath.Join(controllerClockSkewDirpath, fakeTimeFilename)
+	if err := writeFakeTimeFile(controllerFakeTimeFilepath, noSkewFakeTimeSpec); err != nil {
+		return nil, "", stacktrace.Propagate(err, "An error occurred creating the faked time file")
+	}
+
+	mountClockSkewDirpath := filepath.Join(config.initializerCore.GetTestVolumeMountpoint(), clockSkewDirname)
+	envVariables := map[string]string{
+		"LD_PRELOAD":              filepath.Join(mountClockSkewDirpath, libraryFilename),
+		"FAKETIME_TIMESTAMP_FILE": filepath.Join(mountClockSkewDirpath, fakeTimeFilename),
+		"FAKETIME_CACHE_DURATION": strconv.Itoa(fakeTimeCacheDurationSeconds),
+	}
+	return envVariables, controllerFakeTimeFilepath, nil
+}
+
+/*
+Gets the libfaketime specification of the faked time for the given skew, e.g. "+30" or "-1.5 x2"
+ */
+func getFakeTimeSpec(skew ClockSkew) string {
+	result := strconv.FormatFloat(skew.Offset.Seconds(), 'f', -1, 64)
+	if skew.Offset >= 0 {
+		result = "+" + result
+	}
+	if skew.Rate != 0 && skew.Rate != 1 {
+		result = fmt.Sprintf("%v x%v", result, strconv.FormatFloat(skew.Rate, 'f', -1, 64))
+	}
+	return result
+}
+
+/*
+Replaces the contents of a faked time file, via a rename so that libfaketime never reads a partially-written file
+ */
+func writeFakeTimeFile(fakeTimeFilepath string, fakeTimeSpec string) error {
+	tempFilepath := fakeTimeFilepath + ".tmp"
+	if err := ioutil.WriteFile(tempFilepath, []byte(fakeTimeSpec + "\n"), 0644); err != nil {
+		return stacktrace.Propagate(err, "An error occurred writing faked time file '%v'", tempFilepath)
+	}
+	if err := os.Rename(tempFilepath, fakeTimeFilepath); err != nil {
+		return stacktrace.Propagate(err, "An error occurred moving faked time file '%v' to '%v'", tempFilepath, fakeTimeFilepath)
+	}
+	return nil
+}
+
+func copyFile(sourceFilepath string, destinationFilepath string) error {
+	source, err := os.Open(sourceFilepath)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred opening file '%v'", sourceFilepath)
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(destinationFilepath, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0755)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred creating file '%v'", destinationFilepath)
+	}
+	defer destination.Close()
+
+	if _, err := io.Copy(destination, source); err != nil {
+		return stacktrace.Propagate(err, "An error occurred copying file '%v' to '%v'", sourceFilepath, destinationFilepath)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package networks
+
+import (
+	"gotest.tools/v3/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFakeTimeSpec(t *testing.T) {
+	assert.Equal(t, getFakeTimeSpec(ClockSkew{}), "+0")
+	assert.Equal(t, getFakeTimeSpec(ClockSkew{Offset: 30 * time.Second}), "+30")
+	assert.Equal(t, getFakeTimeSpec(ClockSkew{Offset: -1500 * time.Millisecond}), "-1.5")
+	assert.Equal(t, getFakeTimeSpec(ClockSkew{Offset: time.Hour, Rate: 1}), "+3600")
+	assert.Equal(t, getFakeTimeSpec(ClockSkew{Rate: 2.5}), "+0 x2.5")
+}
+
+func TestClockSkewValidation(t *testing.T) {
+	assert.NilError(t, ClockSkew{Offset: -time.Minute, Rate: 0.5}.validate())
+	assert.ErrorContains(t, ClockSkew{Rate: -1}.validate(), "non-negative")
+}
+
+func TestSetClockSkew(t *testing.T) {
+	testVolumeDirpath, err := ioutil.TempDir("", "clock-skew-test")
+	assert.NilError(t, err)
+	defer os.RemoveAll(testVolumeDirpath)
+	libraryFilepath := filepath.Join(testVolumeDirpath, "libfaketime.so.1")
+	assert.NilError(t, ioutil.WriteFile(libraryFilepath, []byte("library"), 0644))
+
+	builder := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", testVolumeDirpath)
+	options := ServiceConfigurationOptions{FakeTimeLibraryFilepath: libraryFilepath}
+	assert.NilError(t, builder.AddConfigurationWithOptions(testConfiguration, "test", getTestInitializerCore(), getTestCheckerCore(), options))
+	network := builder.Build()
+
+	envVariables, fakeTimeFilepath, err := network.createFakeTimeFiles(network.configurations[testConfiguration])
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(envVariables["LD_PRELOAD"], "/foo/bar/" + clockSkewDirname + "/libfaketime-"))
+	assert.Equal(t, envVariables["FAKETIME_TIMESTAMP_FILE"], filepath.Join("/foo/bar", clockSkewDirname, filepath.Base(fakeTimeFilepath)))
+	libraryContents, err := ioutil.ReadFile(filepath.Join(testVolumeDirpath, clockSkewDirname, filepath.Base(envVariables["LD_PRELOAD"])))
+	assert.NilError(t, err)
+	assert.Equal(t, string(libraryContents), "library")
+
+	// The library is only copied into the test volume once
+	otherEnvVariables, _, err := network.createFakeTimeFiles(network.configurations[testConfiguration])
+	assert.NilError(t, err)
+	assert.Equal(t, otherEnvVariables["LD_PRELOAD"], envVariables["LD_PRELOAD"])
+	assert.Assert(t, otherEnvVariables["FAKETIME_TIMESTAMP_FILE"] != envVariables["FAKETIME_TIMESTAMP_FILE"])
+
+	network.serviceNodes[testServiceName] = ServiceNode{}
+	network.serviceNodes["unskewable"] = ServiceNode{}
+	network.fakeTimeFilepaths[testServiceName] = fakeTimeFilepath
+	assertFakeTimeFileContents(t, fakeTimeFilepath, "+0\n")
+
+	assert.NilError(t, network.SetClockSkew(testServiceName, ClockSkew{Offset: 30 * time.Second}))
+	assertFakeTimeFileContents(t, fakeTimeFilepath, "+30\n")
+	assert.Equal(t, network.GetClockSkew(testServiceName), ClockSkew{Offset: 30 * time.Second})
+
+	assert.NilError(t, network.ResetClockSkew(testServiceName))
+	assertFakeTimeFileContents(t, fakeTimeFilepath, "+0\n")
+	assert.Equal(t, network.GetClockSkew(testServiceName), ClockSkew{})
+
+	assert.ErrorContains(t, network.SetClockSkew(testServiceName, ClockSkew{Rate: -2}), "Invalid clock skew")
+	assert.ErrorContains(t, network.SetClockSkew("unskewable", ClockSkew{Offset: time.Second}), "libfaketime")
+	assert.ErrorContains(t, network.SetClockSkew("nonexistent", ClockSkew{Offset: time.Second}), "No service")
+}
+
+func assertFakeTimeFileContents(t *testing.T, fakeTimeFilepath string, expected string) {
+	contents, err := ioutil.ReadFile(fakeTimeFilepath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), expected)
+}
@@ -0,0 +1,101 @@
+package networks
+
+import (
+	"context"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The file, in a filled directory, that takes up the filesystem's space
+	diskFillFilename = ".kurtosis-disk-fill"
+
+	// The shell that the disk fault scripts are run with in the service's container
+	diskFaultShell = "sh"
+)
+
+var (
+	/*
+	Fills the filesystem of the directory given as the first argument until it's the percentage given as the second
+		argument full, replacing any earlier fill. fallocate is fastest but isn't supported by every filesystem or image,
+		so dd is fallen back to; dd fails when it runs out of space, which is the desired outcome of filling a filesystem
+		to 100%, so its failure is ignored.
+	 */
+	diskFillScript = strings.Join([]string{
+		"set -e",
+		`fill_filepath="$1/` + diskFillFilename + `"`,
+		`rm -f "$fill_filepath"`,
+		`set -- $(df -Pk "$1" | awk 'NR == 2 { print $2, $3 }') "$2"`,
+		`fill_kb=$(( $1 * $3 / 100 - $2 ))`,
+		`if [ "$fill_kb" -gt 0 ]; then`,
+		`  fallocate -l "$(( fill_kb * 1024 ))" "$fill_filepath" 2>/dev/null || dd if=/dev/zero of="$fill_filepath" bs=1024 count="$fill_kb" 2>/dev/null || true`,
+		`fi`,
+	}, "\n")
+
+	// Frees the space taken up by a fill of the directory given as the first argument
+	diskFreeScript = `rm -f "$1/` + diskFillFilename + `"`
+)
+
+/*
+Fills the filesystem holding the given directory of a service until it's the given percentage full, by writing a file
+	into the directory from inside the service's container, so that the test can check how the service copes with a
+	full disk. Any fill previously made in the directory is replaced, and FreeServiceDisk frees the space again.
+
+The directory is best given its own small filesystem with ServiceConfigurationOptions.TmpfsMounts, because filling a
+	directory on the container's root filesystem fills the Docker host's disk. The service's image must contain sh, df,
+	awk, and either fallocate or dd.
+
+Args:
+	serviceId: The ID of the service whose disk to fill
+	dirpath: The path, in the service's container, of the directory to fill (e.g. the service's data directory)
+	targetPercent: How full, from 0 to 100, the directory's filesystem should be afterwards (if it's already fuller, no
+		space is taken up)
+ */
+func (network *ServiceNetwork) FillServiceDisk(serviceId ServiceID, dirpath string, targetPercent uint) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if targetPercent > 100 {
+		return stacktrace.NewError("Target disk usage must be a percentage from 0 to 100, but was %v", targetPercent)
+	}
+	logrus.Debugf("Filling directory '%v' of service %v to %v%% full", dirpath, serviceId, targetPercent)
+	if err := network.runDiskFaultScript(serviceId, diskFillScript, dirpath, strconv.FormatUint(uint64(targetPercent), 10)); err != nil {
+		return stacktrace.Propagate(err, "An error occurred filling directory '%v' of service %v to %v%% full", dirpath, serviceId, targetPercent)
+	}
+	return nil
+}
+
+/*
+Frees the space taken up by FillServiceDisk in the given directory of a service (doing nothing if it isn't filled)
+
+Args:
+	serviceId: The ID of the service whose disk to free
+	dirpath: The path, in the service's container, of the directory that was filled
+ */
+func (network *ServiceNetwork) FreeServiceDisk(serviceId ServiceID, dirpath string) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	logrus.Debugf("Freeing the filled space in directory '%v' of service %v", dirpath, serviceId)
+	if err := network.runDiskFaultScript(serviceId, diskFreeScript, dirpath); err != nil {
+		return stacktrace.Propagate(err, "An error occurred freeing the filled space in directory '%v' of service %v", dirpath, serviceId)
+	}
+	return nil
+}
+
+/*
+Runs the given disk fault script in the container of the given service, passing the script's arguments as positional
+	parameters so that they never need shell quoting
+ */
+func (network *ServiceNetwork) runDiskFaultScript(serviceId ServiceID, script string, scriptArgs ...string) error {
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	// The argument after the script is the shell's $0, which is only used in its error messages
+	cmd := append([]string{diskFaultShell, "-c", script, diskFaultShell}, scriptArgs...)
+	if _, err := network.dockerManager.RunInContainer(context.Background(), node.ContainerId, cmd); err != nil {
+		return stacktrace.Propagate(err, "An error occurred running a disk fault script in the container of service %v", serviceId)
+	}
+	return nil
+}
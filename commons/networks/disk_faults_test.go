@@ -0,0 +1,43 @@
+package networks
+
+import (
+	"gotest.tools/v3/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskFaultsValidation(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	assert.ErrorContains(t, network.FillServiceDisk(testServiceName, "/data", 101), "0 to 100")
+	assert.ErrorContains(t, network.FillServiceDisk(testServiceName, "/data", 90), "No service")
+	assert.ErrorContains(t, network.FreeServiceDisk(testServiceName, "/data"), "No service")
+}
+
+func TestDiskFaultScripts(t *testing.T) {
+	dirpath, err := ioutil.TempDir("", "disk faults test")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+	fillFilepath := filepath.Join(dirpath, diskFillFilename)
+
+	// Filling to 0% replaces any earlier fill without taking up any space, so it's safe to run against the real disk
+	assert.NilError(t, ioutil.WriteFile(fillFilepath, []byte("earlier fill"), 0644))
+	runDiskFaultScriptLocally(t, diskFillScript, dirpath, "0")
+	_, err = os.Stat(fillFilepath)
+	assert.Assert(t, os.IsNotExist(err))
+
+	assert.NilError(t, ioutil.WriteFile(fillFilepath, []byte("fill"), 0644))
+	runDiskFaultScriptLocally(t, diskFreeScript, dirpath)
+	_, err = os.Stat(fillFilepath)
+	assert.Assert(t, os.IsNotExist(err))
+
+	// Freeing an unfilled directory is a no-op
+	runDiskFaultScriptLocally(t, diskFreeScript, dirpath)
+}
+
+func runDiskFaultScriptLocally(t *testing.T, script string, scriptArgs ...string) {
+	output, err := exec.Command(diskFaultShell, append([]string{"-c", script, diskFaultShell}, scriptArgs...)...).CombinedOutput()
+	assert.NilError(t, err, string(output))
+}
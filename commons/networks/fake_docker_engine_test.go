@@ -0,0 +1,41 @@
+package networks
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	"testing"
+)
+
+/*
+A command that was run in the network namespace of a service's container, via a sidecar
+ */
+type fakeSidecarCommand struct {
+	containerId string
+
+	// The shell script the sidecar ran
+	script string
+}
+
+func getFakeDockerManager(t *testing.T, engine *dockertest.FakeDockerEngine) *docker.DockerManager {
+	dockerManager, err := docker.NewDockerManager(logrus.StandardLogger(), engine.NewClient())
+	assert.NilError(t, err)
+	return dockerManager
+}
+
+/*
+Gets the commands that were run in containers' network namespaces via sidecars on the given fake Docker engine, in order
+ */
+func getSidecarCommands(engine *dockertest.FakeDockerEngine) []fakeSidecarCommand {
+	result := []fakeSidecarCommand{}
+	for _, createdContainer := range engine.GetCreatedContainers() {
+		if containerId := createdContainer.GetNetworkNamespaceContainerId(); containerId != "" {
+			result = append(result, fakeSidecarCommand{
+				containerId: containerId,
+				script:      createdContainer.Config.Cmd[len(createdContainer.Config.Cmd) - 1],
+			})
+		}
+	}
+	return result
+}
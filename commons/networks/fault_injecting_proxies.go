@@ -0,0 +1,360 @@
+package networks
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/go-connections/nat"
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
+	"github.com/kurtosis-tech/kurtosis/commons/services"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	// The default Docker image of the fault-injecting proxies placed between services and their dependencies
+	DEFAULT_FAULT_INJECTING_PROXY_IMAGE = "shopify/toxiproxy:2.1.4"
+
+	// How long a newly-started proxy has to start serving its API
+	proxyStartupTimeout = 30 * time.Second
+
+	// How long to wait for proxies to stop when cleaning them up after a service fails to be added
+	proxyStopTimeout = 10 * time.Second
+
+	tcpProtocol = "tcp"
+
+	upstreamToxicStream = "upstream"
+	downstreamToxicStream = "downstream"
+
+	latencyToxicType = "latency"
+	bandwidthToxicType = "bandwidth"
+	timeoutToxicType = "timeout"
+	resetPeerToxicType = "reset_peer"
+)
+
+/*
+A fault injected into the connections going through a link's proxy (see ServiceNetworkBuilder.SetFaultInjectingProxyImage),
+	corresponding to a Toxiproxy "toxic". Use the New*Toxic functions to create the common ones.
+ */
+type ProxyToxic struct {
+	// The Toxiproxy toxic type (e.g. "latency", "bandwidth", "timeout", "reset_peer", "slicer", "limit_data")
+	Type string
+
+	// If true, the toxic affects data sent by the service to its dependency; if false, data sent back by the dependency
+	Upstream bool
+
+	// The probability, in [0, 1], that the toxic affects any given connection
+	Toxicity float64
+
+	// The toxic type's attributes, as documented by Toxiproxy (e.g. "latency" and "jitter" in milliseconds for latency)
+	Attributes map[string]int64
+}
+
+// Delays the data the dependency sends back by the given latency, plus or minus up to the given jitter
+func NewLatencyToxic(latency time.Duration, jitter time.Duration) ProxyToxic {
+	return ProxyToxic{
+		Type:     latencyToxicType,
+		Toxicity: 1,
+		Attributes: map[string]int64{
+			"latency": latency.Milliseconds(),
+			"jitter":  jitter.Milliseconds(),
+		},
+	}
+}
+
+// Limits the rate the dependency can send data back at
+func NewBandwidthToxic(kilobytesPerSecond int64) ProxyToxic {
+	return ProxyToxic{
+		Type:     bandwidthToxicType,
+		Toxicity: 1,
+		Attributes: map[string]int64{
+			"rate": kilobytesPerSecond,
+		},
+	}
+}
+
+// Stops all data from getting through, closing connections after the given timeout (0 to hold them open forever)
+func NewTimeoutToxic(timeout time.Duration) ProxyToxic {
+	return ProxyToxic{
+		Type:     timeoutToxicType,
+		Toxicity: 1,
+		Attributes: map[string]int64{
+			"timeout": timeout.Milliseconds(),
+		},
+	}
+}
+
+// Resets connections (as a TCP RST, i.e. "connection reset by peer") after the given time (0 to reset them immediately)
+func NewResetPeerToxic(after time.Duration) ProxyToxic {
+	return ProxyToxic{
+		Type:     resetPeerToxicType,
+		Toxicity: 1,
+		Attributes: map[string]int64{
+			"timeout": after.Milliseconds(),
+		},
+	}
+}
+
+// Toxics are named by type and direction, so that setting a toxic replaces any toxic of the same kind on the link
+func (toxic ProxyToxic) getName() string {
+	stream := downstreamToxicStream
+	if toxic.Upstream {
+		stream = upstreamToxicStream
+	}
+	return fmt.Sprintf("%v_%v", toxic.Type, stream)
+}
+
+/*
+A proxy sitting on the link between a service and one of its dependencies, which the service is told is the dependency
+ */
+type linkProxy struct {
+	// The IP of the proxy, which the service was given instead of the dependency's IP
+	ipAddr net.IP
+
+	// The ID of the Docker container running the proxy
+	containerId string
+
+	client *toxiproxyClient
+
+	// The names of the Toxiproxy proxies on the proxy container, one per TCP port of the dependency
+	portProxyNames []string
+
+	// Mapping of name of a toxic applied to the link -> "set" of the names of the port proxies it's currently applied to,
+	//  which is tracked per port so that a toxic that only got applied to some ports can still be replaced and removed
+	toxicNames map[string]map[string]bool
+}
+
+/*
+Starts a fault-injecting proxy between the given service and each of its dependencies.
+
+Args:
+	context: The context the proxies are started in
+	serviceId: The ID of the service being added to the network
+	dependencies: The "set" of IDs of the service's dependencies
+
+Returns:
+	The dependencies as the service should see them, with each dependency's IP being the IP of its proxy
+ */
+func (network *ServiceNetwork) createLinkProxies(
+			context context.Context,
+			serviceId ServiceID,
+			dependencies map[ServiceID]bool) ([]services.Service, error) {
+	// Sorted so that proxies are given IPs in a deterministic order
+	dependencyIds := []string{}
+	for dependencyId, _ := range dependencies {
+		dependencyIds = append(dependencyIds, string(dependencyId))
+	}
+	sort.Strings(dependencyIds)
+
+	proxiedDependencies := []services.Service{}
+	proxies := map[ServiceID]*linkProxy{}
+	network.linkProxies[serviceId] = proxies
+	for _, dependencyIdStr := range dependencyIds {
+		dependencyId := ServiceID(dependencyIdStr)
+		dependencyNode := network.serviceNodes[dependencyId]
+		dependencyConfig := network.configurations[dependencyNode.configurationId]
+
+		proxy, err := network.createLinkProxy(context, dependencyNode, dependencyConfig.initializerCore.GetUsedPorts())
+		// A proxy whose container started is tracked even if setting it up failed, so that its container gets stopped
+		if proxy != nil {
+			proxies[dependencyId] = proxy
+		}
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred creating the proxy from service %v to dependency %v", serviceId, dependencyId)
+		}
+		proxiedDependencies = append(proxiedDependencies, dependencyConfig.initializerCore.GetServiceFromIp(proxy.ipAddr.String()))
+	}
+	return proxiedDependencies, nil
+}
+
+func (network *ServiceNetwork) createLinkProxy(
+			context context.Context,
+			dependencyNode ServiceNode,
+			dependencyUsedPorts map[nat.Port]bool) (*linkProxy, error) {
+	proxyIp, err := network.freeIpTracker.GetFreeIpAddr()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to allocate an IP for the proxy")
+	}
+	apiPort, err := nat.NewPort(tcpProtocol, fmt.Sprintf("%v", toxiproxyApiPort))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred building the proxy API port")
+	}
+	containerId, err := network.dockerManager.CreateAndStartContainer(
+		context,
+		network.faultInjectingProxyImage,
+		network.dockerNetworkId,
+		proxyIp,
+		map[nat.Port]bool{apiPort: true},
+		nil,
+		map[string]string{},
+		map[string]string{},
+		map[string]string{},
+		docker.ContainerHostOptions{})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred starting the proxy container")
+	}
+	proxy := &linkProxy{
+		ipAddr:      proxyIp,
+		containerId: containerId,
+		client:      newToxiproxyClient(proxyIp),
+		toxicNames:  map[string]map[string]bool{},
+	}
+	if err := proxy.client.waitForStartup(proxyStartupTimeout); err != nil {
+		return proxy, stacktrace.Propagate(err, "An error occurred waiting for the proxy to start")
+	}
+
+	// Only TCP can be proxied, so traffic on the dependency's other ports won't get through
+	for port, _ := range dependencyUsedPorts {
+		if port.Proto() != tcpProtocol {
+			logrus.Warnf("Port %v of the dependency at %v isn't TCP, so it can't be proxied", port, dependencyNode.IpAddr)
+			continue
+		}
+		portProxy := toxiproxyProxy{
+			Name:     fmt.Sprintf("port-%v", port.Port()),
+			Listen:   fmt.Sprintf("0.0.0.0:%v", port.Port()),
+			Upstream: fmt.Sprintf("%v:%v", dependencyNode.IpAddr.String(), port.Port()),
+			Enabled:  true,
+		}
+		if err := proxy.client.createProxy(portProxy); err != nil {
+			return proxy, stacktrace.Propagate(err, "An error occurred proxying port %v", port)
+		}
+		proxy.portProxyNames = append(proxy.portProxyNames, portProxy.Name)
+	}
+	return proxy, nil
+}
+
+/*
+Makes a best-effort attempt to stop the proxies between the given service and its dependencies
+ */
+func (network *ServiceNetwork) removeLinkProxies(serviceId ServiceID, containerStopTimeout time.Duration) {
+	for dependencyId, proxy := range network.linkProxies[serviceId] {
+		if err := network.dockerManager.StopContainer(context.Background(), proxy.containerId, &containerStopTimeout); err != nil {
+			logrus.Errorf(
+				"The following error occurred stopping the proxy from service %v to dependency %v with container ID %v:",
+				serviceId,
+				dependencyId,
+				proxy.containerId)
+			fmt.Fprintln(logrus.StandardLogger().Out, err)
+		}
+	}
+	delete(network.linkProxies, serviceId)
+}
+
+/*
+Applies the given toxic to all the connections the given service makes to the given dependency, through the proxy
+	between them. Any toxic of the same type and direction already on the link is replaced.
+
+Args:
+	fromServiceId: The ID of the service whose connections will be affected
+	toServiceId: The ID of the dependency that the connections go to
+	toxic: The fault to inject
+ */
+func (network *ServiceNetwork) SetLinkProxyToxic(fromServiceId ServiceID, toServiceId ServiceID, toxic ProxyToxic) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	proxy, err := network.getLinkProxy(fromServiceId, toServiceId)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred getting the proxy from service %v to service %v", fromServiceId, toServiceId)
+	}
+
+	toxicName := toxic.getName()
+	stream := downstreamToxicStream
+	if toxic.Upstream {
+		stream = upstreamToxicStream
+	}
+	toxicPortProxyNames, found := proxy.toxicNames[toxicName]
+	if !found {
+		toxicPortProxyNames = map[string]bool{}
+		proxy.toxicNames[toxicName] = toxicPortProxyNames
+	}
+	// Each port is recorded as soon as its toxic changes, so that if a later port fails, retrying or clearing the toxics
+	//  still knows which ports have it
+	for _, portProxyName := range proxy.portProxyNames {
+		if toxicPortProxyNames[portProxyName] {
+			if err := proxy.client.removeToxic(portProxyName, toxicName); err != nil {
+				return stacktrace.Propagate(err, "An error occurred replacing toxic %v on the link from service %v to service %v", toxicName, fromServiceId, toServiceId)
+			}
+			delete(toxicPortProxyNames, portProxyName)
+		}
+		err := proxy.client.addToxic(portProxyName, toxiproxyToxic{
+			Name:       toxicName,
+			Type:       toxic.Type,
+			Stream:     stream,
+			Toxicity:   toxic.Toxicity,
+			Attributes: toxic.Attributes,
+		})
+		if err != nil {
+			return stacktrace.Propagate(err, "An error occurred adding toxic %v to the link from service %v to service %v", toxicName, fromServiceId, toServiceId)
+		}
+		toxicPortProxyNames[portProxyName] = true
+	}
+	return nil
+}
+
+/*
+Removes all the toxics on the link from the given service to the given dependency, so its connections work normally again
+ */
+func (network *ServiceNetwork) ClearLinkProxyToxics(fromServiceId ServiceID, toServiceId ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.clearLinkProxyToxics(fromServiceId, toServiceId)
+}
+
+func (network *ServiceNetwork) clearLinkProxyToxics(fromServiceId ServiceID, toServiceId ServiceID) error {
+	proxy, err := network.getLinkProxy(fromServiceId, toServiceId)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred getting the proxy from service %v to service %v", fromServiceId, toServiceId)
+	}
+	for toxicName, toxicPortProxyNames := range proxy.toxicNames {
+		for portProxyName, _ := range toxicPortProxyNames {
+			if err := proxy.client.removeToxic(portProxyName, toxicName); err != nil {
+				return stacktrace.Propagate(err, "An error occurred removing toxic %v from the link from service %v to service %v", toxicName, fromServiceId, toServiceId)
+			}
+			delete(toxicPortProxyNames, portProxyName)
+		}
+		delete(proxy.toxicNames, toxicName)
+	}
+	return nil
+}
+
+/*
+Removes all the toxics on all the links in the network
+ */
+func (network *ServiceNetwork) ClearAllLinkProxyToxics() error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	for fromServiceId, proxies := range network.linkProxies {
+		for toServiceId, _ := range proxies {
+			if err := network.clearLinkProxyToxics(fromServiceId, toServiceId); err != nil {
+				return stacktrace.Propagate(err, "An error occurred clearing all the link toxics in the network")
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Gets the IP of the proxy that the given service was told is the IP of the given dependency
+ */
+func (network *ServiceNetwork) GetLinkProxyIp(fromServiceId ServiceID, toServiceId ServiceID) (net.IP, error) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	proxy, err := network.getLinkProxy(fromServiceId, toServiceId)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred getting the proxy from service %v to service %v", fromServiceId, toServiceId)
+	}
+	return proxy.ipAddr, nil
+}
+
+func (network *ServiceNetwork) getLinkProxy(fromServiceId ServiceID, toServiceId ServiceID) (*linkProxy, error) {
+	if network.faultInjectingProxyImage == "" {
+		return nil, stacktrace.NewError("Fault-injecting proxies aren't enabled; enable them with ServiceNetworkBuilder.SetFaultInjectingProxyImage")
+	}
+	proxy, found := network.linkProxies[fromServiceId][toServiceId]
+	if !found {
+		return nil, stacktrace.NewError("Service %v wasn't added with a dependency on service %v, so there's no link between them", fromServiceId, toServiceId)
+	}
+	return proxy, nil
+}
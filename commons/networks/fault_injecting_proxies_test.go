@@ -0,0 +1,190 @@
+package networks
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"gotest.tools/v3/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyToxicNames(t *testing.T) {
+	latencyToxic := NewLatencyToxic(100 * time.Millisecond, 10 * time.Millisecond)
+	assert.Equal(t, latencyToxic.getName(), "latency_downstream")
+	assert.Equal(t, latencyToxic.Attributes["latency"], int64(100))
+	assert.Equal(t, latencyToxic.Attributes["jitter"], int64(10))
+
+	upstreamResetToxic := NewResetPeerToxic(0)
+	upstreamResetToxic.Upstream = true
+	assert.Equal(t, upstreamResetToxic.getName(), "reset_peer_upstream")
+}
+
+func TestLinkProxiesMustBeEnabled(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	err := network.SetLinkProxyToxic("node1", "node2", NewTimeoutToxic(0))
+	assert.ErrorContains(t, err, "aren't enabled")
+
+	builder := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar")
+	builder.SetFaultInjectingProxyImage(DEFAULT_FAULT_INJECTING_PROXY_IMAGE)
+	_, err = builder.Build().GetLinkProxyIp("node1", "node2")
+	assert.ErrorContains(t, err, "no link between them")
+}
+
+func TestToxiproxyClient(t *testing.T) {
+	receivedToxics := []toxiproxyToxic{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch {
+		case request.Method == http.MethodPost && request.URL.Path == "/proxies/port-80/toxics":
+			toxic := toxiproxyToxic{}
+			assert.NilError(t, json.NewDecoder(request.Body).Decode(&toxic))
+			receivedToxics = append(receivedToxics, toxic)
+			writer.WriteHeader(http.StatusOK)
+		case request.Method == http.MethodDelete:
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte("toxic not found"))
+		default:
+			writer.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	client := &toxiproxyClient{apiUrl: server.URL, httpClient: server.Client()}
+
+	assert.NilError(t, client.addToxic("port-80", toxiproxyToxic{Name: "latency_downstream", Type: "latency"}))
+	assert.Equal(t, len(receivedToxics), 1)
+	assert.Equal(t, receivedToxics[0].Name, "latency_downstream")
+
+	assert.ErrorContains(t, client.removeToxic("port-80", "latency_downstream"), "toxic not found")
+}
+
+func TestLinkProxyToxicsTrackedPerPort(t *testing.T) {
+	// A fake Toxiproxy that rejects duplicate toxics like the real one does, and fails adding toxics to port 443 for as
+	//  long as failingPortProxyName is set
+	appliedToxics := map[string]map[string]bool{"port-80": {}, "port-443": {}}
+	failingPortProxyName := "port-443"
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		pathParts := strings.Split(strings.TrimPrefix(request.URL.Path, "/proxies/"), "/")
+		portProxyName := pathParts[0]
+		switch request.Method {
+		case http.MethodPost:
+			toxic := toxiproxyToxic{}
+			assert.NilError(t, json.NewDecoder(request.Body).Decode(&toxic))
+			if portProxyName == failingPortProxyName {
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if appliedToxics[portProxyName][toxic.Name] {
+				writer.WriteHeader(http.StatusConflict)
+				return
+			}
+			appliedToxics[portProxyName][toxic.Name] = true
+		case http.MethodDelete:
+			toxicName := pathParts[2]
+			if !appliedToxics[portProxyName][toxicName] {
+				writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(appliedToxics[portProxyName], toxicName)
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	builder := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar")
+	builder.SetFaultInjectingProxyImage(DEFAULT_FAULT_INJECTING_PROXY_IMAGE)
+	network := builder.Build()
+	network.linkProxies["node1"] = map[ServiceID]*linkProxy{
+		"node2": {
+			client:         &toxiproxyClient{apiUrl: server.URL, httpClient: server.Client()},
+			portProxyNames: []string{"port-80", "port-443"},
+			toxicNames:     map[string]map[string]bool{},
+		},
+	}
+	latencyToxic := NewLatencyToxic(100 * time.Millisecond, 0)
+
+	// The toxic only gets applied to the first port, which is still tracked
+	assert.ErrorContains(t, network.SetLinkProxyToxic("node1", "node2", latencyToxic), "port-443")
+	assert.DeepEqual(t, appliedToxics, map[string]map[string]bool{"port-80": {"latency_downstream": true}, "port-443": {}})
+
+	// Retrying replaces the toxic on the first port rather than conflicting with it
+	failingPortProxyName = ""
+	assert.NilError(t, network.SetLinkProxyToxic("node1", "node2", latencyToxic))
+	assert.DeepEqual(t, appliedToxics, map[string]map[string]bool{
+		"port-80":  {"latency_downstream": true},
+		"port-443": {"latency_downstream": true},
+	})
+
+	assert.NilError(t, network.ClearLinkProxyToxics("node1", "node2"))
+	assert.DeepEqual(t, appliedToxics, map[string]map[string]bool{"port-80": {}, "port-443": {}})
+	assert.Equal(t, len(network.linkProxies["node1"]["node2"].toxicNames), 0)
+}
+
+func TestClearingPartiallyAppliedLinkProxyToxic(t *testing.T) {
+	removedPortProxyNames := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodDelete {
+			removedPortProxyNames = append(removedPortProxyNames, strings.Split(request.URL.Path, "/")[2])
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	builder := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar")
+	builder.SetFaultInjectingProxyImage(DEFAULT_FAULT_INJECTING_PROXY_IMAGE)
+	network := builder.Build()
+	network.linkProxies["node1"] = map[ServiceID]*linkProxy{
+		"node2": {
+			client:         &toxiproxyClient{apiUrl: server.URL, httpClient: server.Client()},
+			portProxyNames: []string{"port-80", "port-443"},
+			toxicNames:     map[string]map[string]bool{"latency_downstream": {"port-80": true}},
+		},
+	}
+
+	// Only the port that has the toxic gets a removal request, which would fail with a 404 on the other port
+	assert.NilError(t, network.ClearLinkProxyToxics("node1", "node2"))
+	assert.DeepEqual(t, removedPortProxyNames, []string{"port-80"})
+}
+
+func TestPartitionsAndLinkConditionsCoverLinkProxies(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	builder := NewServiceNetworkBuilder(getFakeDockerManager(t, engine), testNetworkName, nil, "test", "/foo/bar")
+	builder.SetFaultInjectingProxyImage(DEFAULT_FAULT_INJECTING_PROXY_IMAGE)
+	network := builder.Build()
+	node1Ip := net.ParseIP("172.23.0.2")
+	node2Ip := net.ParseIP("172.23.0.3")
+	proxyIp := net.ParseIP("172.23.0.4")
+	network.serviceNodes["node1"] = ServiceNode{IpAddr: node1Ip, ContainerId: "node1-container"}
+	network.serviceNodes["node2"] = ServiceNode{IpAddr: node2Ip, ContainerId: "node2-container"}
+	// node1 depends on node2, so it talks to node2 through the proxy
+	network.linkProxies["node1"] = map[ServiceID]*linkProxy{
+		"node2": {ipAddr: proxyIp, toxicNames: map[string]map[string]bool{}},
+	}
+
+	// node2 drops the traffic node1 sends it through the proxy, which comes from the proxy's IP
+	assert.NilError(t, network.PartitionOneWay([]ServiceID{"node1"}, []ServiceID{"node2"}))
+	sidecarCommands := getSidecarCommands(engine)
+	assert.Equal(t, len(sidecarCommands), 1)
+	assert.Equal(t, sidecarCommands[0].containerId, "node2-container")
+	assert.Assert(t, strings.HasSuffix(sidecarCommands[0].script, fmt.Sprintf(
+		"iptables -A %v -s %v -j DROP && iptables -A %v -s %v -j DROP",
+		partitionIptablesChain,
+		node1Ip,
+		partitionIptablesChain,
+		proxyIp)))
+
+	// node1's traffic to node2 is shaped both when it goes to node2 directly and when it goes through the proxy
+	conditions := LinkConditions{Delay: 100 * time.Millisecond}
+	assert.NilError(t, network.SetLinkConditions("node1", "node2", conditions))
+	sidecarCommands = getSidecarCommands(engine)
+	assert.Equal(t, len(sidecarCommands), 2)
+	assert.Equal(t, sidecarCommands[1].containerId, "node1-container")
+	assert.Equal(t, sidecarCommands[1].script, getTcScript(node1Ip, LinkConditions{}, map[string]LinkConditions{
+		node2Ip.String(): conditions,
+		proxyIp.String(): conditions,
+	}))
+}
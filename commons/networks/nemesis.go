@@ -0,0 +1,468 @@
+package networks
+
+import (
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/services"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A kind of fault that a Nemesis can inject
+type NemesisFaultType string
+
+const (
+	// Kills a service with SIGKILL, and restarts it when the fault is healed
+	KILL_RESTART_FAULT NemesisFaultType = "kill-restart"
+
+	// Partitions a random group of services off from the rest of the network
+	PARTITION_FAULT NemesisFaultType = "partition"
+
+	// Pauses a service, and unpauses it when the fault is healed
+	PAUSE_FAULT NemesisFaultType = "pause"
+
+	// Delays all the traffic a service sends
+	LATENCY_FAULT NemesisFaultType = "latency"
+
+	// The signal that KILL_RESTART_FAULT kills services with
+	nemesisKillSignal = "SIGKILL"
+
+	// How long a service killed by the nemesis is given to stop when it's restarted (it's already dead, so this is moot)
+	nemesisRestartStopTimeout = 10 * time.Second
+)
+
+/*
+Configures what faults a Nemesis injects, and how often
+ */
+type NemesisConfig struct {
+	// The "set" of kinds of faults to inject (empty for all of them)
+	FaultTypes map[NemesisFaultType]bool
+
+	// The IDs of the services that faults can be injected into (empty for all the services in the network)
+	TargetServiceIds []ServiceID
+
+	// The range that the time between one fault being healed and the next one being injected is picked from, where the
+	//  minimum must be greater than 0 and the maximum at least the minimum
+	MinInterval time.Duration
+	MaxInterval time.Duration
+
+	// The range that how long each fault lasts is picked from, where the minimum must be greater than 0 and the maximum
+	//  at least the minimum
+	MinFaultDuration time.Duration
+	MaxFaultDuration time.Duration
+
+	// The delay that LATENCY_FAULT adds to a service's traffic, which must be greater than 0 if LATENCY_FAULT is injected
+	Latency time.Duration
+}
+
+func (config NemesisConfig) validate() error {
+	if err := validateNemesisDurationRange("interval", config.MinInterval, config.MaxInterval); err != nil {
+		return stacktrace.Propagate(err, "Invalid nemesis interval range")
+	}
+	if err := validateNemesisDurationRange("fault duration", config.MinFaultDuration, config.MaxFaultDuration); err != nil {
+		return stacktrace.Propagate(err, "Invalid nemesis fault duration range")
+	}
+	injectsLatency := len(config.FaultTypes) == 0 || config.FaultTypes[LATENCY_FAULT]
+	if injectsLatency && config.Latency <= 0 {
+		return stacktrace.NewError("Latency must be greater than 0 when %v faults are injected, but was %v", LATENCY_FAULT, config.Latency)
+	}
+	return nil
+}
+
+func validateNemesisDurationRange(name string, min time.Duration, max time.Duration) error {
+	if min <= 0 {
+		return stacktrace.NewError("Minimum %v must be greater than 0, but was %v", name, min)
+	}
+	if max < min {
+		return stacktrace.NewError("Maximum %v %v is less than the minimum %v %v", name, max, name, min)
+	}
+	return nil
+}
+
+/*
+An event in a Nemesis's timeline
+ */
+type NemesisEvent struct {
+	// How long after the nemesis was started the event happened
+	Elapsed time.Duration
+
+	// What happened
+	Description string
+}
+
+func (event NemesisEvent) String() string {
+	return fmt.Sprintf("+%v %v", event.Elapsed.Round(time.Millisecond), event.Description)
+}
+
+/*
+A single fault in a Nemesis's schedule
+ */
+type nemesisFault struct {
+	faultType NemesisFaultType
+
+	// How long to wait before injecting the fault
+	waitBefore time.Duration
+
+	// How long the fault lasts before it's healed
+	duration time.Duration
+
+	// The services the fault is injected into (for a partition, the group of services that's partitioned off)
+	serviceIds []ServiceID
+}
+
+func (fault nemesisFault) String() string {
+	serviceIdStrs := []string{}
+	for _, serviceId := range fault.serviceIds {
+		serviceIdStrs = append(serviceIdStrs, string(serviceId))
+	}
+	return fmt.Sprintf("%v [%v]", fault.faultType, strings.Join(serviceIdStrs, ", "))
+}
+
+/*
+A Jepsen-style nemesis, which injects faults into a ServiceNetwork in the background while a test runs, one at a time, on
+	a random schedule. The schedule is fully determined by the seed, so a schedule that made a test fail can be replayed
+	by creating a nemesis with the same seed and config. Every fault is logged to a timeline in the test output.
+
+Typical usage in a test's Run method:
+
+	nemesis, err := networks.NewNemesis(serviceNetwork, config, 0, context.Logger())
+	if err != nil {
+		context.Fatal(err)
+	}
+	nemesis.Start()
+	// Stops the nemesis even if the workload fails the test, so it doesn't inject faults while the network is torn down
+	defer nemesis.StopAndHeal()
+	... run the workload ...
+	if err := nemesis.StopAndHeal(); err != nil {
+		context.Fatal(err)
+	}
+	... verify the final state, with all faults healed ...
+
+NOTE: While the nemesis runs, the test shouldn't partition, shape, pause, kill, restart, or remove services itself.
+ */
+type Nemesis struct {
+	network *ServiceNetwork
+
+	config NemesisConfig
+
+	seed int64
+
+	random *rand.Rand
+
+	// The logger that the timeline is written to
+	log *logrus.Logger
+
+	startTime time.Time
+
+	// Closed to tell the background goroutine to stop
+	stopChan chan struct{}
+
+	// Closed by the background goroutine once it's stopped
+	doneChan chan struct{}
+
+	// Makes sure the nemesis is only stopped once, however many times StopAndHeal is called
+	stopOnce *sync.Once
+
+	mutex *sync.Mutex
+
+	timeline []NemesisEvent
+
+	// The errors that occurred injecting or healing faults
+	faultErrs []error
+
+	// The fault currently injected, if any
+	activeFault *nemesisFault
+}
+
+/*
+Creates a new nemesis, which won't inject any faults until it's started.
+
+Args:
+	network: The network to inject faults into
+	config: What faults to inject, and how often
+	seed: The seed that determines the schedule of faults (0 to pick a random seed, which gets logged so the schedule can
+		be replayed)
+	log: The logger to write the timeline to (e.g. TestContext.Logger())
+
+Returns:
+	The nemesis, or an error if the config is invalid
+ */
+func NewNemesis(network *ServiceNetwork, config NemesisConfig, seed int64, log *logrus.Logger) (*Nemesis, error) {
+	if err := config.validate(); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid nemesis config")
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Nemesis{
+		network:  network,
+		config:   config,
+		seed:     seed,
+		random:   rand.New(rand.NewSource(seed)),
+		log:      log,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+		stopOnce: &sync.Once{},
+		mutex:    &sync.Mutex{},
+		timeline: []NemesisEvent{},
+	}, nil
+}
+
+// Gets the seed that determines the nemesis's schedule
+func (nemesis *Nemesis) GetSeed() int64 {
+	return nemesis.seed
+}
+
+/*
+Starts injecting faults in the background
+ */
+func (nemesis *Nemesis) Start() {
+	nemesis.startTime = time.Now()
+	nemesis.log.Infof("Starting nemesis with seed %v (create the nemesis with this seed to replay its schedule)", nemesis.seed)
+	go nemesis.run()
+}
+
+/*
+Stops injecting faults and heals the fault that's currently injected, if any, so that the test can verify the network's
+	final state. The whole timeline is logged once the nemesis has stopped. Calling this again once the nemesis has
+	stopped does nothing but return the same result, so it's safe to both defer it and call it explicitly.
+
+Returns:
+	An error if any fault couldn't be injected or healed
+ */
+func (nemesis *Nemesis) StopAndHeal() error {
+	if nemesis.startTime.IsZero() {
+		return stacktrace.NewError("The nemesis was never started")
+	}
+	nemesis.stopOnce.Do(nemesis.stop)
+
+	nemesis.mutex.Lock()
+	defer nemesis.mutex.Unlock()
+	if len(nemesis.faultErrs) > 0 {
+		errStrs := []string{}
+		for _, err := range nemesis.faultErrs {
+			errStrs = append(errStrs, err.Error())
+		}
+		return stacktrace.NewError(
+			"%v errors occurred injecting or healing faults with seed %v:\n%v",
+			len(nemesis.faultErrs),
+			nemesis.seed,
+			strings.Join(errStrs, "\n"))
+	}
+	return nil
+}
+
+func (nemesis *Nemesis) stop() {
+	close(nemesis.stopChan)
+	<-nemesis.doneChan
+
+	nemesis.mutex.Lock()
+	activeFault := nemesis.activeFault
+	nemesis.mutex.Unlock()
+	if activeFault != nil {
+		nemesis.heal(*activeFault)
+	}
+
+	timeline := nemesis.GetTimeline()
+	timelineLines := []string{}
+	for _, event := range timeline {
+		timelineLines = append(timelineLines, event.String())
+	}
+	nemesis.log.Infof(
+		"Nemesis with seed %v stopped; timeline:\n%v",
+		nemesis.seed,
+		strings.Join(timelineLines, "\n"))
+}
+
+/*
+Gets the events that have happened so far, in order
+ */
+func (nemesis *Nemesis) GetTimeline() []NemesisEvent {
+	nemesis.mutex.Lock()
+	defer nemesis.mutex.Unlock()
+	return append([]NemesisEvent{}, nemesis.timeline...)
+}
+
+func (nemesis *Nemesis) run() {
+	defer close(nemesis.doneChan)
+	for {
+		fault, canInject := nemesis.planNextFault()
+		if !canInject {
+			nemesis.recordEvent("No faults can be injected with the configured fault types and target services")
+			return
+		}
+		if !nemesis.sleep(fault.waitBefore) {
+			return
+		}
+
+		if err := nemesis.inject(fault); err != nil {
+			nemesis.recordFaultErr(stacktrace.Propagate(err, "An error occurred injecting fault %v", fault))
+			// Partitions and link conditions are applied service by service, so a failure can leave some of them applied
+			if fault.faultType == PARTITION_FAULT || fault.faultType == LATENCY_FAULT {
+				nemesis.heal(fault)
+			}
+			continue
+		}
+		if !nemesis.sleep(fault.duration) {
+			// StopAndHeal heals the active fault
+			return
+		}
+		nemesis.heal(fault)
+	}
+}
+
+/*
+Picks the next fault to inject using the nemesis's random source, such that the same seed and config always give the
+	same sequence of faults.
+
+Returns:
+	fault: The next fault
+	canInject: False if no fault can be injected with the config (e.g. a partition needs at least two services)
+ */
+func (nemesis *Nemesis) planNextFault() (fault nemesisFault, canInject bool) {
+	targetServiceIds := nemesis.getTargetServiceIds()
+	possibleFaultTypes := []NemesisFaultType{}
+	for _, faultType := range []NemesisFaultType{KILL_RESTART_FAULT, PARTITION_FAULT, PAUSE_FAULT, LATENCY_FAULT} {
+		if len(nemesis.config.FaultTypes) > 0 && !nemesis.config.FaultTypes[faultType] {
+			continue
+		}
+		minTargets := 1
+		if faultType == PARTITION_FAULT {
+			minTargets = 2
+		}
+		if len(targetServiceIds) >= minTargets {
+			possibleFaultTypes = append(possibleFaultTypes, faultType)
+		}
+	}
+	if len(possibleFaultTypes) == 0 {
+		return nemesisFault{}, false
+	}
+
+	fault = nemesisFault{
+		faultType:  possibleFaultTypes[nemesis.random.Intn(len(possibleFaultTypes))],
+		waitBefore: nemesis.randomDuration(nemesis.config.MinInterval, nemesis.config.MaxInterval),
+		duration:   nemesis.randomDuration(nemesis.config.MinFaultDuration, nemesis.config.MaxFaultDuration),
+	}
+	shuffledServiceIds := append([]ServiceID{}, targetServiceIds...)
+	nemesis.random.Shuffle(len(shuffledServiceIds), func(i, j int) {
+		shuffledServiceIds[i], shuffledServiceIds[j] = shuffledServiceIds[j], shuffledServiceIds[i]
+	})
+	if fault.faultType == PARTITION_FAULT {
+		// Partition off between 1 and all-but-one of the targets, so that both sides of the partition have services
+		groupSize := 1 + nemesis.random.Intn(len(shuffledServiceIds) - 1)
+		fault.serviceIds = shuffledServiceIds[:groupSize]
+	} else {
+		fault.serviceIds = shuffledServiceIds[:1]
+	}
+	return fault, true
+}
+
+// Gets the services faults can be injected into, sorted so that the schedule doesn't depend on map iteration order
+func (nemesis *Nemesis) getTargetServiceIds() []ServiceID {
+	if len(nemesis.config.TargetServiceIds) == 0 {
+		return nemesis.network.getServiceIds()
+	}
+	serviceIds := append([]ServiceID{}, nemesis.config.TargetServiceIds...)
+	sort.Slice(serviceIds, func(i, j int) bool {
+		return serviceIds[i] < serviceIds[j]
+	})
+	return serviceIds
+}
+
+func (nemesis *Nemesis) randomDuration(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(nemesis.random.Int63n(int64(max - min)))
+}
+
+/*
+Sleeps for the given duration, returning false if the nemesis was stopped in the meantime
+ */
+func (nemesis *Nemesis) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-nemesis.stopChan:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (nemesis *Nemesis) inject(fault nemesisFault) error {
+	var err error
+	switch fault.faultType {
+	case KILL_RESTART_FAULT:
+		err = nemesis.network.KillService(fault.serviceIds[0], nemesisKillSignal)
+	case PARTITION_FAULT:
+		err = nemesis.network.Partition(fault.serviceIds)
+	case PAUSE_FAULT:
+		err = nemesis.network.PauseService(fault.serviceIds[0])
+	case LATENCY_FAULT:
+		err = nemesis.network.SetServiceLinkConditions(fault.serviceIds[0], LinkConditions{
+			Delay:  nemesis.config.Latency,
+			Jitter: nemesis.config.Latency / 4,
+		})
+	default:
+		err = stacktrace.NewError("Unrecognized fault type %v", fault.faultType)
+	}
+	if err != nil {
+		return err
+	}
+
+	nemesis.mutex.Lock()
+	nemesis.activeFault = &fault
+	nemesis.mutex.Unlock()
+	nemesis.recordEvent(fmt.Sprintf("Injected %v for %v", fault, fault.duration.Round(time.Millisecond)))
+	return nil
+}
+
+func (nemesis *Nemesis) heal(fault nemesisFault) {
+	var err error
+	switch fault.faultType {
+	case KILL_RESTART_FAULT:
+		var availabilityChecker *services.ServiceAvailabilityChecker
+		availabilityChecker, err = nemesis.network.RestartService(fault.serviceIds[0], nemesisRestartStopTimeout)
+		if err == nil {
+			err = availabilityChecker.WaitForStartup()
+		}
+	case PARTITION_FAULT:
+		err = nemesis.network.Heal()
+	case PAUSE_FAULT:
+		err = nemesis.network.UnpauseService(fault.serviceIds[0])
+	case LATENCY_FAULT:
+		err = nemesis.network.ClearLinkConditions(fault.serviceIds[0])
+	}
+
+	nemesis.mutex.Lock()
+	nemesis.activeFault = nil
+	nemesis.mutex.Unlock()
+	if err != nil {
+		nemesis.recordFaultErr(stacktrace.Propagate(err, "An error occurred healing fault %v", fault))
+		return
+	}
+	nemesis.recordEvent(fmt.Sprintf("Healed %v", fault))
+}
+
+func (nemesis *Nemesis) recordEvent(description string) {
+	event := NemesisEvent{
+		Elapsed:     time.Since(nemesis.startTime),
+		Description: description,
+	}
+	nemesis.mutex.Lock()
+	nemesis.timeline = append(nemesis.timeline, event)
+	nemesis.mutex.Unlock()
+	nemesis.log.Infof("[nemesis] %v", event)
+}
+
+func (nemesis *Nemesis) recordFaultErr(err error) {
+	nemesis.mutex.Lock()
+	nemesis.faultErrs = append(nemesis.faultErrs, err)
+	nemesis.mutex.Unlock()
+	nemesis.recordEvent(fmt.Sprintf("ERROR: %v", err))
+}
@@ -0,0 +1,165 @@
+package networks
+
+import (
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func getValidNemesisConfig() NemesisConfig {
+	return NemesisConfig{
+		MinInterval:      time.Second,
+		MaxInterval:      10 * time.Second,
+		MinFaultDuration: time.Second,
+		MaxFaultDuration: 30 * time.Second,
+		Latency:          100 * time.Millisecond,
+	}
+}
+
+func getNemesisTestNetwork() *ServiceNetwork {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	for _, serviceId := range []ServiceID{"node1", "node2", "node3", "node4"} {
+		network.serviceNodes[serviceId] = ServiceNode{}
+	}
+	return network
+}
+
+func TestNemesisScheduleIsReproducibleFromSeed(t *testing.T) {
+	config := getValidNemesisConfig()
+	firstNemesis, err := NewNemesis(getNemesisTestNetwork(), config, 42, logrus.StandardLogger())
+	assert.NilError(t, err)
+	secondNemesis, err := NewNemesis(getNemesisTestNetwork(), config, 42, logrus.StandardLogger())
+	assert.NilError(t, err)
+	for i := 0; i < 20; i++ {
+		firstFault, canInject := firstNemesis.planNextFault()
+		assert.Assert(t, canInject)
+		secondFault, _ := secondNemesis.planNextFault()
+		assert.Equal(t, firstFault.String(), secondFault.String())
+		assert.Equal(t, firstFault.waitBefore, secondFault.waitBefore)
+		assert.Equal(t, firstFault.duration, secondFault.duration)
+		assert.Assert(t, firstFault.waitBefore >= config.MinInterval && firstFault.waitBefore < config.MaxInterval)
+
+		// A partition always leaves services on both sides
+		if firstFault.faultType == PARTITION_FAULT {
+			assert.Assert(t, len(firstFault.serviceIds) >= 1 && len(firstFault.serviceIds) <= 3)
+		}
+	}
+}
+
+func TestNemesisFaultTypeSelection(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	network.serviceNodes["node1"] = ServiceNode{}
+
+	// A single service can't be partitioned
+	config := getValidNemesisConfig()
+	config.FaultTypes = map[NemesisFaultType]bool{PARTITION_FAULT: true}
+	nemesis, err := NewNemesis(network, config, 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	_, canInject := nemesis.planNextFault()
+	assert.Assert(t, !canInject)
+
+	config.FaultTypes = map[NemesisFaultType]bool{PAUSE_FAULT: true}
+	nemesis, err = NewNemesis(network, config, 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	fault, canInject := nemesis.planNextFault()
+	assert.Assert(t, canInject)
+	assert.Equal(t, fault.String(), "pause [node1]")
+}
+
+func TestNemesisMustBeStarted(t *testing.T) {
+	nemesis, err := NewNemesis(getNemesisTestNetwork(), getValidNemesisConfig(), 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	assert.ErrorContains(t, nemesis.StopAndHeal(), "never started")
+}
+
+func TestNemesisCanBeStoppedTwice(t *testing.T) {
+	// The first fault is at least a second away, so none is injected into the fake services before the nemesis stops
+	nemesis, err := NewNemesis(getNemesisTestNetwork(), getValidNemesisConfig(), 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	nemesis.Start()
+	assert.NilError(t, nemesis.StopAndHeal())
+	assert.NilError(t, nemesis.StopAndHeal())
+	assert.Equal(t, len(nemesis.GetTimeline()), 0)
+}
+
+func TestNemesisConfigValidation(t *testing.T) {
+	network := getNemesisTestNetwork()
+	invalidConfigs := map[string]func(config *NemesisConfig){
+		"Minimum interval must be greater than 0": func(config *NemesisConfig) {
+			config.MinInterval = 0
+		},
+		"Maximum interval 1s is less than the minimum interval 2s": func(config *NemesisConfig) {
+			config.MinInterval = 2 * time.Second
+			config.MaxInterval = time.Second
+		},
+		"Minimum fault duration must be greater than 0": func(config *NemesisConfig) {
+			config.MinFaultDuration = 0
+		},
+		"Maximum fault duration 0s is less than the minimum": func(config *NemesisConfig) {
+			config.MaxFaultDuration = 0
+		},
+		"Latency must be greater than 0": func(config *NemesisConfig) {
+			config.Latency = 0
+		},
+	}
+	for expectedErr, invalidate := range invalidConfigs {
+		config := getValidNemesisConfig()
+		invalidate(&config)
+		_, err := NewNemesis(network, config, 1, logrus.StandardLogger())
+		assert.ErrorContains(t, err, expectedErr)
+	}
+
+	// Latency only matters if latency faults are injected
+	config := getValidNemesisConfig()
+	config.Latency = 0
+	config.FaultTypes = map[NemesisFaultType]bool{PAUSE_FAULT: true}
+	_, err := NewNemesis(network, config, 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	config.FaultTypes[LATENCY_FAULT] = true
+	_, err = NewNemesis(network, config, 1, logrus.StandardLogger())
+	assert.ErrorContains(t, err, "Latency must be greater than 0")
+}
+
+// Meant to be run with -race, to catch the nemesis and the test manipulating the network without synchronization
+func TestNemesisRunsAlongsideAddService(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	testVolumeDirpath, err := ioutil.TempDir("", "nemesis test")
+	assert.NilError(t, err)
+	defer os.RemoveAll(testVolumeDirpath)
+	freeIpTracker, err := NewFreeIpAddrTracker(logrus.StandardLogger(), "172.23.0.0/16", map[string]bool{})
+	assert.NilError(t, err)
+	builder := NewServiceNetworkBuilder(getFakeDockerManager(t, engine), testNetworkName, freeIpTracker, "test", testVolumeDirpath)
+	assert.NilError(t, builder.AddConfiguration(testConfiguration, "test", getTestInitializerCore(), getTestCheckerCore()))
+	network := builder.Build()
+
+	// The nemesis needs services to inject faults into from the start
+	for i := 0; i < 2; i++ {
+		_, err := network.AddService(testConfiguration, ServiceID(fmt.Sprintf("node%v", i)), map[ServiceID]bool{})
+		assert.NilError(t, err)
+	}
+	config := NemesisConfig{
+		MinInterval:      time.Millisecond,
+		MaxInterval:      2 * time.Millisecond,
+		MinFaultDuration: time.Millisecond,
+		MaxFaultDuration: 2 * time.Millisecond,
+		Latency:          100 * time.Millisecond,
+	}
+	nemesis, err := NewNemesis(network, config, 1, logrus.StandardLogger())
+	assert.NilError(t, err)
+	nemesis.Start()
+	for i := 2; i < 20; i++ {
+		serviceId := ServiceID(fmt.Sprintf("node%v", i))
+		_, err := network.AddService(testConfiguration, serviceId, map[ServiceID]bool{})
+		assert.NilError(t, err)
+		_, err = network.GetService(serviceId)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, nemesis.StopAndHeal())
+	assert.Equal(t, network.GetSize(), 20)
+}
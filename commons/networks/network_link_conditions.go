@@ -0,0 +1,344 @@
+package networks
+
+import (
+	"context"
+	"fmt"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// The HTB rate given to traffic classes that shouldn't be bandwidth-limited; bandwidth limits are applied by netem
+	unshapedHtbRate = "10gbit"
+
+	// The HTB class that traffic not going to a destination with its own conditions falls into
+	defaultHtbClassMinor = 1
+)
+
+/*
+Network conditions applied to traffic leaving a service, emulated with tc netem (e.g. to make a local network behave like
+	a WAN). The zero value applies no conditions.
+ */
+type LinkConditions struct {
+	// How long each packet is delayed by
+	Delay time.Duration
+
+	// How much the delay of each packet randomly varies by, in either direction (requires a Delay)
+	Jitter time.Duration
+
+	// Percentage of packets, in [0, 100], that are dropped
+	LossPercent float64
+
+	// Percentage of packets, in [0, 100], that are sent twice
+	DuplicatePercent float64
+
+	// Percentage of packets, in [0, 100], that have a random bit flipped
+	CorruptPercent float64
+
+	// Percentage of packets, in [0, 100], that are sent immediately rather than being delayed, so that they arrive out of
+	//  order (requires a Delay)
+	ReorderPercent float64
+
+	// The maximum rate traffic can be sent at, in bits per second (0 for no limit)
+	BandwidthBitsPerSecond uint64
+}
+
+func (conditions LinkConditions) isZero() bool {
+	return conditions == LinkConditions{}
+}
+
+func (conditions LinkConditions) validate() error {
+	percentages := map[string]float64{
+		"loss":      conditions.LossPercent,
+		"duplicate": conditions.DuplicatePercent,
+		"corrupt":   conditions.CorruptPercent,
+		"reorder":   conditions.ReorderPercent,
+	}
+	for name, percentage := range percentages {
+		if percentage < 0 || percentage > 100 {
+			return stacktrace.NewError("The %v percentage must be in [0, 100], but was %v", name, percentage)
+		}
+	}
+	if conditions.Delay < 0 || conditions.Jitter < 0 {
+		return stacktrace.NewError("The delay and jitter can't be negative")
+	}
+	if conditions.Delay == 0 && (conditions.Jitter > 0 || conditions.ReorderPercent > 0) {
+		return stacktrace.NewError("Jitter and reordering require a delay")
+	}
+	return nil
+}
+
+/*
+The conditions applied to the traffic leaving a single service
+ */
+type serviceLinkConditions struct {
+	// The conditions applied to traffic going to any destination without conditions of its own (zero for none)
+	allTraffic LinkConditions
+
+	// Mapping of destination service ID -> conditions applied to traffic going to that service, which replace (rather than
+	//  add to) the conditions on all traffic
+	perDestination map[ServiceID]LinkConditions
+}
+
+func (conditions serviceLinkConditions) isZero() bool {
+	return conditions.allTraffic.isZero() && len(conditions.perDestination) == 0
+}
+
+/*
+Applies the given network conditions to all the traffic the given service sends, replacing any conditions previously
+	set this way. Traffic going to services that have conditions of their own (see SetLinkConditions) is unaffected.
+	Pass the zero LinkConditions to clear the conditions.
+
+NOTE: Like partitions, conditions are applied by running tc in a sidecar container in the service's network namespace,
+	so the image set with ServiceNetworkBuilder.SetNetworkToolsImage must contain the iproute2 tools.
+ */
+func (network *ServiceNetwork) SetServiceLinkConditions(serviceId ServiceID, conditions LinkConditions) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if err := conditions.validate(); err != nil {
+		return stacktrace.Propagate(err, "Invalid link conditions for service %v", serviceId)
+	}
+	newConditions := network.copyServiceLinkConditions(serviceId)
+	newConditions.allTraffic = conditions
+	if err := network.applyServiceLinkConditions(serviceId, newConditions); err != nil {
+		return stacktrace.Propagate(err, "An error occurred setting the link conditions of service %v", serviceId)
+	}
+	return nil
+}
+
+/*
+Applies the given network conditions to the traffic that the first service sends to the second, replacing any conditions
+	previously set for this pair and any conditions set on all of the first service's traffic (for this destination
+	only). To affect traffic in both directions, call this for both orderings of the pair. Pass the zero LinkConditions
+	to clear the pair's conditions.
+ */
+func (network *ServiceNetwork) SetLinkConditions(fromServiceId ServiceID, toServiceId ServiceID, conditions LinkConditions) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if err := conditions.validate(); err != nil {
+		return stacktrace.Propagate(err, "Invalid link conditions for the link from service %v to service %v", fromServiceId, toServiceId)
+	}
+	if _, found := network.serviceNodes[toServiceId]; !found {
+		return stacktrace.NewError("Can't set link conditions to service %v because no service with this ID exists in the network", toServiceId)
+	}
+	if fromServiceId == toServiceId {
+		return stacktrace.NewError("Can't set link conditions from service %v to itself", fromServiceId)
+	}
+	newConditions := network.copyServiceLinkConditions(fromServiceId)
+	if conditions.isZero() {
+		delete(newConditions.perDestination, toServiceId)
+	} else {
+		newConditions.perDestination[toServiceId] = conditions
+	}
+	if err := network.applyServiceLinkConditions(fromServiceId, newConditions); err != nil {
+		return stacktrace.Propagate(
+			err,
+			"An error occurred setting the link conditions from service %v to service %v",
+			fromServiceId,
+			toServiceId)
+	}
+	return nil
+}
+
+/*
+Clears all the network conditions on the traffic that the given service sends, both to all destinations and to specific
+	services
+ */
+func (network *ServiceNetwork) ClearLinkConditions(serviceId ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.clearLinkConditions(serviceId)
+}
+
+func (network *ServiceNetwork) clearLinkConditions(serviceId ServiceID) error {
+	if err := network.applyServiceLinkConditions(serviceId, serviceLinkConditions{}); err != nil {
+		return stacktrace.Propagate(err, "An error occurred clearing the link conditions of service %v", serviceId)
+	}
+	return nil
+}
+
+/*
+Clears all the network conditions in the network, so that all services' traffic flows normally again
+ */
+func (network *ServiceNetwork) ClearAllLinkConditions() error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	serviceIds := []string{}
+	for serviceId, _ := range network.linkConditions {
+		serviceIds = append(serviceIds, string(serviceId))
+	}
+	sort.Strings(serviceIds)
+	for _, serviceId := range serviceIds {
+		if err := network.clearLinkConditions(ServiceID(serviceId)); err != nil {
+			return stacktrace.Propagate(err, "An error occurred clearing all the link conditions in the network")
+		}
+	}
+	return nil
+}
+
+/*
+Gets the network conditions currently applied to the traffic the given service sends.
+
+Returns:
+	allTraffic: The conditions applied to all the service's traffic (zero if none)
+	perDestination: Mapping of destination service ID -> the conditions applied to traffic going to that service
+ */
+func (network *ServiceNetwork) GetLinkConditions(serviceId ServiceID) (allTraffic LinkConditions, perDestination map[ServiceID]LinkConditions) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	conditions := network.copyServiceLinkConditions(serviceId)
+	return conditions.allTraffic, conditions.perDestination
+}
+
+func (network *ServiceNetwork) copyServiceLinkConditions(serviceId ServiceID) serviceLinkConditions {
+	result := serviceLinkConditions{
+		perDestination: map[ServiceID]LinkConditions{},
+	}
+	if existingConditions, found := network.linkConditions[serviceId]; found {
+		result.allTraffic = existingConditions.allTraffic
+		for destinationId, conditions := range existingConditions.perDestination {
+			result.perDestination[destinationId] = conditions
+		}
+	}
+	return result
+}
+
+/*
+Replaces the tc configuration of the given service's network interface with one applying the given conditions
+ */
+func (network *ServiceNetwork) applyServiceLinkConditions(serviceId ServiceID, conditions serviceLinkConditions) error {
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+
+	destinationIps := map[string]LinkConditions{}
+	for destinationId, destinationConditions := range conditions.perDestination {
+		destinationNode, found := network.serviceNodes[destinationId]
+		if !found {
+			// The destination has since been removed from the network, so there's no traffic to it to shape
+			continue
+		}
+		destinationIps[destinationNode.IpAddr.String()] = destinationConditions
+		// Traffic the service sends to the destination through a proxy goes to the proxy's IP
+		if proxy, found := network.linkProxies[serviceId][destinationId]; found {
+			destinationIps[proxy.ipAddr.String()] = destinationConditions
+		}
+	}
+
+	logrus.Debugf("Setting link conditions of service %v", serviceId)
+	err := network.dockerManager.RunInNetworkNamespace(
+		context.Background(),
+		node.ContainerId,
+		network.networkToolsImage,
+		[]string{"sh", "-c", getTcScript(node.IpAddr, conditions.allTraffic, destinationIps)})
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred running tc in the network namespace of service %v", serviceId)
+	}
+
+	if conditions.isZero() {
+		delete(network.linkConditions, serviceId)
+	} else {
+		network.linkConditions[serviceId] = &conditions
+	}
+	return nil
+}
+
+/*
+Builds a shell script that replaces the tc configuration of the network interface with the given IP. Traffic is split
+	into HTB classes - a default class, plus one per destination with conditions of its own (matched by destination IP) -
+	each with a netem qdisc applying the class's conditions.
+
+Args:
+	interfaceIp: The IP of the network interface to configure (the service's IP in the test network)
+	allTrafficConditions: The conditions applied to traffic that isn't going to any of the given destinations
+	destinationConditions: Mapping of destination IP -> conditions applied to traffic going to that IP
+ */
+func getTcScript(interfaceIp net.IP, allTrafficConditions LinkConditions, destinationConditions map[string]LinkConditions) string {
+	// Containers are attached to more than one network, so we find the interface by its IP rather than assuming eth0
+	commands := []string{
+		fmt.Sprintf(
+			"IFACE=$(ip -o -4 addr show | awk '$4 ~ /^%v\\// {print $2}' | cut -d@ -f1)",
+			strings.ReplaceAll(interfaceIp.String(), ".", "\\.")),
+		"[ -n \"$IFACE\" ]",
+		// Deleting the root qdisc fails if there's nothing to delete, which is fine
+		"(tc qdisc del dev $IFACE root 2>/dev/null || true)",
+	}
+	if allTrafficConditions.isZero() && len(destinationConditions) == 0 {
+		return strings.Join(commands, " && ")
+	}
+
+	commands = append(
+		commands,
+		fmt.Sprintf("tc qdisc add dev $IFACE root handle 1: htb default %v", defaultHtbClassMinor),
+		fmt.Sprintf("tc class add dev $IFACE parent 1: classid 1:%v htb rate %v", defaultHtbClassMinor, unshapedHtbRate))
+	if !allTrafficConditions.isZero() {
+		commands = append(commands, fmt.Sprintf(
+			"tc qdisc add dev $IFACE parent 1:%v handle %v: netem %v",
+			defaultHtbClassMinor,
+			defaultHtbClassMinor + 1,
+			strings.Join(getNetemArgs(allTrafficConditions), " ")))
+	}
+
+	// Sorted so that the same conditions always produce the same script
+	destinationIps := []string{}
+	for destinationIp, _ := range destinationConditions {
+		destinationIps = append(destinationIps, destinationIp)
+	}
+	sort.Strings(destinationIps)
+	for i, destinationIp := range destinationIps {
+		classMinor := defaultHtbClassMinor + 1 + i
+		// Qdisc handles just need to be unique, so we leave room below them for the default class's handle
+		qdiscHandle := 10 + i
+		commands = append(
+			commands,
+			fmt.Sprintf("tc class add dev $IFACE parent 1: classid 1:%v htb rate %v", classMinor, unshapedHtbRate),
+			fmt.Sprintf(
+				"tc qdisc add dev $IFACE parent 1:%v handle %v: netem %v",
+				classMinor,
+				qdiscHandle,
+				strings.Join(getNetemArgs(destinationConditions[destinationIp]), " ")),
+			fmt.Sprintf(
+				"tc filter add dev $IFACE protocol ip parent 1: prio 1 u32 match ip dst %v/32 flowid 1:%v",
+				destinationIp,
+				classMinor))
+	}
+	return strings.Join(commands, " && ")
+}
+
+/*
+Gets the arguments to tc netem that apply the given conditions
+ */
+func getNetemArgs(conditions LinkConditions) []string {
+	args := []string{}
+	if conditions.Delay > 0 {
+		args = append(args, "delay", fmt.Sprintf("%vus", conditions.Delay.Microseconds()))
+		if conditions.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%vus", conditions.Jitter.Microseconds()))
+		}
+	}
+	if conditions.LossPercent > 0 {
+		args = append(args, "loss", formatNetemPercent(conditions.LossPercent))
+	}
+	if conditions.DuplicatePercent > 0 {
+		args = append(args, "duplicate", formatNetemPercent(conditions.DuplicatePercent))
+	}
+	if conditions.CorruptPercent > 0 {
+		args = append(args, "corrupt", formatNetemPercent(conditions.CorruptPercent))
+	}
+	if conditions.ReorderPercent > 0 {
+		args = append(args, "reorder", formatNetemPercent(conditions.ReorderPercent))
+	}
+	if conditions.BandwidthBitsPerSecond > 0 {
+		args = append(args, "rate", fmt.Sprintf("%vbit", conditions.BandwidthBitsPerSecond))
+	}
+	return args
+}
+
+func formatNetemPercent(percent float64) string {
+	return fmt.Sprintf("%v%%", percent)
+}
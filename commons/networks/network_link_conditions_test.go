@@ -0,0 +1,51 @@
+package networks
+
+import (
+	"gotest.tools/v3/assert"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetemArgs(t *testing.T) {
+	conditions := LinkConditions{
+		Delay:                  100 * time.Millisecond,
+		Jitter:                 20 * time.Millisecond,
+		LossPercent:            1.5,
+		DuplicatePercent:       1,
+		CorruptPercent:         0.1,
+		ReorderPercent:         25,
+		BandwidthBitsPerSecond: 1000000,
+	}
+	assert.Equal(
+		t,
+		strings.Join(getNetemArgs(conditions), " "),
+		"delay 100000us 20000us loss 1.5% duplicate 1% corrupt 0.1% reorder 25% rate 1000000bit")
+}
+
+func TestInvalidLinkConditions(t *testing.T) {
+	assert.ErrorContains(t, LinkConditions{LossPercent: 101}.validate(), "loss")
+	assert.ErrorContains(t, LinkConditions{Jitter: time.Second}.validate(), "require a delay")
+	assert.ErrorContains(t, LinkConditions{ReorderPercent: 10}.validate(), "require a delay")
+	assert.NilError(t, LinkConditions{}.validate())
+}
+
+func TestTcScript(t *testing.T) {
+	serviceIp := net.ParseIP("172.23.0.5")
+
+	clearingScript := getTcScript(serviceIp, LinkConditions{}, map[string]LinkConditions{})
+	assert.Assert(t, strings.Contains(clearingScript, "tc qdisc del dev $IFACE root"))
+	assert.Assert(t, !strings.Contains(clearingScript, "netem"))
+
+	script := getTcScript(
+		serviceIp,
+		LinkConditions{Delay: time.Millisecond},
+		map[string]LinkConditions{
+			"172.23.0.7": {LossPercent: 10},
+		})
+	assert.Assert(t, strings.Contains(script, `/^172\.23\.0\.5\//`))
+	assert.Assert(t, strings.Contains(script, "tc qdisc add dev $IFACE parent 1:1 handle 2: netem delay 1000us"))
+	assert.Assert(t, strings.Contains(script, "tc qdisc add dev $IFACE parent 1:2 handle 10: netem loss 10%"))
+	assert.Assert(t, strings.Contains(script, "match ip dst 172.23.0.7/32 flowid 1:2"))
+}
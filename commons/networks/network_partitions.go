@@ -0,0 +1,350 @@
+package networks
+
+import (
+	"context"
+	"fmt"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+const (
+	// The iptables chain, in each service container, that holds the rules dropping traffic from partitioned-off services
+	partitionIptablesChain = "KURTOSIS-PARTITION"
+)
+
+/*
+Partitions the network into the given groups of services, such that services in different groups can't send each other
+	any traffic while services in the same group are unaffected. Services not listed in any group are put together in
+	one more group, so e.g. Partition([]ServiceID{"node1"}) isolates node1 from the rest of the network.
+
+This replaces the network's current topology, including any one-way partitions; call Heal to remove all partitions.
+	Services added to the network afterwards join the group of services not listed in any group, until the network is
+	healed or partitioned again.
+
+Args:
+	groups: The groups of service IDs to partition the network into, where each service may appear in at most one group
+ */
+func (network *ServiceNetwork) Partition(groups ...[]ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	allServiceIds := map[ServiceID]bool{}
+	for serviceId, _ := range network.serviceNodes {
+		allServiceIds[serviceId] = true
+	}
+	newInboundBlocks, err := getGroupPartitionInboundBlocks(allServiceIds, groups)
+	if err != nil {
+		return stacktrace.Propagate(err, "Invalid partition groups %v", groups)
+	}
+	if err := network.applyInboundBlocks(newInboundBlocks); err != nil {
+		return stacktrace.Propagate(err, "An error occurred partitioning the network into groups %v", groups)
+	}
+	network.partitionGroups = [][]ServiceID{}
+	for _, group := range groups {
+		network.partitionGroups = append(network.partitionGroups, append([]ServiceID{}, group...))
+	}
+	return nil
+}
+
+/*
+Computes the network's topology once the given newly-added service has joined the group of unlisted services of the
+	network's current partition, keeping any one-way partitions that were added on top of it.
+
+Returns:
+	Mapping of service ID -> "set" of service IDs whose traffic it must drop
+ */
+func (network *ServiceNetwork) getInboundBlocksWithNewService(newServiceId ServiceID) (map[ServiceID]map[ServiceID]bool, error) {
+	allServiceIds := map[ServiceID]bool{}
+	for serviceId, _ := range network.serviceNodes {
+		allServiceIds[serviceId] = true
+	}
+	groupInboundBlocks, err := getGroupPartitionInboundBlocks(allServiceIds, network.partitionGroups)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "The network's partition groups %v are invalid", network.partitionGroups)
+	}
+
+	result := network.copyInboundBlocks()
+	for toServiceId, blockedSources := range groupInboundBlocks {
+		for fromServiceId, _ := range blockedSources {
+			if toServiceId != newServiceId && fromServiceId != newServiceId {
+				continue
+			}
+			if _, found := result[toServiceId]; !found {
+				result[toServiceId] = map[ServiceID]bool{}
+			}
+			result[toServiceId][fromServiceId] = true
+		}
+	}
+	return result, nil
+}
+
+/*
+Computes the network's topology without the given service, which neither drops nor has dropped any traffic
+ */
+func (network *ServiceNetwork) getInboundBlocksWithoutService(removedServiceId ServiceID) map[ServiceID]map[ServiceID]bool {
+	result := network.copyInboundBlocks()
+	delete(result, removedServiceId)
+	for toServiceId, blockedSources := range result {
+		delete(blockedSources, removedServiceId)
+		if len(blockedSources) == 0 {
+			delete(result, toServiceId)
+		}
+	}
+	return result
+}
+
+/*
+Gets a copy of the given partition groups without the given service (nil if the groups are nil)
+ */
+func getPartitionGroupsWithoutService(groups [][]ServiceID, removedServiceId ServiceID) [][]ServiceID {
+	if groups == nil {
+		return nil
+	}
+	result := [][]ServiceID{}
+	for _, group := range groups {
+		groupCopy := []ServiceID{}
+		for _, serviceId := range group {
+			if serviceId != removedServiceId {
+				groupCopy = append(groupCopy, serviceId)
+			}
+		}
+		result = append(result, groupCopy)
+	}
+	return result
+}
+
+/*
+Computes which services must drop traffic from which other services to partition a network into the given groups.
+
+Args:
+	allServiceIds: The "set" of IDs of all the services in the network
+	groups: The groups to partition the network into, where services not in any group form one more group
+
+Returns:
+	Mapping of service ID -> "set" of service IDs whose traffic it must drop
+ */
+func getGroupPartitionInboundBlocks(allServiceIds map[ServiceID]bool, groups [][]ServiceID) (map[ServiceID]map[ServiceID]bool, error) {
+	groupIndices := map[ServiceID]int{}
+	for groupIndex, group := range groups {
+		for _, serviceId := range group {
+			if !allServiceIds[serviceId] {
+				return nil, stacktrace.NewError("Can't partition off service %v because no service with this ID exists in the network", serviceId)
+			}
+			if otherGroupIndex, found := groupIndices[serviceId]; found {
+				return nil, stacktrace.NewError(
+					"Service %v appears in partition groups %v and %v, but can only be in one group",
+					serviceId,
+					otherGroupIndex,
+					groupIndex)
+			}
+			groupIndices[serviceId] = groupIndex
+		}
+	}
+	unlistedServicesGroupIndex := len(groups)
+	for serviceId, _ := range allServiceIds {
+		if _, found := groupIndices[serviceId]; !found {
+			groupIndices[serviceId] = unlistedServicesGroupIndex
+		}
+	}
+
+	result := map[ServiceID]map[ServiceID]bool{}
+	for toServiceId, toGroupIndex := range groupIndices {
+		blockedSources := map[ServiceID]bool{}
+		for fromServiceId, fromGroupIndex := range groupIndices {
+			if fromGroupIndex != toGroupIndex {
+				blockedSources[fromServiceId] = true
+			}
+		}
+		if len(blockedSources) > 0 {
+			result[toServiceId] = blockedSources
+		}
+	}
+	return result, nil
+}
+
+/*
+Blocks traffic going from each of the given source services to each of the given destination services, while leaving
+	traffic in the other direction alone. The blocks are added on top of the network's current topology.
+
+NOTE: Because the packets are dropped as they arrive at the destinations, the destinations can't get replies back from
+	the sources either, so connection-oriented (e.g. TCP) traffic will fail in both directions while one-way (e.g. UDP)
+	traffic from the destinations to the sources will still flow.
+
+Args:
+	fromServiceIds: The IDs of the services whose traffic will be dropped
+	toServiceIds: The IDs of the services that will drop the traffic
+ */
+func (network *ServiceNetwork) PartitionOneWay(fromServiceIds []ServiceID, toServiceIds []ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	for _, serviceId := range append(append([]ServiceID{}, fromServiceIds...), toServiceIds...) {
+		if _, found := network.serviceNodes[serviceId]; !found {
+			return stacktrace.NewError("Can't partition off service %v because no service with this ID exists in the network", serviceId)
+		}
+	}
+
+	newInboundBlocks := network.copyInboundBlocks()
+	for _, toServiceId := range toServiceIds {
+		blockedSources, found := newInboundBlocks[toServiceId]
+		if !found {
+			blockedSources = map[ServiceID]bool{}
+			newInboundBlocks[toServiceId] = blockedSources
+		}
+		for _, fromServiceId := range fromServiceIds {
+			if fromServiceId != toServiceId {
+				blockedSources[fromServiceId] = true
+			}
+		}
+	}
+	if err := network.applyInboundBlocks(newInboundBlocks); err != nil {
+		return stacktrace.Propagate(err, "An error occurred blocking traffic from services %v to services %v", fromServiceIds, toServiceIds)
+	}
+	return nil
+}
+
+/*
+Removes all partitions, so that every service in the network can reach every other service again
+ */
+func (network *ServiceNetwork) Heal() error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if err := network.applyInboundBlocks(map[ServiceID]map[ServiceID]bool{}); err != nil {
+		return stacktrace.Propagate(err, "An error occurred healing the network's partitions")
+	}
+	network.partitionGroups = nil
+	return nil
+}
+
+/*
+Gets the network's current topology.
+
+Returns:
+	Mapping of source service ID -> "set" of the IDs of the services that drop the source's traffic; services whose traffic
+		isn't blocked anywhere aren't present
+ */
+func (network *ServiceNetwork) GetBlockedTraffic() map[ServiceID]map[ServiceID]bool {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	result := map[ServiceID]map[ServiceID]bool{}
+	for toServiceId, blockedSources := range network.inboundBlocks {
+		for fromServiceId, _ := range blockedSources {
+			if _, found := result[fromServiceId]; !found {
+				result[fromServiceId] = map[ServiceID]bool{}
+			}
+			result[fromServiceId][toServiceId] = true
+		}
+	}
+	return result
+}
+
+/*
+Returns true if traffic sent by the first service to the second is currently being dropped by a partition
+ */
+func (network *ServiceNetwork) IsTrafficBlocked(fromServiceId ServiceID, toServiceId ServiceID) bool {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.inboundBlocks[toServiceId][fromServiceId]
+}
+
+func (network *ServiceNetwork) copyInboundBlocks() map[ServiceID]map[ServiceID]bool {
+	result := map[ServiceID]map[ServiceID]bool{}
+	for toServiceId, blockedSources := range network.inboundBlocks {
+		blockedSourcesCopy := map[ServiceID]bool{}
+		for fromServiceId, _ := range blockedSources {
+			blockedSourcesCopy[fromServiceId] = true
+		}
+		result[toServiceId] = blockedSourcesCopy
+	}
+	return result
+}
+
+/*
+Rewrites the iptables rules of every service whose blocked sources differ between the current topology and the given
+	one. Services are updated one at a time, so if an error occurs the topology reflects the services that were updated.
+
+Args:
+	newInboundBlocks: Mapping of destination service ID -> "set" of source service IDs whose traffic it should drop
+ */
+func (network *ServiceNetwork) applyInboundBlocks(newInboundBlocks map[ServiceID]map[ServiceID]bool) error {
+	// Sorted so that which services have been updated when an error occurs is deterministic
+	serviceIds := make([]string, 0, len(network.serviceNodes))
+	for serviceId, _ := range network.serviceNodes {
+		serviceIds = append(serviceIds, string(serviceId))
+	}
+	sort.Strings(serviceIds)
+
+	for _, serviceIdStr := range serviceIds {
+		serviceId := ServiceID(serviceIdStr)
+		oldBlockedSources := network.inboundBlocks[serviceId]
+		newBlockedSources := newInboundBlocks[serviceId]
+		if areServiceIdSetsEqual(oldBlockedSources, newBlockedSources) {
+			continue
+		}
+		if err := network.setIptablesBlockedSources(serviceId, newBlockedSources); err != nil {
+			return stacktrace.Propagate(err, "An error occurred updating the traffic that service %v drops", serviceId)
+		}
+		if len(newBlockedSources) == 0 {
+			delete(network.inboundBlocks, serviceId)
+		} else {
+			network.inboundBlocks[serviceId] = newBlockedSources
+		}
+	}
+	return nil
+}
+
+/*
+Replaces the rules in the given service's partition chain with ones dropping all traffic from the given source services,
+	including the traffic they send through the fault-injecting proxies between them and the service
+ */
+func (network *ServiceNetwork) setIptablesBlockedSources(serviceId ServiceID, blockedSources map[ServiceID]bool) error {
+	node := network.serviceNodes[serviceId]
+
+	blockedSourceIps := []string{}
+	for sourceServiceId, _ := range blockedSources {
+		sourceNode, found := network.serviceNodes[sourceServiceId]
+		if !found {
+			// The source has since been removed from the network, so there's no traffic from it to block
+			continue
+		}
+		blockedSourceIps = append(blockedSourceIps, sourceNode.IpAddr.String())
+		// Traffic the source sends to the service through a proxy reaches the service from the proxy's IP
+		if proxy, found := network.linkProxies[sourceServiceId][serviceId]; found {
+			blockedSourceIps = append(blockedSourceIps, proxy.ipAddr.String())
+		}
+	}
+	sort.Strings(blockedSourceIps)
+
+	commands := []string{
+		// Creating the chain fails if it already exists, which is fine
+		fmt.Sprintf("(iptables -N %v 2>/dev/null || true)", partitionIptablesChain),
+		fmt.Sprintf("(iptables -C INPUT -j %v 2>/dev/null || iptables -I INPUT -j %v)", partitionIptablesChain, partitionIptablesChain),
+		fmt.Sprintf("iptables -F %v", partitionIptablesChain),
+	}
+	for _, sourceIp := range blockedSourceIps {
+		commands = append(commands, fmt.Sprintf("iptables -A %v -s %v -j DROP", partitionIptablesChain, sourceIp))
+	}
+
+	logrus.Debugf("Setting service %v to drop traffic from IPs %v", serviceId, blockedSourceIps)
+	err := network.dockerManager.RunInNetworkNamespace(
+		context.Background(),
+		node.ContainerId,
+		network.networkToolsImage,
+		[]string{"sh", "-c", strings.Join(commands, " && ")})
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred setting the iptables rules of service %v", serviceId)
+	}
+	return nil
+}
+
+func areServiceIdSetsEqual(first map[ServiceID]bool, second map[ServiceID]bool) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for serviceId, _ := range first {
+		if !second[serviceId] {
+			return false
+		}
+	}
+	return true
+}
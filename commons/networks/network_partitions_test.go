@@ -0,0 +1,91 @@
+package networks
+
+import (
+	"gotest.tools/v3/assert"
+	"testing"
+)
+
+func TestGroupPartitionInboundBlocks(t *testing.T) {
+	allServiceIds := map[ServiceID]bool{"node1": true, "node2": true, "node3": true, "node4": true}
+	inboundBlocks, err := getGroupPartitionInboundBlocks(allServiceIds, [][]ServiceID{{"node1", "node2"}, {"node3"}})
+	assert.NilError(t, err)
+
+	// node4 isn't listed, so it's put in a group of its own
+	assert.DeepEqual(t, inboundBlocks, map[ServiceID]map[ServiceID]bool{
+		"node1": {"node3": true, "node4": true},
+		"node2": {"node3": true, "node4": true},
+		"node3": {"node1": true, "node2": true, "node4": true},
+		"node4": {"node1": true, "node2": true, "node3": true},
+	})
+}
+
+func TestSingleGroupPartitionBlocksNothing(t *testing.T) {
+	allServiceIds := map[ServiceID]bool{"node1": true, "node2": true}
+	inboundBlocks, err := getGroupPartitionInboundBlocks(allServiceIds, [][]ServiceID{{"node1", "node2"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(inboundBlocks), 0)
+}
+
+func TestInvalidPartitionGroups(t *testing.T) {
+	allServiceIds := map[ServiceID]bool{"node1": true, "node2": true}
+	_, err := getGroupPartitionInboundBlocks(allServiceIds, [][]ServiceID{{"node1"}, {"node1", "node2"}})
+	assert.ErrorContains(t, err, "can only be in one group")
+	_, err = getGroupPartitionInboundBlocks(allServiceIds, [][]ServiceID{{"node3"}})
+	assert.ErrorContains(t, err, "no service with this ID")
+}
+
+func TestBlockedTrafficTopology(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	network.inboundBlocks = map[ServiceID]map[ServiceID]bool{
+		"node2": {"node1": true},
+		"node3": {"node1": true},
+	}
+	assert.Assert(t, network.IsTrafficBlocked("node1", "node2"))
+	assert.Assert(t, !network.IsTrafficBlocked("node2", "node1"))
+	assert.DeepEqual(t, network.GetBlockedTraffic(), map[ServiceID]map[ServiceID]bool{
+		"node1": {"node2": true, "node3": true},
+	})
+}
+
+func TestServicesAddedAfterPartitionJoinUnlistedGroup(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	network.serviceNodes = map[ServiceID]ServiceNode{"node1": {}, "node2": {}, "node3": {}}
+	network.partitionGroups = [][]ServiceID{{"node1"}}
+	network.inboundBlocks = map[ServiceID]map[ServiceID]bool{
+		"node1": {"node2": true, "node3": true},
+		"node2": {"node1": true},
+		// A one-way partition on top of the group partition
+		"node3": {"node1": true, "node2": true},
+	}
+
+	network.serviceNodes["node4"] = ServiceNode{}
+	inboundBlocks, err := network.getInboundBlocksWithNewService("node4")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, inboundBlocks, map[ServiceID]map[ServiceID]bool{
+		"node1": {"node2": true, "node3": true, "node4": true},
+		"node2": {"node1": true},
+		"node3": {"node1": true, "node2": true},
+		"node4": {"node1": true},
+	})
+}
+
+func TestRemovedServicesLeaveTopology(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	network.inboundBlocks = map[ServiceID]map[ServiceID]bool{
+		"node1": {"node2": true, "node3": true},
+		"node2": {"node1": true},
+		"node3": {"node1": true},
+	}
+	assert.DeepEqual(t, network.getInboundBlocksWithoutService("node1"), map[ServiceID]map[ServiceID]bool{})
+	assert.DeepEqual(t, network.getInboundBlocksWithoutService("node2"), map[ServiceID]map[ServiceID]bool{
+		"node1": {"node3": true},
+		"node3": {"node1": true},
+	})
+	// The network's own topology is only changed once the new rules are applied
+	assert.Equal(t, len(network.inboundBlocks), 3)
+
+	groups := [][]ServiceID{{"node1", "node2"}, {"node3"}}
+	assert.DeepEqual(t, getPartitionGroupsWithoutService(groups, "node2"), [][]ServiceID{{"node1"}, {"node3"}})
+	assert.DeepEqual(t, groups, [][]ServiceID{{"node1", "node2"}, {"node3"}})
+	assert.Assert(t, getPartitionGroupsWithoutService(nil, "node2") == nil)
+}
@@ -0,0 +1,56 @@
+package networks
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+/*
+Gets and logs the addresses on the Docker host that the given service's ports are published to, if the network publishes
+	ports. Because published ports are only a debugging aid, failing to get them is logged rather than failing the test.
+
+Returns:
+	Mapping of port the service listens on -> address on the Docker host it's published to (empty if the network doesn't
+		publish ports or they couldn't be gotten)
+ */
+func (network *ServiceNetwork) getServiceHostPorts(serviceId ServiceID, containerId string) map[nat.Port]string {
+	if !network.publishPorts {
+		return map[nat.Port]string{}
+	}
+	hostPorts, err := network.dockerManager.GetPublishedPorts(context.Background(), containerId)
+	if err != nil {
+		logrus.Warnf("An error occurred getting the host ports that service %v's ports are published to: %v", serviceId, err)
+		return map[nat.Port]string{}
+	}
+	logrus.Infof("Service %v's ports are published on the Docker host at: %v", serviceId, formatHostPorts(hostPorts))
+	return hostPorts
+}
+
+/*
+Formats a mapping of port -> host address for logging, e.g. "80/tcp -> 0.0.0.0:32768, 443/tcp -> 0.0.0.0:32769"
+ */
+func formatHostPorts(hostPorts map[nat.Port]string) string {
+	if len(hostPorts) == 0 {
+		return "<none>"
+	}
+	ports := make([]nat.Port, 0, len(hostPorts))
+	for port, _ := range hostPorts {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Int() != ports[j].Int() {
+			return ports[i].Int() < ports[j].Int()
+		}
+		return ports[i].Proto() < ports[j].Proto()
+	})
+
+	mappings := make([]string, 0, len(ports))
+	for _, port := range ports {
+		mappings = append(mappings, fmt.Sprintf("%v -> %v", port, hostPorts[port]))
+	}
+	return strings.Join(mappings, ", ")
+}
@@ -0,0 +1,30 @@
+package networks
+
+import (
+	"github.com/docker/go-connections/nat"
+	"gotest.tools/v3/assert"
+	"testing"
+)
+
+func TestFormatHostPorts(t *testing.T) {
+	assert.Equal(t, formatHostPorts(map[nat.Port]string{}), "<none>")
+	hostPorts := map[nat.Port]string{
+		"8080/tcp": "0.0.0.0:32770",
+		"443/udp":  "0.0.0.0:32769",
+		"443/tcp":  "0.0.0.0:32768",
+	}
+	assert.Equal(
+		t,
+		formatHostPorts(hostPorts),
+		"443/tcp -> 0.0.0.0:32768, 443/udp -> 0.0.0.0:32769, 8080/tcp -> 0.0.0.0:32770")
+}
+
+func TestHostPortsWhenNotPublishing(t *testing.T) {
+	// Without publishing, no Docker calls are made and the node gets an empty mapping
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	assert.Equal(t, len(network.getServiceHostPorts(testServiceName, "container-id")), 0)
+
+	builder := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar")
+	builder.SetPublishPorts(true)
+	assert.Assert(t, builder.Build().publishPorts)
+}
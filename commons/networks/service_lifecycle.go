@@ -0,0 +1,142 @@
+package networks
+
+import (
+	"context"
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
+	"github.com/kurtosis-tech/kurtosis/commons/services"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+/*
+Freezes all the processes of the given service (via `docker pause`), e.g. to simulate a long GC pause or a hung process.
+	The service stays in the network, and its connections stay open but go unanswered until UnpauseService is called.
+ */
+func (network *ServiceNetwork) PauseService(serviceId ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	logrus.Debugf("Pausing service %v...", serviceId)
+	if err := network.dockerManager.PauseContainer(context.Background(), node.ContainerId); err != nil {
+		return stacktrace.Propagate(err, "An error occurred pausing service %v", serviceId)
+	}
+	return nil
+}
+
+/*
+Resumes the processes of a service that was paused with PauseService
+ */
+func (network *ServiceNetwork) UnpauseService(serviceId ServiceID) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	logrus.Debugf("Unpausing service %v...", serviceId)
+	if err := network.dockerManager.UnpauseContainer(context.Background(), node.ContainerId); err != nil {
+		return stacktrace.Propagate(err, "An error occurred unpausing service %v", serviceId)
+	}
+	return nil
+}
+
+/*
+Sends the given signal to the given service's main process (via `docker kill`), e.g. "SIGKILL" to simulate a crash.
+	Unlike RemoveService, the service stays in the network, so it can be brought back with RestartService.
+
+Args:
+	serviceId: The ID of the service to send the signal to
+	signal: The signal to send (e.g. "SIGKILL", "SIGTERM", "SIGHUP")
+ */
+func (network *ServiceNetwork) KillService(serviceId ServiceID, signal string) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	logrus.Debugf("Sending signal %v to service %v...", signal, serviceId)
+	if err := network.dockerManager.KillContainer(context.Background(), node.ContainerId, signal); err != nil {
+		return stacktrace.Propagate(err, "An error occurred sending signal %v to service %v", signal, serviceId)
+	}
+	return nil
+}
+
+/*
+Restarts the given service in the same container (stopping it first if it's running), so that it comes back with the
+	same IP and the same mounted files, e.g. to test recovery after a crash caused with KillService. Any partitions and
+	link conditions the service is part of are reapplied, since they don't survive the restart on their own.
+
+Args:
+	serviceId: The ID of the service to restart
+	containerStopTimeout: How long to wait for a running service to stop before forcefully terminating it
+
+Returns:
+	An AvailabilityChecker for checking when the restarted service is available again
+ */
+func (network *ServiceNetwork) RestartService(serviceId ServiceID, containerStopTimeout time.Duration) (*services.ServiceAvailabilityChecker, error) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	parentCtx := context.Background()
+
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return nil, stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	logrus.Debugf("Restarting service %v...", serviceId)
+	if err := network.dockerManager.RestartContainer(parentCtx, node.ContainerId, containerStopTimeout); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred restarting service %v", serviceId)
+	}
+
+	// The restarted container gets a fresh network namespace, without the iptables rules and tc qdiscs we'd set up
+	if blockedSources, found := network.inboundBlocks[serviceId]; found {
+		if err := network.setIptablesBlockedSources(serviceId, blockedSources); err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred reapplying the partitions of restarted service %v", serviceId)
+		}
+	}
+	if conditions, found := network.linkConditions[serviceId]; found {
+		if err := network.applyServiceLinkConditions(serviceId, *conditions); err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred reapplying the link conditions of restarted service %v", serviceId)
+		}
+	}
+
+	// The restarted container's ports may have been published to different host ports
+	node.HostPorts = network.getServiceHostPorts(serviceId, node.ContainerId)
+	network.serviceNodes[serviceId] = node
+
+	config := network.configurations[node.configurationId]
+	availabilityChecker := services.NewServiceAvailabilityChecker(parentCtx, config.availabilityCheckerCore, node.Service, node.dependencies)
+	return availabilityChecker, nil
+}
+
+/*
+Changes the CPU and memory limits of the given running service, e.g. to starve it of CPU partway through a test. Limits
+	that are 0 in the given limits are left as they are; because of this, a limit can be loosened but not removed.
+
+NOTE: Docker rejects a memory limit above the container's current memory plus swap limit, so raising a memory limit
+	usually needs MemorySwapBytes raised along with it.
+
+Args:
+	serviceId: The ID of the service whose limits to change
+	limits: The new limits of the service's container
+ */
+func (network *ServiceNetwork) UpdateServiceResourceLimits(serviceId ServiceID, limits docker.ContainerResourceLimits) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	node, found := network.serviceNodes[serviceId]
+	if !found {
+		return stacktrace.NewError("No service with ID %v exists in the network", serviceId)
+	}
+	if err := validateResourceLimits(limits); err != nil {
+		return stacktrace.Propagate(err, "Invalid resource limits for service %v", serviceId)
+	}
+	logrus.Debugf("Updating the resource limits of service %v to %+v...", serviceId, limits)
+	if err := network.dockerManager.UpdateContainerResources(context.Background(), node.ContainerId, limits); err != nil {
+		return stacktrace.Propagate(err, "An error occurred updating the resource limits of service %v", serviceId)
+	}
+	return nil
+}
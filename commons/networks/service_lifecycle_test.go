@@ -0,0 +1,67 @@
+package networks
+
+import (
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"gotest.tools/v3/assert"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycleOfNonexistentServices(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	assert.ErrorContains(t, network.PauseService(testServiceName), "No service")
+	assert.ErrorContains(t, network.UnpauseService(testServiceName), "No service")
+	assert.ErrorContains(t, network.KillService(testServiceName, "SIGKILL"), "No service")
+	_, err := network.RestartService(testServiceName, time.Second)
+	assert.ErrorContains(t, err, "No service")
+	assert.ErrorContains(t, network.UpdateServiceResourceLimits(testServiceName, docker.ContainerResourceLimits{CpuLimit: 1}), "No service")
+}
+
+func TestUpdateServiceResourceLimitsValidation(t *testing.T) {
+	network := NewServiceNetworkBuilder(nil, testNetworkName, nil, "test", "/foo/bar").Build()
+	network.serviceNodes[testServiceName] = ServiceNode{}
+	err := network.UpdateServiceResourceLimits(testServiceName, docker.ContainerResourceLimits{CpuLimit: -0.5})
+	assert.ErrorContains(t, err, "Invalid resource limits")
+}
+
+func TestRestartServiceReappliesNetworkFaults(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	network := NewServiceNetworkBuilder(getFakeDockerManager(t, engine), testNetworkName, nil, "test", "/foo/bar").Build()
+	node1Ip := net.ParseIP("172.23.0.2")
+	node2Ip := net.ParseIP("172.23.0.3")
+	network.serviceNodes["node1"] = ServiceNode{IpAddr: node1Ip, ContainerId: "node1-container"}
+	network.serviceNodes["node2"] = ServiceNode{IpAddr: node2Ip, ContainerId: "node2-container"}
+	network.inboundBlocks["node1"] = map[ServiceID]bool{"node2": true}
+	network.linkConditions["node1"] = &serviceLinkConditions{
+		allTraffic:     LinkConditions{Delay: 100 * time.Millisecond},
+		perDestination: map[ServiceID]LinkConditions{},
+	}
+
+	_, err := network.RestartService("node1", time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, engine.GetRequests()[0], "POST /containers/node1-container/restart")
+
+	// The restarted container's fresh network namespace gets the service's partition and link conditions back
+	sidecarCommands := getSidecarCommands(engine)
+	assert.Equal(t, len(sidecarCommands), 2)
+	assert.Equal(t, sidecarCommands[0].containerId, "node1-container")
+	assert.Assert(t, strings.Contains(sidecarCommands[0].script, fmt.Sprintf("iptables -A %v -s %v -j DROP", partitionIptablesChain, node2Ip)))
+	assert.Equal(t, sidecarCommands[1].containerId, "node1-container")
+	assert.Equal(t, sidecarCommands[1].script, getTcScript(node1Ip, LinkConditions{Delay: 100 * time.Millisecond}, map[string]LinkConditions{}))
+}
+
+func TestRestartServiceWithoutNetworkFaults(t *testing.T) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	network := NewServiceNetworkBuilder(getFakeDockerManager(t, engine), testNetworkName, nil, "test", "/foo/bar").Build()
+	network.serviceNodes["node1"] = ServiceNode{IpAddr: net.ParseIP("172.23.0.2"), ContainerId: "node1-container"}
+
+	_, err := network.RestartService("node1", time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, len(getSidecarCommands(engine)), 0)
+}
@@ -3,11 +3,14 @@ package networks
 import (
 	"context"
 	"fmt"
+	"github.com/docker/go-connections/nat"
 	"github.com/kurtosis-tech/kurtosis/commons/docker"
 	"github.com/kurtosis-tech/kurtosis/commons/services"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
 	"net"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -29,6 +32,16 @@ type ServiceNode struct {
 
 	// The Docker container ID of the container running the node
 	ContainerId string
+
+	// Mapping of port the node listens on -> address on the Docker host (e.g. "0.0.0.0:32768") that the port is published
+	//  to, which is empty unless the network publishes ports (see ServiceNetworkBuilder.SetPublishPorts)
+	HostPorts map[nat.Port]string
+
+	// The ID of the configuration the node was created from
+	configurationId ConfigurationID
+
+	// The dependencies the node was created with, as the node sees them
+	dependencies []services.Service
 }
 
 /*
@@ -44,12 +57,16 @@ type serviceConfig struct {
 
 	// The implementation that will be used for determining whether a node launched using this configuration is available
 	availabilityCheckerCore services.ServiceAvailabilityCheckerCore
+
+	// The optional settings of the containers launched using this configuration
+	options ServiceConfigurationOptions
 }
 
 
 /*
 A struct representing a network of services that will be used for a single test (commonly called the "test network"). This
-	struct is the low-level access point for modifying the test network.
+	struct is the low-level access point for modifying the test network, and is safe to use from multiple goroutines
+	(e.g. the test's and a Nemesis's).
  */
 type ServiceNetwork struct {
 	// The tracker used for doling out new IPs within the subnet being used for this particular test network
@@ -74,6 +91,43 @@ type ServiceNetwork struct {
 
 	// The dirpath where the test volume is mounted on the controller (which is where this code will be running in)
 	testVolumeControllerDirpath string
+
+	// The Docker image of the sidecar containers used to manipulate services' networking (e.g. for partitions), which
+	//  must contain iptables and the iproute2 tools
+	networkToolsImage string
+
+	// The network's current partitions, as a mapping of service ID -> "set" of service IDs whose traffic it drops
+	inboundBlocks map[ServiceID]map[ServiceID]bool
+
+	// The groups that the network was last partitioned into with Partition, which services added afterwards join as
+	//  members of the group of unlisted services (nil if the network isn't partitioned into groups)
+	partitionGroups [][]ServiceID
+
+	// Mapping of service ID -> the network conditions applied to the traffic the service sends
+	linkConditions map[ServiceID]*serviceLinkConditions
+
+	// The Docker image of the fault-injecting proxies placed between services and their dependencies (empty if services
+	//  are connected to their dependencies directly)
+	faultInjectingProxyImage string
+
+	// Mapping of service ID -> dependency service ID -> the proxy between them
+	linkProxies map[ServiceID]map[ServiceID]*linkProxy
+
+	// Mapping of libfaketime library filepath on the controller -> filename of its copy in the test volume's clock skew directory
+	fakeTimeLibraryFilenames map[string]string
+
+	// Mapping of service ID -> filepath, on the controller, of the file libfaketime reads the service's faked time from
+	//  (only present for services whose configuration enables clock skew)
+	fakeTimeFilepaths map[ServiceID]string
+
+	// Mapping of service ID -> the skew currently applied to the service's clock (services with no skew aren't present)
+	clockSkews map[ServiceID]ClockSkew
+
+	// Whether the ports services listen on are published to ephemeral ports on the Docker host
+	publishPorts bool
+
+	// Guards all of the above, since the network can be manipulated from the test and from a Nemesis at the same time
+	mutex *sync.Mutex
 }
 
 /*
@@ -87,6 +141,11 @@ Args:
 	testVolume: The name of the Docker volume that will be mounted on all the nodes in the network.
 	testVolumeControllerDirpath: The dirpath that the test Docker volume is mounted on in the controller image (which will
 		be running all the code here).
+	networkToolsImage: The Docker image of the sidecar containers used to manipulate services' networking, which must
+		contain iptables and the iproute2 tools (ip and tc).
+	faultInjectingProxyImage: The Docker image of the Toxiproxy proxies to put between each service and each of its
+		dependencies (empty to connect services to their dependencies directly).
+	publishPorts: Whether to publish the ports services listen on to ephemeral ports on the Docker host.
  */
 func NewServiceNetwork(
 			freeIpTracker *FreeIpAddrTracker,
@@ -94,7 +153,10 @@ func NewServiceNetwork(
 			dockerNetworkId string,
 			configurations map[ConfigurationID]serviceConfig,
 			testVolume string,
-			testVolumeControllerDirpath string) *ServiceNetwork {
+			testVolumeControllerDirpath string,
+			networkToolsImage string,
+			faultInjectingProxyImage string,
+			publishPorts bool) *ServiceNetwork {
 	return &ServiceNetwork{
 		freeIpTracker:               freeIpTracker,
 		dockerManager:               dockerManager,
@@ -103,11 +165,23 @@ func NewServiceNetwork(
 		configurations:              configurations,
 		testVolume:                  testVolume,
 		testVolumeControllerDirpath: testVolumeControllerDirpath,
+		networkToolsImage:           networkToolsImage,
+		inboundBlocks:               make(map[ServiceID]map[ServiceID]bool),
+		linkConditions:              make(map[ServiceID]*serviceLinkConditions),
+		faultInjectingProxyImage:    faultInjectingProxyImage,
+		linkProxies:                 make(map[ServiceID]map[ServiceID]*linkProxy),
+		fakeTimeLibraryFilenames:    make(map[string]string),
+		fakeTimeFilepaths:           make(map[ServiceID]string),
+		clockSkews:                  make(map[ServiceID]ClockSkew),
+		publishPorts:                publishPorts,
+		mutex:                       &sync.Mutex{},
 	}
 }
 
 // Gets the number of nodes in the network
 func (network *ServiceNetwork) GetSize() int {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
 	return len(network.serviceNodes)
 }
 
@@ -125,6 +199,9 @@ Return:
 	An AvailabilityChecker for checking when the new service is available and ready for use.
  */
 func (network *ServiceNetwork) AddService(configurationId ConfigurationID, serviceId ServiceID, dependencies map[ServiceID]bool) (*services.ServiceAvailabilityChecker, error) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
 	// Maybe one day we'll make this flow from somewhere up above (e.g. make the entire network live inside a single context)
 	parentCtx := context.Background()
 
@@ -152,11 +229,39 @@ func (network *ServiceNetwork) AddService(configurationId ConfigurationID, servi
 		dependencyServices = append(dependencyServices, dependencyNode.Service)
 	}
 
+	// With fault-injecting proxies, the service is told that its dependencies are at the IPs of their proxies
+	if network.faultInjectingProxyImage != "" {
+		proxiedDependencyServices, err := network.createLinkProxies(parentCtx, serviceId, dependencies)
+		if err != nil {
+			network.removeLinkProxies(serviceId, proxyStopTimeout)
+			return nil, stacktrace.Propagate(err, "An error occurred creating the proxies between service %v and its dependencies", serviceId)
+		}
+		dependencyServices = proxiedDependencyServices
+	}
+
 	staticIp, err := network.freeIpTracker.GetFreeIpAddr()
 	if err != nil {
+		network.removeLinkProxies(serviceId, proxyStopTimeout)
 		return nil, stacktrace.Propagate(err, "Failed to allocate static IP for service %s", serviceId)
 	}
 
+	envVariables := map[string]string{}
+	fakeTimeFilepath := ""
+	if config.options.FakeTimeLibraryFilepath != "" {
+		fakeTimeEnvVariables, timeFilepath, err := network.createFakeTimeFiles(config)
+		if err != nil {
+			network.removeLinkProxies(serviceId, proxyStopTimeout)
+			return nil, stacktrace.Propagate(err, "An error occurred setting up clock skew for service %v", serviceId)
+		}
+		for key, value := range fakeTimeEnvVariables {
+			envVariables[key] = value
+		}
+		fakeTimeFilepath = timeFilepath
+	}
+
+	hostOptions := config.options.getContainerHostOptions()
+	hostOptions.PublishPorts = network.publishPorts
+
 	initializer := services.NewServiceInitializer(config.initializerCore, network.dockerNetworkId, network.testVolumeControllerDirpath)
 	service, containerId, err := initializer.CreateService(
 			parentCtx,
@@ -164,15 +269,36 @@ func (network *ServiceNetwork) AddService(configurationId ConfigurationID, servi
 			config.dockerImage,
 			staticIp,
 			network.dockerManager,
-			dependencyServices)
+			dependencyServices,
+			envVariables,
+			hostOptions)
 	if err != nil {
+		network.removeLinkProxies(serviceId, proxyStopTimeout)
 		return nil, stacktrace.Propagate(err, "An error occurred creating service %v from configuration %v", serviceId, configurationId)
 	}
+	if fakeTimeFilepath != "" {
+		network.fakeTimeFilepaths[serviceId] = fakeTimeFilepath
+	}
 
 	network.serviceNodes[serviceId] = ServiceNode{
-		IpAddr:      staticIp,
-		Service:     service,
-		ContainerId: containerId,
+		IpAddr:          staticIp,
+		Service:         service,
+		ContainerId:     containerId,
+		HostPorts:       network.getServiceHostPorts(serviceId, containerId),
+		configurationId: configurationId,
+		dependencies:    dependencyServices,
+	}
+
+	// If the network is partitioned, the new service must be cut off from the groups it isn't part of too (it's left in
+	//  the network if this fails, so that it still gets torn down)
+	if network.partitionGroups != nil {
+		newInboundBlocks, err := network.getInboundBlocksWithNewService(serviceId)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred determining which partition service %v belongs to", serviceId)
+		}
+		if err := network.applyInboundBlocks(newInboundBlocks); err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred placing service %v into the network's current partition", serviceId)
+		}
 	}
 
 	availabilityChecker := services.NewServiceAvailabilityChecker(parentCtx, config.availabilityCheckerCore, service, dependencyServices)
@@ -183,6 +309,9 @@ func (network *ServiceNetwork) AddService(configurationId ConfigurationID, servi
 Gets the node information for the service with the given service ID.
  */
 func (network *ServiceNetwork) GetService(serviceId ServiceID) (ServiceNode, error) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
 	node, found := network.serviceNodes[serviceId]
 	if !found {
 		return ServiceNode{}, stacktrace.NewError("No service with ID %v exists in the network", serviceId)
@@ -195,6 +324,12 @@ func (network *ServiceNetwork) GetService(serviceId ServiceID) (ServiceNode, err
 Stops the container with the given service ID, and removes it from the network.
  */
 func (network *ServiceNetwork) RemoveService(serviceId ServiceID, containerStopTimeout time.Duration) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.removeService(serviceId, containerStopTimeout)
+}
+
+func (network *ServiceNetwork) removeService(serviceId ServiceID, containerStopTimeout time.Duration) error {
 	// Maybe one day we'll store this on the ServiceNetwork itself, to represent the test context that the ServiceNetwork
 	//  was created in
 	parentCtx := context.Background()
@@ -205,7 +340,25 @@ func (network *ServiceNetwork) RemoveService(serviceId ServiceID, containerStopT
 	}
 
 	logrus.Debugf("Removing service ID %v...", serviceId)
+	newInboundBlocks := network.getInboundBlocksWithoutService(serviceId)
 	delete(network.serviceNodes, serviceId)
+	delete(network.inboundBlocks, serviceId)
+	network.partitionGroups = getPartitionGroupsWithoutService(network.partitionGroups, serviceId)
+	// The other services' rules dropping the removed service's traffic are cleared, so that a service that's later given
+	//  its IP doesn't inherit its partitions
+	if err := network.applyInboundBlocks(newInboundBlocks); err != nil {
+		logrus.Errorf(
+			"The following error occurred clearing the partition rules for removed service ID %v; proceeding with the removal:",
+			serviceId)
+		fmt.Fprintln(logrus.StandardLogger().Out, err)
+	}
+	delete(network.linkConditions, serviceId)
+	for _, conditions := range network.linkConditions {
+		delete(conditions.perDestination, serviceId)
+	}
+	network.removeLinkProxies(serviceId, containerStopTimeout)
+	delete(network.fakeTimeFilepaths, serviceId)
+	delete(network.clockSkews, serviceId)
 
 	// Make a best-effort attempt to stop the container
 	err := network.dockerManager.StopContainer(parentCtx, nodeInfo.ContainerId, &containerStopTimeout)
@@ -228,8 +381,31 @@ Args:
 	containerStopTimeout: How long to wait for each container to stop before force-killing it
 */
 func (network *ServiceNetwork) RemoveAll(containerStopTimeout time.Duration) error {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	// Every service is going away, so there's no point rewriting partition rules as each one is removed
+	network.inboundBlocks = make(map[ServiceID]map[ServiceID]bool)
+	network.partitionGroups = nil
 	for serviceId, _ := range network.serviceNodes {
-		network.RemoveService(serviceId, containerStopTimeout)
+		network.removeService(serviceId, containerStopTimeout)
 	}
 	return nil
 }
+
+/*
+Gets the IDs of all the services in the network, sorted so that callers don't depend on map iteration order
+ */
+func (network *ServiceNetwork) getServiceIds() []ServiceID {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	serviceIds := make([]ServiceID, 0, len(network.serviceNodes))
+	for serviceId, _ := range network.serviceNodes {
+		serviceIds = append(serviceIds, serviceId)
+	}
+	sort.Slice(serviceIds, func(i, j int) bool {
+		return serviceIds[i] < serviceIds[j]
+	})
+	return serviceIds
+}
@@ -4,11 +4,20 @@ import (
 	"github.com/kurtosis-tech/kurtosis/commons/docker"
 	"github.com/kurtosis-tech/kurtosis/commons/services"
 	"github.com/palantir/stacktrace"
+	"math"
 )
 
 // Identifier used for service configurations
 type ConfigurationID string
 
+const (
+	// The default Docker image of the sidecar containers used to manipulate services' networking
+	DEFAULT_NETWORK_TOOLS_IMAGE = "nicolaka/netshoot"
+
+	// The smallest CPU limit Docker accepts, as its minimum CFS quota (1ms) over its CFS period (100ms)
+	minCpuLimit = 0.01
+)
+
 /*
 A builder for configuring & constructing a test ServiceNetwork.
  */
@@ -30,6 +39,15 @@ type ServiceNetworkBuilder struct {
 
 	// Directory path where the test Docker volume is mounted on the controller
 	testVolumeControllerDirpath string
+
+	// The Docker image of the sidecar containers used to manipulate services' networking
+	networkToolsImage string
+
+	// The Docker image of the fault-injecting proxies to put between services and their dependencies (empty for none)
+	faultInjectingProxyImage string
+
+	// Whether to publish the ports services listen on to ephemeral ports on the Docker host
+	publishPorts bool
 }
 
 /*
@@ -57,9 +75,128 @@ func NewServiceNetworkBuilder(
 		configurations:              configurations,
 		testVolume:                  testVolume,
 		testVolumeControllerDirpath: testVolumeContrllerDirpath,
+		networkToolsImage:           DEFAULT_NETWORK_TOOLS_IMAGE,
 	}
 }
 
+/*
+Sets the Docker image of the sidecar containers that are run in services' network namespaces to manipulate their
+	networking (e.g. by ServiceNetwork.Partition and ServiceNetwork.SetLinkConditions). The image must contain iptables
+	and the iproute2 tools (ip and tc); it defaults to
+	DEFAULT_NETWORK_TOOLS_IMAGE.
+ */
+func (builder *ServiceNetworkBuilder) SetNetworkToolsImage(networkToolsImage string) {
+	builder.networkToolsImage = networkToolsImage
+}
+
+/*
+Enables fault-injecting proxies, for injecting faults without needing the NET_ADMIN capability that partitions and link
+	conditions need. Each service added to the network gets a Toxiproxy container between it and each of its
+	dependencies, with the dependencies it's given (e.g. in GetStartCommand) being at the proxies' IPs rather than their
+	own, so that the test can inject faults per link with ServiceNetwork.SetLinkProxyToxic. Only TCP ports are proxied,
+	and each proxy takes up an IP in the test network, which the network width must account for.
+
+Partitions and per-destination link conditions still cover the traffic between a service and a dependency that goes
+	through the proxy between them, by also matching the proxy's IP. However, because the proxy rather than the service
+	is at the far end of the connections to the dependency, a one-way partition stopping the dependency's traffic to the
+	service doesn't stop the connections that the service makes to the dependency from working, as it would without
+	proxies.
+
+Args:
+	faultInjectingProxyImage: The Toxiproxy Docker image to run the proxies with (e.g. DEFAULT_FAULT_INJECTING_PROXY_IMAGE),
+		or empty to connect services to their dependencies directly (the default)
+ */
+func (builder *ServiceNetworkBuilder) SetFaultInjectingProxyImage(faultInjectingProxyImage string) {
+	builder.faultInjectingProxyImage = faultInjectingProxyImage
+}
+
+/*
+Makes every service added to the network publish the ports it listens on (as given by its initializer core's
+	GetUsedPorts) to ephemeral ports on the Docker host, so that a developer can point e.g. a browser, database client, or
+	debugger at a service while the test runs. The host addresses are logged when each service is added, and are
+	available in ServiceNode.HostPorts. This is off by default, because it's only meant for debugging.
+ */
+func (builder *ServiceNetworkBuilder) SetPublishPorts(publishPorts bool) {
+	builder.publishPorts = publishPorts
+}
+
+/*
+Optional settings for the containers launched with a service configuration, where the zero value of each field leaves
+	the containers as Docker would create them by default
+ */
+type ServiceConfigurationOptions struct {
+	/*
+	The filepath, on the controller, of a libfaketime (v0.9.8 or later) shared library built for the configuration's Docker
+		image. When set, the library is copied into the test volume and preloaded into every process of the configuration's
+		containers, so that the test can skew the services' clocks at runtime with ServiceNetwork.SetClockSkew.
+	 */
+	FakeTimeLibraryFilepath string
+
+	// Limits on the CPU and memory of the configuration's containers, which ServiceNetwork.UpdateServiceResourceLimits
+	//  can change while a service runs
+	ResourceLimits docker.ContainerResourceLimits
+
+	// The maximum number of processes and threads that can be running in each of the configuration's containers (0 for unlimited)
+	PidsLimit uint64
+
+	// Limits on the resources of each process in the configuration's containers (as set by ulimit)
+	Ulimits []docker.Ulimit
+
+	// Limits on the rate of the I/O the configuration's containers do to host block devices
+	IoThrottles []docker.IoThrottle
+
+	/*
+	Mapping of (mountpoint on container) -> size in bytes of a tmpfs to mount there (0 for no size limit beyond Docker's
+		default), e.g. for giving a service a small data directory that ServiceNetwork.FillServiceDisk can quickly fill
+	 */
+	TmpfsMounts map[string]uint64
+}
+
+/*
+Gets the settings for how the Docker engine should run the containers launched with these options
+ */
+func (options ServiceConfigurationOptions) getContainerHostOptions() docker.ContainerHostOptions {
+	return docker.ContainerHostOptions{
+		ResourceLimits: options.ResourceLimits,
+		PidsLimit:      options.PidsLimit,
+		Ulimits:        options.Ulimits,
+		IoThrottles:    options.IoThrottles,
+		TmpfsMounts:    options.TmpfsMounts,
+	}
+}
+
+func validateResourceLimits(limits docker.ContainerResourceLimits) error {
+	if math.IsNaN(limits.CpuLimit) || math.IsInf(limits.CpuLimit, 0) || limits.CpuLimit < 0 {
+		return stacktrace.NewError("CPU limit must be a non-negative number, but was %v", limits.CpuLimit)
+	}
+	if limits.CpuLimit > 0 && limits.CpuLimit < minCpuLimit {
+		return stacktrace.NewError("CPU limit must be 0 (for unlimited) or at least %v, but was %v", minCpuLimit, limits.CpuLimit)
+	}
+	if limits.MemorySwapBytes < -1 {
+		return stacktrace.NewError("Memory plus swap limit must be -1 (for unlimited swap) or more, but was %v", limits.MemorySwapBytes)
+	}
+	if limits.MemorySwapBytes > 0 && uint64(limits.MemorySwapBytes) < limits.MemoryBytes {
+		return stacktrace.NewError(
+			"Memory plus swap limit %v must be at least the memory limit %v",
+			limits.MemorySwapBytes,
+			limits.MemoryBytes)
+	}
+	return nil
+}
+
+func validateUlimits(ulimits []docker.Ulimit) error {
+	for _, ulimit := range ulimits {
+		if ulimit.Soft > ulimit.Hard {
+			return stacktrace.NewError(
+				"Soft limit %v of ulimit %v must be no more than its hard limit %v",
+				ulimit.Soft,
+				ulimit.Name,
+				ulimit.Hard)
+		}
+	}
+	return nil
+}
+
 /*
 Defines a new service configuration to the network that can later be used to launch Docker containers
 
@@ -75,14 +212,55 @@ func (builder *ServiceNetworkBuilder) AddConfiguration(
 			dockerImage string,
 			initializerCore services.ServiceInitializerCore,
 			availabilityCheckerCore services.ServiceAvailabilityCheckerCore) error {
+	return builder.AddConfigurationWithOptions(
+		configurationId,
+		dockerImage,
+		initializerCore,
+		availabilityCheckerCore,
+		ServiceConfigurationOptions{})
+}
+
+/*
+Defines a new service configuration to the network, like AddConfiguration, whose containers are launched with the given
+	optional settings
+
+Args:
+	configurationId: The ID by which this configuration will be referenced later
+	dockerImage: The Docker image that containers launched with this configuration will run with
+	initializerCore: The user-defined logic for how to launch the Docker container
+	availabilityCheckerCore: The user-defined logic for how to report services launched with this configuration
+		as available
+	options: The optional settings of the containers launched with this configuration
+ */
+func (builder *ServiceNetworkBuilder) AddConfigurationWithOptions(
+			configurationId ConfigurationID,
+			dockerImage string,
+			initializerCore services.ServiceInitializerCore,
+			availabilityCheckerCore services.ServiceAvailabilityCheckerCore,
+			options ServiceConfigurationOptions) error {
 	if _, found := builder.configurations[configurationId]; found {
 		return stacktrace.NewError("Configuration ID %v is already registered", configurationId)
 	}
+	if err := validateResourceLimits(options.ResourceLimits); err != nil {
+		return stacktrace.Propagate(err, "Invalid resource limits for configuration %v", configurationId)
+	}
+	// Unlike when updating a running container's limits, where a memory limit of 0 leaves the current one in place, a
+	//  new container with a swap limit but no memory limit is rejected by Docker
+	if options.ResourceLimits.MemorySwapBytes > 0 && options.ResourceLimits.MemoryBytes == 0 {
+		return stacktrace.NewError(
+			"Memory plus swap limit %v of configuration %v requires a memory limit to be set too",
+			options.ResourceLimits.MemorySwapBytes,
+			configurationId)
+	}
+	if err := validateUlimits(options.Ulimits); err != nil {
+		return stacktrace.Propagate(err, "Invalid ulimits for configuration %v", configurationId)
+	}
 
 	serviceConfig := serviceConfig{
 		dockerImage: dockerImage,
 		availabilityCheckerCore: availabilityCheckerCore,
 		initializerCore:         initializerCore,
+		options:                 options,
 	}
 	builder.configurations[configurationId] = serviceConfig
 	return nil
@@ -104,5 +282,8 @@ func (builder ServiceNetworkBuilder) Build() *ServiceNetwork {
 		builder.dockerNetworkId,
 		configurationsCopy,
 		builder.testVolume,
-		builder.testVolumeControllerDirpath)
+		builder.testVolumeControllerDirpath,
+		builder.networkToolsImage,
+		builder.faultInjectingProxyImage,
+		builder.publishPorts)
 }
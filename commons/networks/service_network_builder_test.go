@@ -1,6 +1,7 @@
 package networks
 
 import (
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
 	"gotest.tools/v3/assert"
 	"testing"
 )
@@ -40,3 +41,41 @@ func TestDefensiveCopies(t *testing.T) {
 
 	assert.Equal(t, 1, len(network.configurations))
 }
+
+func TestConfigurationResourceLimitsValidation(t *testing.T) {
+	builder := NewServiceNetworkBuilder(nil, "test-network", nil, "test", "/foo/bar")
+	addConfigurationWithLimits := func(limits docker.ContainerResourceLimits) error {
+		options := ServiceConfigurationOptions{ResourceLimits: limits}
+		return builder.AddConfigurationWithOptions(testConfigurationId0, "test", getTestInitializerCore(), getTestCheckerCore(), options)
+	}
+
+	assert.ErrorContains(t, addConfigurationWithLimits(docker.ContainerResourceLimits{CpuLimit: -1}), "non-negative")
+	assert.ErrorContains(t, addConfigurationWithLimits(docker.ContainerResourceLimits{CpuLimit: 0.001}), "at least")
+	assert.ErrorContains(t, addConfigurationWithLimits(docker.ContainerResourceLimits{MemorySwapBytes: -2}), "-1")
+	assert.ErrorContains(t, addConfigurationWithLimits(docker.ContainerResourceLimits{MemoryBytes: 2048, MemorySwapBytes: 1024}), "at least the memory limit")
+	assert.ErrorContains(t, addConfigurationWithLimits(docker.ContainerResourceLimits{MemorySwapBytes: 1024}), "requires a memory limit")
+
+	assert.NilError(t, addConfigurationWithLimits(docker.ContainerResourceLimits{
+		CpuLimit:        0.5,
+		CpuShares:       512,
+		MemoryBytes:     1024,
+		MemorySwapBytes: -1,
+	}))
+	assert.Equal(t, builder.Build().configurations[testConfigurationId0].options.ResourceLimits.CpuLimit, 0.5)
+}
+
+func TestConfigurationUlimitsValidation(t *testing.T) {
+	builder := NewServiceNetworkBuilder(nil, "test-network", nil, "test", "/foo/bar")
+	addConfigurationWithUlimits := func(configurationId ConfigurationID, ulimits []docker.Ulimit) error {
+		options := ServiceConfigurationOptions{Ulimits: ulimits}
+		return builder.AddConfigurationWithOptions(configurationId, "test", getTestInitializerCore(), getTestCheckerCore(), options)
+	}
+
+	err := addConfigurationWithUlimits(testConfigurationId0, []docker.Ulimit{
+		{Name: "nproc", Soft: 512, Hard: 512},
+		{Name: "nofile", Soft: 2048, Hard: 1024},
+	})
+	assert.ErrorContains(t, err, "ulimit nofile")
+
+	assert.NilError(t, addConfigurationWithUlimits(testConfigurationId1, []docker.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}}))
+}
@@ -0,0 +1,142 @@
+package networks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/palantir/stacktrace"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// The port that Toxiproxy serves its HTTP API on
+	toxiproxyApiPort = 8474
+
+	toxiproxyRequestTimeout = 10 * time.Second
+
+	toxiproxyStartupPollInterval = 100 * time.Millisecond
+)
+
+/*
+A minimal client for the HTTP API of a Toxiproxy server (see https://github.com/Shopify/toxiproxy)
+ */
+type toxiproxyClient struct {
+	// The URL that the server's API is served at
+	apiUrl string
+
+	httpClient *http.Client
+}
+
+func newToxiproxyClient(ipAddr net.IP) *toxiproxyClient {
+	return &toxiproxyClient{
+		apiUrl: fmt.Sprintf("http://%v:%v", ipAddr.String(), toxiproxyApiPort),
+		httpClient: &http.Client{
+			Timeout: toxiproxyRequestTimeout,
+		},
+	}
+}
+
+type toxiproxyProxy struct {
+	Name     string `json:"name"`
+	Listen   string `json:"listen"`
+	Upstream string `json:"upstream"`
+	Enabled  bool   `json:"enabled"`
+}
+
+type toxiproxyToxic struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	Stream     string           `json:"stream"`
+	Toxicity   float64          `json:"toxicity"`
+	Attributes map[string]int64 `json:"attributes"`
+}
+
+/*
+Blocks until the server's API responds, or the given timeout is reached
+ */
+func (client *toxiproxyClient) waitForStartup(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := client.doRequest(http.MethodGet, "/version", nil, nil)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return stacktrace.Propagate(err, "Toxiproxy at %v didn't come up within %v", client.apiUrl, timeout)
+		}
+		time.Sleep(toxiproxyStartupPollInterval)
+	}
+}
+
+func (client *toxiproxyClient) createProxy(proxy toxiproxyProxy) error {
+	if err := client.doRequest(http.MethodPost, "/proxies", proxy, nil); err != nil {
+		return stacktrace.Propagate(err, "An error occurred creating proxy %v", proxy.Name)
+	}
+	return nil
+}
+
+func (client *toxiproxyClient) addToxic(proxyName string, toxic toxiproxyToxic) error {
+	if err := client.doRequest(http.MethodPost, fmt.Sprintf("/proxies/%v/toxics", proxyName), toxic, nil); err != nil {
+		return stacktrace.Propagate(err, "An error occurred adding toxic %v to proxy %v", toxic.Name, proxyName)
+	}
+	return nil
+}
+
+func (client *toxiproxyClient) removeToxic(proxyName string, toxicName string) error {
+	if err := client.doRequest(http.MethodDelete, fmt.Sprintf("/proxies/%v/toxics/%v", proxyName, toxicName), nil, nil); err != nil {
+		return stacktrace.Propagate(err, "An error occurred removing toxic %v from proxy %v", toxicName, proxyName)
+	}
+	return nil
+}
+
+/*
+Sends a request to the Toxiproxy API.
+
+Args:
+	method: The HTTP method of the request
+	path: The path of the API endpoint
+	requestBody: An object to send as the JSON body of the request (nil for no body)
+	responseBody: A pointer to deserialize the JSON response body into (nil to ignore the response body)
+ */
+func (client *toxiproxyClient) doRequest(method string, path string, requestBody interface{}, responseBody interface{}) error {
+	var bodyBytes []byte
+	if requestBody != nil {
+		var err error
+		bodyBytes, err = json.Marshal(requestBody)
+		if err != nil {
+			return stacktrace.Propagate(err, "An error occurred serializing the body of the request to %v", path)
+		}
+	}
+	request, err := http.NewRequest(method, client.apiUrl + path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred building the request to %v", path)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred sending the %v request to %v", method, path)
+	}
+	defer response.Body.Close()
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred reading the response to the %v request to %v", method, path)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return stacktrace.NewError(
+			"The %v request to %v failed with status %v: %v",
+			method,
+			path,
+			response.StatusCode,
+			string(responseBytes))
+	}
+	if responseBody != nil {
+		if err := json.Unmarshal(responseBytes, responseBody); err != nil {
+			return stacktrace.Propagate(err, "An error occurred parsing the response to the %v request to %v", method, path)
+		}
+	}
+	return nil
+}
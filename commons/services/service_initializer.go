@@ -54,6 +54,9 @@ Args:
 	staticIp: The IP the new service will be given
 	manager: The DockerManager used to launch the container running the service
 	dependencies: The services that the service-to-be-started depends on
+	envVariables: Environment variables to set in the container running the service, on top of any that the core sets
+		if it implements EnvVariablesInitializerCore (which mustn't set the same variables)
+	hostOptions: Optional settings for how the Docker engine runs the container running the service
 
 Returns:
 	Service: The interface which should be used to access the newly-created service (which, because Go doesn't have generics,
@@ -66,7 +69,9 @@ func (initializer ServiceInitializer) CreateService(
 			dockerImage string,
 			staticIp net.IP,
 			manager *docker.DockerManager,
-			dependencies []Service) (Service, string, error) {
+			dependencies []Service,
+			envVariables map[string]string,
+			hostOptions docker.ContainerHostOptions) (Service, string, error) {
 	initializerCore := initializer.core
 	usedPorts := initializerCore.GetUsedPorts()
 
@@ -98,6 +103,25 @@ func (initializer ServiceInitializer) CreateService(
 		return nil, "", stacktrace.Propagate(err, "Failed to create start command.")
 	}
 
+	containerEnvVariables := map[string]string{}
+	if envVariablesCore, ok := initializerCore.(EnvVariablesInitializerCore); ok {
+		coreEnvVariables, err := envVariablesCore.GetEnvVariables(mountFilepaths, staticIp, dependencies)
+		if err != nil {
+			return nil, "", stacktrace.Propagate(err, "Failed to create environment variables.")
+		}
+		for key, value := range coreEnvVariables {
+			containerEnvVariables[key] = value
+		}
+	}
+	for key, value := range envVariables {
+		if _, found := containerEnvVariables[key]; found {
+			return nil, "", stacktrace.NewError(
+				"The service's initializer core sets environment variable %v, which Kurtosis needs to set itself (e.g. for clock skew)",
+				key)
+		}
+		containerEnvVariables[key] = value
+	}
+
 	volumeMounts := map[string]string{
 		testVolumeName: initializerCore.GetTestVolumeMountpoint(),
 	}
@@ -109,9 +133,10 @@ func (initializer ServiceInitializer) CreateService(
 			staticIp,
 			usedPorts,
 			startCmdArgs,
+			containerEnvVariables,
 			make(map[string]string),
-			make(map[string]string),
-			volumeMounts)
+			volumeMounts,
+			hostOptions)
 	if err != nil {
 		return nil, "", stacktrace.Propagate(err, "Could not start docker service for image %v", dockerImage)
 	}
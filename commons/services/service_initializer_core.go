@@ -87,3 +87,26 @@ type ServiceInitializerCore interface {
 
 }
 
+
+/*
+An optional interface that a ServiceInitializerCore can implement to configure the Docker container running the service
+	through environment variables, e.g. for images that are only configurable that way.
+ */
+type EnvVariablesInitializerCore interface {
+	// If Go had generics, dependencies should be of type []T
+	/*
+	Uses the given arguments to build the environment variables that the Docker container running this service will be
+		launched with, in the same way that `GetStartCommand` builds its command.
+
+	Args:
+		mountedFileFilepaths: Mapping of developer_key -> initialized_file_filepath where developer_key corresponds to the keys returned
+			in the `GetFilesToMount` function, and initialized_file_filepath is the path *on the Docker container* of where the
+			file has been mounted. The files will have already been initialized via the `InitializeMountedFiles` function.
+		publicIpAddr: The IP address of the Docker image running the service
+		dependencies: The services that this service depends on (for use in case the environment variables change based on dependencies)
+
+	Returns:
+		A mapping of environment variable name -> value to launch the Docker container running the service with
+	 */
+	GetEnvVariables(mountedFileFilepaths map[string]string, publicIpAddr net.IP, dependencies []Service) (map[string]string, error)
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"github.com/docker/go-connections/nat"
+	"github.com/kurtosis-tech/kurtosis/commons/docker"
+	"github.com/kurtosis-tech/kurtosis/commons/docker/dockertest"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"testing"
+)
+
+const (
+	testNetworkId = "test-network"
+	testVolumeName = "test-volume"
+	testVolumeMountpoint = "/test-volume"
+)
+
+type testService struct {}
+
+// ======================== Test Initializer Cores ========================
+type testInitializerCore struct {}
+
+func (core testInitializerCore) GetUsedPorts() map[nat.Port]bool {
+	return map[nat.Port]bool{}
+}
+
+func (core testInitializerCore) GetServiceFromIp(ipAddr string) Service {
+	return testService{}
+}
+
+func (core testInitializerCore) GetFilesToMount() map[string]bool {
+	return map[string]bool{}
+}
+
+func (core testInitializerCore) InitializeMountedFiles(mountedFiles map[string]*os.File, dependencies []Service) error {
+	return nil
+}
+
+func (core testInitializerCore) GetStartCommand(mountedFileFilepaths map[string]string, ipPlaceholder net.IP, dependencies []Service) ([]string, error) {
+	return []string{}, nil
+}
+
+func (core testInitializerCore) GetTestVolumeMountpoint() string {
+	return testVolumeMountpoint
+}
+
+// A core that also configures its container through environment variables
+type testEnvVariablesInitializerCore struct {
+	testInitializerCore
+
+	envVariables map[string]string
+}
+
+func (core testEnvVariablesInitializerCore) GetEnvVariables(mountedFileFilepaths map[string]string, ipAddr net.IP, dependencies []Service) (map[string]string, error) {
+	return core.envVariables, nil
+}
+
+// ======================== Tests ========================
+func TestCoreEnvVariablesReachContainer(t *testing.T) {
+	core := testEnvVariablesInitializerCore{envVariables: map[string]string{"NODE_NAME": "node1"}}
+	containerEnv, err := createTestService(t, core, map[string]string{"FAKETIME_CACHE_DURATION": "1"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, containerEnv, []string{"FAKETIME_CACHE_DURATION=1", "NODE_NAME=node1"})
+}
+
+func TestCoreWithoutEnvVariables(t *testing.T) {
+	containerEnv, err := createTestService(t, testInitializerCore{}, map[string]string{"FAKETIME_CACHE_DURATION": "1"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, containerEnv, []string{"FAKETIME_CACHE_DURATION=1"})
+}
+
+func TestCoreEnvVariablesCollidingWithKurtosisEnvVariables(t *testing.T) {
+	core := testEnvVariablesInitializerCore{envVariables: map[string]string{"LD_PRELOAD": "/usr/lib/libjemalloc.so"}}
+	clockSkewEnvVariables := map[string]string{
+		"LD_PRELOAD":              testVolumeMountpoint + "/clock-skew/libfaketime.so",
+		"FAKETIME_TIMESTAMP_FILE": testVolumeMountpoint + "/clock-skew/faketime",
+	}
+	containerEnv, err := createTestService(t, core, clockSkewEnvVariables)
+	assert.ErrorContains(t, err, "sets environment variable LD_PRELOAD")
+	// The container is never created
+	assert.Assert(t, containerEnv == nil)
+}
+
+/*
+Creates a service with the given core against a fake Docker engine
+
+Returns:
+	The sorted environment variables, as "KEY=VALUE", that the service's container was created with (nil if no container
+		was created)
+	An error if creating the service failed
+ */
+func createTestService(t *testing.T, core ServiceInitializerCore, envVariables map[string]string) ([]string, error) {
+	engine := dockertest.NewFakeDockerEngine(t)
+	defer engine.Close()
+	manager, err := docker.NewDockerManager(logrus.StandardLogger(), engine.NewClient())
+	assert.NilError(t, err)
+
+	testVolumeControllerDirpath, err := ioutil.TempDir("", "service initializer test")
+	assert.NilError(t, err)
+	defer os.RemoveAll(testVolumeControllerDirpath)
+
+	initializer := NewServiceInitializer(core, testNetworkId, testVolumeControllerDirpath)
+	_, _, err = initializer.CreateService(
+		context.Background(),
+		testVolumeName,
+		"test-image",
+		net.ParseIP("172.23.0.2"),
+		manager,
+		[]Service{},
+		envVariables,
+		docker.ContainerHostOptions{})
+
+	createdContainers := engine.GetCreatedContainers()
+	if len(createdContainers) == 0 {
+		return nil, err
+	}
+	containerEnv := append([]string{}, createdContainers[0].Config.Env...)
+	sort.Strings(containerEnv)
+	return containerEnv, err
+}
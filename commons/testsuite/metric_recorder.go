@@ -0,0 +1,59 @@
+package testsuite
+
+import "sync"
+
+/*
+Tracks the metrics that a test records, so that they can be reported back to the initializer.
+
+NOTE: This is thread-safe, because tests are free to record metrics from their own goroutines
+ */
+type metricRecorder struct {
+	mutex *sync.Mutex
+
+	// The metrics that have been recorded, in the order they were first recorded
+	metrics []MetricResult
+
+	// Mapping of metric name -> index of the metric in the metrics list, so re-recording a metric overwrites it
+	metricIndices map[string]int
+}
+
+func newMetricRecorder() *metricRecorder {
+	return &metricRecorder{
+		mutex:         &sync.Mutex{},
+		metrics:       []MetricResult{},
+		metricIndices: map[string]int{},
+	}
+}
+
+/*
+Records the given metric, overwriting any previous value recorded under the same name
+ */
+func (recorder *metricRecorder) recordMetric(name string, value float64, unit string) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	metric := MetricResult{
+		Name:  name,
+		Value: value,
+		Unit:  unit,
+	}
+	if index, found := recorder.metricIndices[name]; found {
+		recorder.metrics[index] = metric
+		return
+	}
+	recorder.metricIndices[name] = len(recorder.metrics)
+	recorder.metrics = append(recorder.metrics, metric)
+}
+
+/*
+Gets a snapshot of all the metrics recorded so far
+ */
+func (recorder *metricRecorder) getMetricResults() []MetricResult {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	// Defensive copy
+	result := make([]MetricResult, len(recorder.metrics))
+	copy(result, recorder.metrics)
+	return result
+}
@@ -0,0 +1,111 @@
+package testsuite
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Tracks the steps that a test executes, so that the step breakdown can be reported back to the initializer.
+
+NOTE: This is thread-safe, because tests are free to start steps from their own goroutines
+ */
+type stepRecorder struct {
+	mutex *sync.Mutex
+
+	// The steps that have been started, in the order they were started
+	steps []*recordedStep
+}
+
+// Internal, mutable version of a StepResult that's still being filled in while the step runs
+type recordedStep struct {
+	name string
+	startTime time.Time
+	endTime time.Time
+	completed bool
+	failureMessage string
+}
+
+func newStepRecorder() *stepRecorder {
+	return &stepRecorder{
+		mutex: &sync.Mutex{},
+		steps: []*recordedStep{},
+	}
+}
+
+/*
+Records the start of a step with the given name, returning a handle that should be passed to `endStep` when the step is done
+ */
+func (recorder *stepRecorder) startStep(name string) *recordedStep {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	step := &recordedStep{
+		name:      name,
+		startTime: time.Now(),
+	}
+	recorder.steps = append(recorder.steps, step)
+	return step
+}
+
+/*
+Marks the given step as complete, failed with the given error if it's non-nil
+ */
+func (recorder *stepRecorder) endStep(step *recordedStep, failure error) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	step.endTime = time.Now()
+	step.completed = true
+	if failure != nil {
+		step.failureMessage = failure.Error()
+	}
+}
+
+/*
+Gets the name of the most recently-started step that hasn't completed yet, or the empty string if no step is running
+ */
+func (recorder *stepRecorder) getCurrentStepName() string {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for i := len(recorder.steps) - 1; i >= 0; i-- {
+		if !recorder.steps[i].completed {
+			return recorder.steps[i].name
+		}
+	}
+	return ""
+}
+
+/*
+Gets a snapshot of the results of all steps recorded so far; steps that are still running will be reported as incomplete
+ */
+func (recorder *stepRecorder) getStepResults() []StepResult {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]StepResult, 0, len(recorder.steps))
+	for _, step := range recorder.steps {
+		var status StepStatus
+		var duration time.Duration
+		if !step.completed {
+			status = STEP_INCOMPLETE
+			duration = now.Sub(step.startTime)
+		} else {
+			duration = step.endTime.Sub(step.startTime)
+			if step.failureMessage != "" {
+				status = STEP_FAILED
+			} else {
+				status = STEP_PASSED
+			}
+		}
+		result = append(result, StepResult{
+			Name:           step.name,
+			Duration:       duration,
+			Status:         status,
+			FailureMessage: step.failureMessage,
+		})
+	}
+	return result
+}
@@ -39,3 +39,97 @@ type Test interface {
 	 */
 	GetSetupBuffer() time.Duration
 }
+
+/*
+An optional interface that a Test can additionally implement to declare tags (e.g. "smoke", "slow", "chaos", "nightly"),
+	which can be used to select which tests to run via a tag selection expression like "smoke && !slow"
+ */
+type TaggedTest interface {
+	// Gets the "set" of tags that the test has
+	GetTags() map[string]bool
+}
+
+/*
+An optional interface that a Test can additionally implement to declare, before any of the test's setup happens, that it
+	can't run in the current environment (e.g. because a required image isn't available or a feature flag is off). Tests
+	that can only make the decision once they're running should call `TestContext.Skip` instead.
+ */
+type SkippableTest interface {
+	/*
+	Decides whether the test should be skipped.
+
+	Returns:
+		shouldSkip: True if the test shouldn't be run
+		reason: A human-readable explanation of why the test is being skipped, which will be shown in the test results
+	 */
+	ShouldSkip() (shouldSkip bool, reason string)
+}
+
+/*
+An optional interface that a Test can additionally implement to run logic inside the controller immediately before and
+	after the test's `Run` method, against the same network (e.g. seeding data, dumping service state when the test fails,
+	or checking the network for consistency once the test is done). Both hooks report failures via the given context,
+	just like `Run`, and a failure in either hook fails the test. The hooks count against the test's execution timeout.
+ */
+type HookedTest interface {
+	/*
+	Runs before the test's `Run` method. If this fails (or skips the test), `Run` won't be called but `AfterRun` still will.
+
+	Args:
+		network: The same user-defined representation of the network that `Run` will receive
+		context: The test context, for making assertions
+	 */
+	BeforeRun(network networks.Network, context TestContext)
+
+	/*
+	Runs after the test's `Run` method, regardless of whether `BeforeRun` or `Run` failed.
+
+	Args:
+		network: The same user-defined representation of the network that `Run` received
+		context: The test context, for making assertions
+		testErr: The error that `BeforeRun` or `Run` failed with, or nil if both passed (or the test was skipped)
+	 */
+	AfterRun(network networks.Network, context TestContext, testErr error)
+}
+
+/*
+An optional interface that a Test can additionally implement to declare itself quarantined, e.g. because it's known to be
+	flaky and is being fixed. A quarantined test still runs and its result is still reported, but its failures don't fail
+	the test suite execution.
+ */
+type QuarantinedTest interface {
+	/*
+	Decides whether the test is quarantined.
+
+	Returns:
+		isQuarantined: True if the test's failures shouldn't fail the test suite execution
+		reason: A human-readable explanation of why the test is quarantined (e.g. a link to the bug tracking the flakiness),
+			which will be shown in the test results
+	 */
+	IsQuarantined() (isQuarantined bool, reason string)
+}
+
+/*
+An optional interface that a Test can additionally implement to declare how much of the host's resources its network
+	needs, so that big tests (e.g. a 30-node network) and small tests can be packed onto the host without overloading it.
+	Tests that don't implement this interface are treated as needing no resources. See TestSuiteRunner for how the
+	host's capacity is determined.
+ */
+type ResourceDeclaringTest interface {
+	// Gets the resources that the test's network needs while the test is running
+	GetResourceRequirements() TestResourceRequirements
+}
+
+/*
+The host resources that a test needs while it's running, summed over all the containers in its network
+ */
+type TestResourceRequirements struct {
+	// The number of CPUs the test needs (e.g. 0.5 for half a CPU)
+	CPUs float64
+
+	// The amount of memory the test needs, in bytes
+	MemoryBytes uint64
+
+	// The number of containers the test's network will run
+	Containers uint
+}
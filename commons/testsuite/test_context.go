@@ -1,9 +1,49 @@
 package testsuite
 
+import (
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
 /*
 An object that will be passed in to every test, which the user can use to manipulate the results of the test
  */
-type TestContext struct {}
+type TestContext struct {
+	// Records the named steps the test executes (nil if the context wasn't created with NewTestContext, in which case
+	//  steps are run but not recorded)
+	stepRecorder *stepRecorder
+
+	// Records the metrics the test reports (nil if the context wasn't created with NewTestContext, in which case metrics
+	//  are dropped)
+	metricRecorder *metricRecorder
+
+	// Records whether the test has skipped itself (nil if the context wasn't created with NewTestContext)
+	skipTracker *skipTracker
+
+	// The logger that the test should log through, which tags entries with test information (nil if the context wasn't
+	//  created with NewTestContext, in which case the system-level logger is used)
+	logger *logrus.Logger
+}
+
+/*
+Creates a new TestContext, ready to be passed to a single test's `Run` method
+
+Args:
+	testName: The name of the test the context is for, which will be attached to all log entries written via the context
+ */
+func NewTestContext(testName string) *TestContext {
+	stepRecorder := newStepRecorder()
+	standardLogger := logrus.StandardLogger()
+	logger := newTestLogger(standardLogger.Out, standardLogger.Level, testName, time.Now(), stepRecorder)
+	return &TestContext{
+		stepRecorder:   stepRecorder,
+		metricRecorder: newMetricRecorder(),
+		skipTracker:    &skipTracker{mutex: &sync.Mutex{}},
+		logger:         logger,
+	}
+}
 
 /*
 Fails the test with the given error
@@ -22,6 +62,156 @@ func (context TestContext) AssertTrue(condition bool, err error) {
 	}
 }
 
+/*
+Stops the test and marks it as skipped rather than passed or failed, for when the test discovers at runtime that it can't
+	run in the current environment (e.g. because a required image isn't available). Skipped tests don't count as failures.
+
+Args:
+	reason: A human-readable explanation of why the test is being skipped, which will be shown in the test results
+ */
+func (context TestContext) Skip(reason string) {
+	context.Logger().Infof("Skipping test: %v", reason)
+	if context.skipTracker != nil {
+		context.skipTracker.markSkipped(reason)
+	}
+	// Like failing, we panic because we want to completely stop whatever the test is doing
+	panic(stacktrace.NewError("Test was skipped: %v", reason))
+}
+
+/*
+Gets the logger that the test should use, which writes structured entries tagged with the test name, the currently-running
+	step, and the time elapsed since the test started so that the Kurtosis initializer can render and filter them.
+ */
+func (context TestContext) Logger() *logrus.Logger {
+	if context.logger == nil {
+		return logrus.StandardLogger()
+	}
+	return context.logger
+}
+
+/*
+Logs a formatted message at the info level through the test's logger (see `Logger`)
+ */
+func (context TestContext) Logf(format string, args ...interface{}) {
+	context.Logger().Infof(format, args...)
+}
+
+/*
+Runs the given function as a named step of the test, logging when the step starts and ends and recording how long it
+	took. If the test fails inside the step, the failure is attributed to the step in the test's results.
+
+Args:
+	name: A human-readable name for the step (e.g. "bootstrap cluster")
+	stepFunc: The logic of the step
+ */
+func (context TestContext) Step(name string, stepFunc func()) {
+	if context.stepRecorder == nil {
+		stepFunc()
+		return
+	}
+
+	logger := context.Logger()
+	logger.Infof("Starting step '%v'...", name)
+	step := context.stepRecorder.startStep(name)
+	defer func() {
+		recoverResult := recover()
+		if recoverResult != nil && context.isSkipped() {
+			// Skipping isn't a failure of the step, so we end it normally and let the skip continue to unwind the test
+			context.stepRecorder.endStep(step, nil)
+			logger.Infof("Step '%v' ended after %v because the test was skipped", name, step.endTime.Sub(step.startTime))
+			panic(recoverResult)
+		}
+		if recoverResult == nil {
+			context.stepRecorder.endStep(step, nil)
+			logger.Infof("Step '%v' completed in %v", name, step.endTime.Sub(step.startTime))
+			return
+		}
+
+		stepErr, ok := recoverResult.(error)
+		if !ok {
+			stepErr = stacktrace.NewError("%v", recoverResult)
+		}
+		context.stepRecorder.endStep(step, stepErr)
+		logger.Errorf("Step '%v' failed after %v", name, step.endTime.Sub(step.startTime))
+		failTest(stacktrace.Propagate(stepErr, "Step '%v' failed", name))
+	}()
+	stepFunc()
+}
+
+/*
+Records a measurement taken by the test (e.g. throughput or p99 latency), which will be reported by the Kurtosis initializer
+	and can be compared against a baseline to catch performance regressions. Recording a metric with the same name twice
+	overwrites the previous value.
+
+Args:
+	name: The name of the metric (e.g. "throughput")
+	value: The measured value
+	unit: The unit the value is measured in (e.g. "req/s"), for display purposes
+ */
+func (context TestContext) RecordMetric(name string, value float64, unit string) {
+	context.Logger().Infof("Recorded metric %v = %v %v", name, value, unit)
+	if context.metricRecorder == nil {
+		return
+	}
+	context.metricRecorder.recordMetric(name, value, unit)
+}
+
+/*
+Gets a snapshot of the structured results that the test has recorded on this context so far. This is used by Kurtosis
+	to report test results back to the initializer, and shouldn't need to be called by tests.
+ */
+func (context TestContext) GetExecutionResults() TestExecutionResults {
+	stepResults := []StepResult{}
+	if context.stepRecorder != nil {
+		stepResults = context.stepRecorder.getStepResults()
+	}
+	metricResults := []MetricResult{}
+	if context.metricRecorder != nil {
+		metricResults = context.metricRecorder.getMetricResults()
+	}
+	skipped, skipReason := false, ""
+	if context.skipTracker != nil {
+		skipped, skipReason = context.skipTracker.getSkipState()
+	}
+	return TestExecutionResults{
+		Steps:      stepResults,
+		Metrics:    metricResults,
+		Skipped:    skipped,
+		SkipReason: skipReason,
+	}
+}
+
+// Returns true if the test has called Skip
+func (context TestContext) isSkipped() bool {
+	if context.skipTracker == nil {
+		return false
+	}
+	skipped, _ := context.skipTracker.getSkipState()
+	return skipped
+}
+
 func failTest(err error) {
 	panic(err)
 }
+
+/*
+Thread-safe record of whether a test has skipped itself, and why
+ */
+type skipTracker struct {
+	mutex *sync.Mutex
+	skipped bool
+	reason string
+}
+
+func (tracker *skipTracker) markSkipped(reason string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.skipped = true
+	tracker.reason = reason
+}
+
+func (tracker *skipTracker) getSkipState() (bool, string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.skipped, tracker.reason
+}
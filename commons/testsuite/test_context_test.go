@@ -2,6 +2,7 @@ package testsuite
 
 import (
 	"github.com/palantir/stacktrace"
+	"gotest.tools/assert"
 	"testing"
 )
 
@@ -22,3 +23,67 @@ func TestFatalOnAssertion(t *testing.T) {
 	}()
 	TestContext{}.AssertTrue(false, stacktrace.NewError("Failed assertion"))
 }
+
+func TestStepRecordsResults(t *testing.T) {
+	context := NewTestContext("test")
+	context.Step("first", func() {})
+	context.Step("second", func() {})
+
+	steps := context.GetExecutionResults().Steps
+	assert.Equal(t, 2, len(steps))
+	assert.Equal(t, "first", steps[0].Name)
+	assert.Equal(t, STEP_PASSED, steps[0].Status)
+	assert.Equal(t, "second", steps[1].Name)
+	assert.Equal(t, STEP_PASSED, steps[1].Status)
+}
+
+func TestStepAttributesFailure(t *testing.T) {
+	context := NewTestContext("test")
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("The code did not panic when it should")
+			}
+		}()
+		context.Step("failing", func() {
+			context.Fatal(stacktrace.NewError("Test error"))
+		})
+	}()
+
+	steps := context.GetExecutionResults().Steps
+	assert.Equal(t, 1, len(steps))
+	assert.Equal(t, STEP_FAILED, steps[0].Status)
+	assert.Assert(t, steps[0].FailureMessage != "")
+}
+
+func TestRecordMetricOverwrites(t *testing.T) {
+	context := NewTestContext("test")
+	context.RecordMetric("throughput", 100, "req/s")
+	context.RecordMetric("p99Latency", 25, "ms")
+	context.RecordMetric("throughput", 200, "req/s")
+
+	metrics := context.GetExecutionResults().Metrics
+	assert.Equal(t, 2, len(metrics))
+	assert.Equal(t, "throughput", metrics[0].Name)
+	assert.Equal(t, 200.0, metrics[0].Value)
+	assert.Equal(t, "p99Latency", metrics[1].Name)
+}
+
+func TestSkipInsideStep(t *testing.T) {
+	context := NewTestContext("test")
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("The code did not panic when it should")
+			}
+		}()
+		context.Step("checking prerequisites", func() {
+			context.Skip("Required image is unavailable")
+		})
+	}()
+
+	results := context.GetExecutionResults()
+	assert.Assert(t, results.Skipped)
+	assert.Equal(t, "Required image is unavailable", results.SkipReason)
+	assert.Equal(t, STEP_PASSED, results.Steps[0].Status)
+}
@@ -0,0 +1,101 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"github.com/palantir/stacktrace"
+	"io/ioutil"
+	"time"
+)
+
+// =============================== "enum" for step status =========================================
+type StepStatus string
+const (
+	STEP_PASSED     StepStatus = "PASSED"
+	STEP_FAILED     StepStatus = "FAILED"
+	STEP_INCOMPLETE StepStatus = "INCOMPLETE" // Indicates the step was still running when the results were collected (e.g. on timeout)
+)
+
+/*
+Package struct containing the outcome of a single named step that a test executed via `TestContext.Step`
+ */
+type StepResult struct {
+	// The name the test gave the step
+	Name string `json:"name"`
+
+	// How long the step ran for (or, for an incomplete step, how long it had been running when results were collected)
+	Duration time.Duration `json:"duration"`
+
+	// Whether the step passed, failed, or never finished
+	Status StepStatus `json:"status"`
+
+	// The failure that was raised inside the step (empty if the step didn't fail)
+	FailureMessage string `json:"failureMessage,omitempty"`
+}
+
+/*
+Package struct containing a single metric that a test recorded via `TestContext.RecordMetric`
+ */
+type MetricResult struct {
+	// The name the test gave the metric (e.g. "throughput")
+	Name string `json:"name"`
+
+	// The value of the metric
+	Value float64 `json:"value"`
+
+	// The unit the value is measured in (e.g. "req/s"), purely for display purposes
+	Unit string `json:"unit"`
+}
+
+/*
+Package struct containing the structured information that the controller records about a test execution, beyond the
+	simple pass/fail of the exit code. The controller writes this to a file which the initializer reads back after the
+	controller container exits.
+ */
+type TestExecutionResults struct {
+	// The steps the test executed, in the order they were started
+	Steps []StepResult `json:"steps"`
+
+	// The metrics the test recorded, in the order they were first recorded
+	Metrics []MetricResult `json:"metrics"`
+
+	// Whether the test decided that it couldn't run and skipped itself
+	Skipped bool `json:"skipped"`
+
+	// Why the test was skipped (empty if the test wasn't skipped)
+	SkipReason string `json:"skipReason,omitempty"`
+}
+
+/*
+Serializes the results to the file at the given filepath, overwriting whatever is already there
+ */
+func (results TestExecutionResults) WriteToFile(filepath string) error {
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred serializing the test execution results")
+	}
+	if err := ioutil.WriteFile(filepath, resultsBytes, 0644); err != nil {
+		return stacktrace.Propagate(err, "An error occurred writing the test execution results to file %v", filepath)
+	}
+	return nil
+}
+
+/*
+Reads test execution results that were written with `WriteToFile`.
+
+Returns:
+	The deserialized results, or nil if the file is empty (which means the controller never wrote any results)
+ */
+func ReadTestExecutionResultsFromFile(filepath string) (*TestExecutionResults, error) {
+	resultsBytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred reading the test execution results file %v", filepath)
+	}
+	if len(resultsBytes) == 0 {
+		return nil, nil
+	}
+	var results TestExecutionResults
+	if err := json.Unmarshal(resultsBytes, &results); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred deserializing the test execution results in file %v", filepath)
+	}
+	return &results, nil
+}
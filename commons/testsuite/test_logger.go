@@ -0,0 +1,163 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+These are an "API" of sorts - the fields that every log entry written through the TestContext's logger is tagged with,
+	which the initializer uses to recognize and parse structured test log entries out of the controller's logs
+ */
+const (
+	TEST_LOG_TEST_NAME_FIELD = "kurtosisTest"
+	TEST_LOG_STEP_FIELD      = "kurtosisStep"
+	TEST_LOG_ELAPSED_FIELD   = "kurtosisElapsed"
+
+	// Logrus' JSONFormatter uses these keys for the standard entry fields
+	testLogTimeField    = "time"
+	testLogLevelField   = "level"
+	testLogMessageField = "msg"
+)
+
+/*
+Logrus hook that tags each entry logged through a test's logger with the test name, the step that's currently running,
+	and how long the test has been running for
+ */
+type testLogTaggingHook struct {
+	testName string
+	startTime time.Time
+	stepRecorder *stepRecorder
+}
+
+func (hook testLogTaggingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook testLogTaggingHook) Fire(entry *logrus.Entry) error {
+	entry.Data[TEST_LOG_TEST_NAME_FIELD] = hook.testName
+	entry.Data[TEST_LOG_STEP_FIELD] = hook.stepRecorder.getCurrentStepName()
+	entry.Data[TEST_LOG_ELAPSED_FIELD] = entry.Time.Sub(hook.startTime).Round(time.Millisecond).String()
+	return nil
+}
+
+/*
+Creates the logger that a single test logs through, which writes JSON so that the initializer can parse the entries back
+	out of the controller's logs
+ */
+func newTestLogger(out io.Writer, level logrus.Level, testName string, startTime time.Time, stepRecorder *stepRecorder) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.JSONFormatter{
+		TimestampFormat: time.RFC3339Nano,
+	})
+	logger.AddHook(testLogTaggingHook{
+		testName:     testName,
+		startTime:    startTime,
+		stepRecorder: stepRecorder,
+	})
+	return logger
+}
+
+// ================================ Parsing ==================================================
+/*
+A structured log entry that was written through a TestContext's logger, as parsed back out of the controller's logs
+ */
+type TestLogEntry struct {
+	Time time.Time
+	Level logrus.Level
+	Message string
+
+	// The name of the test that logged the entry
+	TestName string
+
+	// The step that was running when the entry was logged (empty if no step was running)
+	StepName string
+
+	// How long the test had been running for when the entry was logged, e.g. "12.3s"
+	Elapsed string
+
+	// Any other fields that the test attached to the entry
+	Fields map[string]interface{}
+}
+
+/*
+Attempts to parse the given line of controller log output as a structured test log entry.
+
+Returns:
+	The parsed entry, and true if the line was a structured test log entry (false if it's any other kind of output)
+ */
+func ParseTestLogEntry(line string) (TestLogEntry, bool) {
+	trimmedLine := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmedLine, "{") {
+		return TestLogEntry{}, false
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(trimmedLine), &fields); err != nil {
+		return TestLogEntry{}, false
+	}
+	testName, found := fields[TEST_LOG_TEST_NAME_FIELD]
+	if !found {
+		return TestLogEntry{}, false
+	}
+
+	level, err := logrus.ParseLevel(fmt.Sprint(fields[testLogLevelField]))
+	if err != nil {
+		return TestLogEntry{}, false
+	}
+	entryTime, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(fields[testLogTimeField]))
+
+	entry := TestLogEntry{
+		Time:     entryTime,
+		Level:    level,
+		Message:  fmt.Sprint(fields[testLogMessageField]),
+		TestName: fmt.Sprint(testName),
+		StepName: fmt.Sprint(fields[TEST_LOG_STEP_FIELD]),
+		Elapsed:  fmt.Sprint(fields[TEST_LOG_ELAPSED_FIELD]),
+		Fields:   map[string]interface{}{},
+	}
+	for _, standardField := range []string{
+			testLogTimeField,
+			testLogLevelField,
+			testLogMessageField,
+			TEST_LOG_TEST_NAME_FIELD,
+			TEST_LOG_STEP_FIELD,
+			TEST_LOG_ELAPSED_FIELD} {
+		delete(fields, standardField)
+	}
+	for key, value := range fields {
+		entry.Fields[key] = value
+	}
+	return entry, true
+}
+
+/*
+Renders the entry as a single human-readable line, e.g.:
+
+	[+12.3s] [kill leader] WARN Leader still reachable node=node3
+ */
+func (entry TestLogEntry) Format() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("[+%v] ", entry.Elapsed))
+	if entry.StepName != "" {
+		builder.WriteString(fmt.Sprintf("[%v] ", entry.StepName))
+	}
+	builder.WriteString(fmt.Sprintf("%v %v", strings.ToUpper(entry.Level.String()), entry.Message))
+
+	// We sort the fields because we want normalized output
+	fieldKeys := make([]string, 0, len(entry.Fields))
+	for key, _ := range entry.Fields {
+		fieldKeys = append(fieldKeys, key)
+	}
+	sort.Strings(fieldKeys)
+	for _, key := range fieldKeys {
+		builder.WriteString(fmt.Sprintf(" %v=%v", key, entry.Fields[key]))
+	}
+	return builder.String()
+}
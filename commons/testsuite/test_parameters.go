@@ -0,0 +1,114 @@
+package testsuite
+
+import (
+	"fmt"
+	"github.com/palantir/stacktrace"
+	"sort"
+	"strings"
+)
+
+/*
+A single row of a parameterized test's parameter table, mapping parameter name -> value (e.g. "nodes" -> "7")
+ */
+type TestParameters map[string]string
+
+/*
+A test template that gets expanded into one test per row of its parameter table, for when the same test logic needs to run
+	against several configurations (e.g. 4, 7, and 13 nodes). Each expanded test gets named after the template and its
+	parameters, like "consensus[nodes=7,variant=b]", and can be selected and reported on just like a normal test.
+ */
+type ParameterizedTest interface {
+	// Gets the parameter table, where each row will become a separate test
+	GetParameterTable() []TestParameters
+
+	// Creates the test for a single row of the parameter table
+	CreateTest(params TestParameters) Test
+}
+
+/*
+An optional interface that a TestSuite can additionally implement to register parameterized tests
+ */
+type ParameterizedTestSuite interface {
+	TestSuite
+
+	// Gets the parameterized tests in the test suite, keyed by the base name that the expanded tests will be named after
+	GetParameterizedTests() map[string]ParameterizedTest
+}
+
+/*
+Gets all the tests in the test suite, including the tests expanded from the suite's parameterized tests if it has any.
+	This should be used instead of calling `GetTests` directly.
+ */
+func GetAllTests(suite TestSuite) (map[string]Test, error) {
+	result := map[string]Test{}
+	for testName, test := range suite.GetTests() {
+		result[testName] = test
+	}
+
+	parameterizedSuite, ok := suite.(ParameterizedTestSuite)
+	if !ok {
+		return result, nil
+	}
+	for baseName, parameterizedTest := range parameterizedSuite.GetParameterizedTests() {
+		for _, params := range parameterizedTest.GetParameterTable() {
+			testName := GetParameterizedTestName(baseName, params)
+			if _, found := result[testName]; found {
+				return nil, stacktrace.NewError(
+					"Parameterized test '%v' expands to test '%v', but a test with that name already exists",
+					baseName,
+					testName)
+			}
+			result[testName] = parameterizedTest.CreateTest(params)
+		}
+	}
+	return result, nil
+}
+
+/*
+Gets the name of the test expanded from the given parameterized test base name with the given parameters, with the
+	parameters sorted by name, e.g. "consensus[nodes=7,variant=b]"
+ */
+func GetParameterizedTestName(baseName string, params TestParameters) string {
+	paramNames := make([]string, 0, len(params))
+	for paramName, _ := range params {
+		paramNames = append(paramNames, paramName)
+	}
+	sort.Strings(paramNames)
+
+	paramStrs := make([]string, 0, len(paramNames))
+	for _, paramName := range paramNames {
+		paramStrs = append(paramStrs, fmt.Sprintf("%v=%v", paramName, params[paramName]))
+	}
+	return fmt.Sprintf("%v[%v]", baseName, strings.Join(paramStrs, ","))
+}
+
+/*
+Builds a parameter table containing every combination of the given parameter values, e.g. {"nodes": ["4", "7"],
+	"variant": ["a", "b"]} produces the four rows nodes=4/variant=a, nodes=4/variant=b, nodes=7/variant=a, and
+	nodes=7/variant=b.
+ */
+func CrossProduct(paramValues map[string][]string) []TestParameters {
+	// We sort by parameter name so the table comes out in a normalized order
+	paramNames := make([]string, 0, len(paramValues))
+	for paramName, _ := range paramValues {
+		paramNames = append(paramNames, paramName)
+	}
+	sort.Strings(paramNames)
+
+	result := []TestParameters{{}}
+	for _, paramName := range paramNames {
+		expanded := []TestParameters{}
+		for _, row := range result {
+			for _, value := range paramValues[paramName] {
+				newRow := TestParameters{}
+				for existingName, existingValue := range row {
+					newRow[existingName] = existingValue
+				}
+				newRow[paramName] = value
+				expanded = append(expanded, newRow)
+			}
+		}
+		result = expanded
+	}
+	return result
+}
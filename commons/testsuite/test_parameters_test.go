@@ -0,0 +1,56 @@
+package testsuite
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/networks"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+type consensusTestForParameters struct {
+	params TestParameters
+}
+func (test consensusTestForParameters) Run(network networks.Network, context TestContext) {}
+func (test consensusTestForParameters) GetNetworkLoader() (networks.NetworkLoader, error) {
+	return nil, nil
+}
+func (test consensusTestForParameters) GetExecutionTimeout() time.Duration {
+	return time.Minute
+}
+func (test consensusTestForParameters) GetSetupBuffer() time.Duration {
+	return time.Minute
+}
+
+type consensusParameterizedTest struct {}
+func (test consensusParameterizedTest) GetParameterTable() []TestParameters {
+	return CrossProduct(map[string][]string{
+		"nodes": {"4", "7", "13"},
+		"variant": {"a", "b", "c"},
+	})
+}
+func (test consensusParameterizedTest) CreateTest(params TestParameters) Test {
+	return consensusTestForParameters{params: params}
+}
+
+type suiteForParameters struct {}
+func (suite suiteForParameters) GetTests() map[string]Test {
+	return map[string]Test{
+		"plainTest": consensusTestForParameters{},
+	}
+}
+func (suite suiteForParameters) GetParameterizedTests() map[string]ParameterizedTest {
+	return map[string]ParameterizedTest{
+		"consensus": consensusParameterizedTest{},
+	}
+}
+
+func TestGetAllTestsExpandsParameterizedTests(t *testing.T) {
+	allTests, err := GetAllTests(suiteForParameters{})
+	assert.NilError(t, err)
+	assert.Equal(t, 10, len(allTests))
+
+	test, found := allTests["consensus[nodes=7,variant=b]"]
+	assert.Assert(t, found)
+	assert.Equal(t, "7", test.(consensusTestForParameters).params["nodes"])
+	assert.Equal(t, "b", test.(consensusTestForParameters).params["variant"])
+}
@@ -7,3 +7,17 @@ type TestSuite interface {
 	// Get all the tests in the test suite; this is where users will "register" their tests
 	GetTests() map[string]Test
 }
+
+/*
+An optional interface that a TestSuite can additionally implement to run logic in the initializer once before any of the
+	suite's tests are started and once after all of them have finished (e.g. standing up or tearing down infrastructure
+	shared by every test). Because these run in the initializer rather than in a controller container, they don't have
+	access to any test network.
+ */
+type HookedTestSuite interface {
+	// Runs once before any tests are started; if this returns an error, no tests are run
+	BeforeAllTests() error
+
+	// Runs once after all tests have finished, even if some of them failed or BeforeAllTests returned an error
+	AfterAllTests() error
+}
@@ -46,6 +46,10 @@ type TestController struct {
 	// The name of the specific test this controller is responsible for running (since there's a 1:1 mapping between controller
 	// 	and test to execute
 	testName string
+
+	// The filepath on the controller image where the structured results of the test execution should be written, so
+	//  that the Kurtosis initializer can read them back
+	testResultsFilepath string
 }
 
 /*
@@ -65,6 +69,8 @@ Args:
 	testControllerIp: The IP address of the controller container itself
 	testSuite: A pre-defined set of tests that the user will choose to run a single test from
 	testName: The name of the test to run in the test suite
+	testResultsFilepath: The filepath where the structured results of the test execution (e.g. the steps the test ran)
+		will be written for the initializer to read
  */
 func NewTestController(
 			testVolumeName string,
@@ -74,16 +80,18 @@ func NewTestController(
 			gatewayIp string,
 			testControllerIp string,
 			testSuite testsuite.TestSuite,
-			testName string) *TestController {
+			testName string,
+			testResultsFilepath string) *TestController {
 	return &TestController{
-		testVolumeName:     testVolumeName,
-		testVolumeFilepath: testVolumeFilepath,
-		networkId:          networkId,
-		subnetMask:         subnetMask,
-		gatewayIp:          gatewayIp,
-		testControllerIp:   testControllerIp,
-		testSuite:          testSuite,
-		testName:           testName,
+		testVolumeName:      testVolumeName,
+		testVolumeFilepath:  testVolumeFilepath,
+		networkId:           networkId,
+		subnetMask:          subnetMask,
+		gatewayIp:           gatewayIp,
+		testControllerIp:    testControllerIp,
+		testSuite:           testSuite,
+		testName:            testName,
+		testResultsFilepath: testResultsFilepath,
 	}
 }
 
@@ -95,7 +103,13 @@ Returns:
 	testErr: Indicates an error in the test itself, indicating a test failure
  */
 func (controller TestController) RunTest() (setupErr error, testErr error) {
-	tests := controller.testSuite.GetTests()
+	testContext := testsuite.NewTestContext(controller.testName)
+	defer controller.writeTestExecutionResults(testContext)
+
+	tests, err := testsuite.GetAllTests(controller.testSuite)
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred getting the tests in the test suite"), nil
+	}
 	logrus.Debugf("Test configs: %v", tests)
 	test, found := tests[controller.testName]
 	if !found {
@@ -178,7 +192,7 @@ func (controller TestController) RunTest() (setupErr error, testErr error) {
 	testResultChan := make(chan error)
 
 	go func() {
-		testResultChan <- runTest(test, untypedNetwork)
+		testResultChan <- runTest(test, untypedNetwork, *testContext)
 	}()
 
 	// Time out the test so a poorly-written test doesn't run forever
@@ -202,23 +216,95 @@ func (controller TestController) RunTest() (setupErr error, testErr error) {
 
 	logrus.Info("Test execution completed")
 
+	// A hook that failed after the test skipped itself still fails the test, so the error takes priority over the skip
 	if testResultErr != nil {
 		return nil, stacktrace.Propagate(testResultErr, "An error occurred when running the test")
 	}
 
+	// The skip itself is reported via the execution results
+	if executionResults := testContext.GetExecutionResults(); executionResults.Skipped {
+		logrus.Infof("Test was skipped: %v", executionResults.SkipReason)
+	}
+
 	return nil, nil
 }
 
-// Little helper function meant to be run inside a goroutine that runs the test
-func runTest(test testsuite.Test, untypedNetwork interface{}) (resultErr error) {
+/*
+Writes the structured results that the test recorded on its context to the results file, so the initializer can read
+	them back. This is best-effort: a failure here is logged but doesn't affect the test result.
+ */
+func (controller TestController) writeTestExecutionResults(testContext *testsuite.TestContext) {
+	results := testContext.GetExecutionResults()
+	if err := results.WriteToFile(controller.testResultsFilepath); err != nil {
+		logrus.Error("An error occurred writing the test execution results; the initializer won't be able to report them")
+		fmt.Fprintln(logrus.StandardLogger().Out, err)
+	}
+}
+
+/*
+Little helper function meant to be run inside a goroutine that runs the test, wrapped in the test's hooks if it
+	implements HookedTest. A test that skips itself stops the same way a failing test does, but this doesn't return an
+	error for the skip itself - only for a hook that fails after it.
+ */
+func runTest(test testsuite.Test, untypedNetwork interface{}, testContext testsuite.TestContext) error {
+	hookedTest, hasHooks := test.(testsuite.HookedTest)
+	if !hasHooks {
+		testErr := runTestPhase("test", func() {
+			test.Run(untypedNetwork, testContext)
+		})
+		if testContext.GetExecutionResults().Skipped {
+			return nil
+		}
+		return testErr
+	}
+
+	var testErr error
+	if beforeRunErr := runTestPhase("BeforeRun hook", func() {
+		hookedTest.BeforeRun(untypedNetwork, testContext)
+	}); beforeRunErr != nil {
+		testErr = stacktrace.Propagate(beforeRunErr, "The test's BeforeRun hook failed")
+	} else if !testContext.GetExecutionResults().Skipped {
+		testErr = runTestPhase("test", func() {
+			test.Run(untypedNetwork, testContext)
+		})
+	}
+
+	// A skip isn't a failure, so neither the AfterRun hook nor the test result should treat it as one
+	if testContext.GetExecutionResults().Skipped {
+		testErr = nil
+	}
+	afterRunErr := runTestPhase("AfterRun hook", func() {
+		hookedTest.AfterRun(untypedNetwork, testContext, testErr)
+	})
+	if afterRunErr == nil {
+		return testErr
+	}
+	if testErr != nil {
+		// The original failure is the more useful one to report, so we only log the hook failure
+		logrus.Error("The AfterRun hook also failed:")
+		fmt.Fprintln(logrus.StandardLogger().Out, afterRunErr)
+		return testErr
+	}
+	return stacktrace.Propagate(afterRunErr, "The test's AfterRun hook failed")
+}
+
+/*
+Runs a single phase of the test (e.g. the test itself or one of its hooks), converting a panic (which is how the
+	TestContext reports failures) into an error
+ */
+func runTestPhase(phaseName string, phase func()) (resultErr error) {
 	// See https://medium.com/@hussachai/error-handling-in-go-a-quick-opinionated-guide-9199dd7c7f76 for details
 	defer func() {
 		if recoverResult := recover(); recoverResult != nil {
-			logrus.Tracef("Caught panic while running test: %v", recoverResult)
-			resultErr = recoverResult.(error)
+			logrus.Tracef("Caught panic while running %v: %v", phaseName, recoverResult)
+			if recoverErr, ok := recoverResult.(error); ok {
+				resultErr = recoverErr
+			} else {
+				resultErr = stacktrace.NewError("Panicked while running %v: %v", phaseName, recoverResult)
+			}
 		}
 	}()
-	test.Run(untypedNetwork, testsuite.TestContext{})
-	logrus.Tracef("Test completed successfully")
+	phase()
+	logrus.Tracef("Completed %v successfully", phaseName)
 	return
 }
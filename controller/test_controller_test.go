@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/networks"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+type hookedTestForTesting struct {
+	failBeforeRun bool
+	failRun bool
+	failAfterRun bool
+	skipInRun bool
+
+	calls []string
+	afterRunTestErr error
+}
+
+func (test *hookedTestForTesting) BeforeRun(network networks.Network, context testsuite.TestContext) {
+	test.calls = append(test.calls, "BeforeRun")
+	context.AssertTrue(!test.failBeforeRun, stacktrace.NewError("BeforeRun failed"))
+}
+
+func (test *hookedTestForTesting) Run(network networks.Network, context testsuite.TestContext) {
+	test.calls = append(test.calls, "Run")
+	if test.skipInRun {
+		context.Skip("Skipped for testing")
+	}
+	context.AssertTrue(!test.failRun, stacktrace.NewError("Run failed"))
+}
+
+func (test *hookedTestForTesting) AfterRun(network networks.Network, context testsuite.TestContext, testErr error) {
+	test.calls = append(test.calls, "AfterRun")
+	test.afterRunTestErr = testErr
+	context.AssertTrue(!test.failAfterRun, stacktrace.NewError("AfterRun failed"))
+}
+
+func (test *hookedTestForTesting) GetNetworkLoader() (networks.NetworkLoader, error) {
+	return nil, nil
+}
+
+func (test *hookedTestForTesting) GetExecutionTimeout() time.Duration {
+	return time.Minute
+}
+
+func (test *hookedTestForTesting) GetSetupBuffer() time.Duration {
+	return time.Minute
+}
+
+func TestRunTestCallsHooksInOrder(t *testing.T) {
+	test := &hookedTestForTesting{}
+	err := runTest(test, nil, *testsuite.NewTestContext("test"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"BeforeRun", "Run", "AfterRun"}, test.calls)
+	assert.NilError(t, test.afterRunTestErr)
+}
+
+func TestRunTestCallsAfterRunWhenRunFails(t *testing.T) {
+	test := &hookedTestForTesting{failRun: true}
+	err := runTest(test, nil, *testsuite.NewTestContext("test"))
+	assert.Assert(t, err != nil)
+	assert.DeepEqual(t, []string{"BeforeRun", "Run", "AfterRun"}, test.calls)
+	assert.Assert(t, test.afterRunTestErr != nil)
+}
+
+func TestRunTestSkipsRunWhenBeforeRunFails(t *testing.T) {
+	test := &hookedTestForTesting{failBeforeRun: true}
+	err := runTest(test, nil, *testsuite.NewTestContext("test"))
+	assert.Assert(t, err != nil)
+	assert.DeepEqual(t, []string{"BeforeRun", "AfterRun"}, test.calls)
+	assert.Assert(t, test.afterRunTestErr != nil)
+}
+
+func TestRunTestFailsWhenAfterRunFails(t *testing.T) {
+	test := &hookedTestForTesting{failAfterRun: true}
+	err := runTest(test, nil, *testsuite.NewTestContext("test"))
+	assert.Assert(t, err != nil)
+	assert.DeepEqual(t, []string{"BeforeRun", "Run", "AfterRun"}, test.calls)
+}
+
+func TestRunTestSkipIsNotAnError(t *testing.T) {
+	test := &hookedTestForTesting{skipInRun: true}
+	testContext := testsuite.NewTestContext("test")
+	err := runTest(test, nil, *testContext)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"BeforeRun", "Run", "AfterRun"}, test.calls)
+	assert.NilError(t, test.afterRunTestErr)
+	assert.Assert(t, testContext.GetExecutionResults().Skipped)
+}
+
+func TestRunTestFailsWhenAfterRunFailsAfterSkip(t *testing.T) {
+	test := &hookedTestForTesting{skipInRun: true, failAfterRun: true}
+	testContext := testsuite.NewTestContext("test")
+	err := runTest(test, nil, *testContext)
+	assert.ErrorContains(t, err, "AfterRun hook failed")
+	assert.Assert(t, testContext.GetExecutionResults().Skipped)
+}
@@ -0,0 +1,56 @@
+package parallelism
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"io"
+)
+
+const (
+	// Structured test log entries can carry arbitrarily-large fields, so we allow for long lines when reading controller logs
+	maxControllerLogLineBytes = 10 * 1024 * 1024
+)
+
+/*
+Copies the logs of a test controller to the given output, rendering any structured test log entries (those logged via the
+	TestContext's logger) in a human-readable format and dropping the ones that are less severe than the given level. All
+	other controller output is copied as-is.
+
+Args:
+	out: The writer to copy the rendered logs to
+	controllerLogs: The raw logs of the test controller
+	minStructuredLogLevel: The least severe level of structured test log entry that will be rendered (e.g. Warn will only
+		render Warn, Error, Fatal, and Panic entries)
+
+Returns:
+	int: The number of structured test log entries that were dropped for being below the minimum level
+	error: If an error occurred reading or writing the logs
+ */
+func renderControllerLogs(out io.Writer, controllerLogs io.Reader, minStructuredLogLevel logrus.Level) (int, error) {
+	scanner := bufio.NewScanner(controllerLogs)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxControllerLogLineBytes)
+
+	numDroppedEntries := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		entry, isStructured := testsuite.ParseTestLogEntry(line)
+		if isStructured {
+			// Logrus levels get less severe as they increase
+			if entry.Level > minStructuredLogLevel {
+				numDroppedEntries++
+				continue
+			}
+			line = entry.Format()
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return numDroppedEntries, stacktrace.Propagate(err, "An error occurred writing a controller log line")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return numDroppedEntries, stacktrace.Propagate(err, "An error occurred reading the controller logs")
+	}
+	return numDroppedEntries, nil
+}
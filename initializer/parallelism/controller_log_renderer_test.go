@@ -0,0 +1,32 @@
+package parallelism
+
+import (
+	"bytes"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+	"strings"
+	"testing"
+)
+
+func TestRenderControllerLogs(t *testing.T) {
+	var controllerLogs bytes.Buffer
+	controllerLogs.WriteString("Plain controller output\n")
+
+	originalOut := logrus.StandardLogger().Out
+	logrus.SetOutput(&controllerLogs)
+	defer logrus.SetOutput(originalOut)
+	context := testsuite.NewTestContext("myTest")
+	context.Logger().WithField("node", "node3").Warn("Leader still reachable")
+	context.Logf("Some detail")
+
+	var rendered bytes.Buffer
+	numDropped, err := renderControllerLogs(&rendered, &controllerLogs, logrus.WarnLevel)
+	assert.NilError(t, err)
+	assert.Equal(t, numDropped, 1, "Expected the info-level entry to be dropped")
+
+	lines := strings.Split(strings.TrimSpace(rendered.String()), "\n")
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, lines[0], "Plain controller output")
+	assert.Assert(t, strings.Contains(lines[1], "WARNING Leader still reachable node=node3"), "Unexpected rendered line: %v", lines[1])
+}
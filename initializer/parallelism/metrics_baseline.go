@@ -0,0 +1,133 @@
+package parallelism
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"io/ioutil"
+	"math"
+)
+
+/*
+The expected value of a single metric, as declared in the metrics baseline file
+ */
+type MetricBaselineValue struct {
+	// The expected value of the metric
+	Value float64 `json:"value"`
+
+	// True if larger values are better for this metric (e.g. throughput), false if smaller values are better (e.g. latency)
+	HigherIsBetter bool `json:"higherIsBetter"`
+
+	// How far, as a percentage of the baseline value, the metric may regress before the run fails; if not set, the
+	//  baseline-wide default is used
+	MaxRegressionPercent *float64 `json:"maxRegressionPercent,omitempty"`
+}
+
+/*
+The expected values of test metrics, against which the metrics recorded during a run are compared so that performance
+	regressions fail the run. The file looks like:
+
+	{
+		"defaultMaxRegressionPercent": 10,
+		"tests": {
+			"myTest": {
+				"throughput": {"value": 1000, "higherIsBetter": true},
+				"p99Latency": {"value": 25, "maxRegressionPercent": 20}
+			}
+		}
+	}
+ */
+type MetricsBaseline struct {
+	// How far, as a percentage of the baseline value, a metric may regress before the run fails (unless overridden for
+	//  the metric)
+	DefaultMaxRegressionPercent float64 `json:"defaultMaxRegressionPercent"`
+
+	// Mapping of test name -> metric name -> expected value
+	Tests map[string]map[string]MetricBaselineValue `json:"tests"`
+}
+
+/*
+Package struct describing a metric that regressed beyond its allowed threshold
+ */
+type metricRegression struct {
+	MetricName string `json:"metricName"`
+	BaselineValue float64 `json:"baselineValue"`
+	ActualValue float64 `json:"actualValue"`
+
+	// How much worse the actual value is than the baseline, as a percentage of the baseline
+	RegressionPercent float64 `json:"regressionPercent"`
+	MaxRegressionPercent float64 `json:"maxRegressionPercent"`
+}
+
+func (regression metricRegression) String() string {
+	return fmt.Sprintf(
+		"%v regressed %.2f%% (allowed: %.2f%%); baseline: %v, actual: %v",
+		regression.MetricName,
+		regression.RegressionPercent,
+		regression.MaxRegressionPercent,
+		regression.BaselineValue,
+		regression.ActualValue)
+}
+
+/*
+Loads the metrics baseline from the given JSON file
+ */
+func LoadMetricsBaseline(filepath string) (*MetricsBaseline, error) {
+	baselineBytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred reading the metrics baseline file %v", filepath)
+	}
+	var baseline MetricsBaseline
+	if err := json.Unmarshal(baselineBytes, &baseline); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred parsing the metrics baseline file %v", filepath)
+	}
+	return &baseline, nil
+}
+
+/*
+Compares the given metrics recorded by a test against the baseline, returning the metrics that regressed beyond their
+	allowed threshold. Metrics without a baseline value are ignored, as are baseline values for metrics the test didn't record
+	and baseline values of zero (which can't be compared by percentage).
+ */
+func (baseline MetricsBaseline) findRegressions(testName string, metrics []testsuite.MetricResult) []metricRegression {
+	result := []metricRegression{}
+	testBaseline, found := baseline.Tests[testName]
+	if !found {
+		return result
+	}
+
+	for _, metric := range metrics {
+		baselineValue, found := testBaseline[metric.Name]
+		if !found || baselineValue.Value == 0 {
+			continue
+		}
+
+		maxRegressionPercent := baseline.DefaultMaxRegressionPercent
+		if baselineValue.MaxRegressionPercent != nil {
+			maxRegressionPercent = *baselineValue.MaxRegressionPercent
+		}
+
+		var worsening float64
+		if baselineValue.HigherIsBetter {
+			worsening = baselineValue.Value - metric.Value
+		} else {
+			worsening = metric.Value - baselineValue.Value
+		}
+		if worsening <= 0 {
+			continue
+		}
+
+		regressionPercent := worsening / math.Abs(baselineValue.Value) * 100
+		if regressionPercent > maxRegressionPercent {
+			result = append(result, metricRegression{
+				MetricName:           metric.Name,
+				BaselineValue:        baselineValue.Value,
+				ActualValue:          metric.Value,
+				RegressionPercent:    regressionPercent,
+				MaxRegressionPercent: maxRegressionPercent,
+			})
+		}
+	}
+	return result
+}
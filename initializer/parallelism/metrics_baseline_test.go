@@ -0,0 +1,33 @@
+package parallelism
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestFindRegressions(t *testing.T) {
+	latencyThreshold := 50.0
+	baseline := MetricsBaseline{
+		DefaultMaxRegressionPercent: 10,
+		Tests: map[string]map[string]MetricBaselineValue{
+			"myTest": {
+				"throughput": {Value: 1000, HigherIsBetter: true},
+				"p99Latency": {Value: 20, MaxRegressionPercent: &latencyThreshold},
+				"errors": {Value: 5},
+			},
+		},
+	}
+
+	metrics := []testsuite.MetricResult{
+		{Name: "throughput", Value: 850, Unit: "req/s"}, // 15% worse, over the default threshold
+		{Name: "p99Latency", Value: 28, Unit: "ms"},     // 40% worse, under the overridden threshold
+		{Name: "errors", Value: 1, Unit: "count"},       // Improved
+		{Name: "unknown", Value: 1, Unit: "count"},      // No baseline
+	}
+	regressions := baseline.findRegressions("myTest", metrics)
+	assert.Equal(t, len(regressions), 1)
+	assert.Equal(t, regressions[0].MetricName, "throughput")
+
+	assert.Equal(t, len(baseline.findRegressions("otherTest", metrics)), 0, "Expected no regressions for a test with no baseline")
+}
@@ -2,10 +2,13 @@ package parallelism
 
 import (
 	"fmt"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
 	"io"
+	"sort"
 	"sync"
+	"time"
 )
 
 // =============================== "enum" for test result =========================================
@@ -14,6 +17,18 @@ const (
 	PASSED  testStatus = "PASSED"
 	FAILED  testStatus = "FAILED"
 	ERRORED testStatus = "ERRORED" // Indicates an error during setup that prevented the test from running
+	SKIPPED testStatus = "SKIPPED" // Indicates the test decided it couldn't run in the current environment
+
+	// Indicates the test passed, but some of its metrics regressed beyond their allowed thresholds against the metrics
+	//  baseline, which fails the run like a test failure does
+	REGRESSED testStatus = "REGRESSED"
+
+	// Indicate that a quarantined test passed or didn't pass (failed, errored, or regressed), neither of which affect
+	//  whether the test suite execution passes
+	QUARANTINED_PASSED testStatus = "QUARANTINED-PASSED"
+	QUARANTINED_FAILED testStatus = "QUARANTINED-FAILED"
+
+	NOT_RUN testStatus = "NOT-RUN" // Indicates the test was never started, e.g. because the execution was halted early
 )
 
 // =============================== Parallel Test Output =========================================
@@ -24,11 +39,39 @@ type parallelTestOutput struct {
 	// Name of the test that was run
 	testName string
 
+	// Which run of the test this was (1-indexed), when tests are being run multiple times to detect flakiness
+	iteration uint
+
+	// Indicates that the test was never started, because the execution was halted early (e.g. by fail-fast) or because
+	//  it couldn't have finished before the execution deadline
+	notRun bool
+
+	// Why the test was never started, if it wasn't for the reason the execution was halted (empty otherwise)
+	notRunReason string
+
 	// Indicates whether an error occurred during the execution of the test that prevented it from running
 	executionErr error
 
 	// Indicates whether the test passed or failed (undefined if the test had a setup error)
 	testPassed bool
+
+	// How long the test took to run, including setup, teardown, and any retries
+	duration time.Duration
+
+	// The transient errors that earlier attempts at running the test ERRORED with, in order (empty if the test wasn't retried)
+	retriedErrors []error
+
+	// The structured results that the test's controller reported (nil if the controller didn't report any)
+	executionResults *testsuite.TestExecutionResults
+
+	// The metrics that regressed beyond their allowed threshold compared to the metrics baseline
+	metricRegressions []metricRegression
+
+	// Whether the test is quarantined, meaning that its failures don't fail the test suite execution
+	quarantined bool
+
+	// Why the test is quarantined (may be empty)
+	quarantineReason string
 }
 
 // ================================ Output Manager ==================================================
@@ -38,6 +81,14 @@ const (
 	logErroneousSystemLogsAsError = true
 )
 
+/*
+Key identifying a single run of a test in the output manager
+ */
+type testOutputKey struct {
+	testName string
+	iteration uint
+}
+
 /*
 A SINGLE-USE struct for managing the output of tests during parallel execution, such that:
 - Once activated, any system logs will get captured by the given interceptor (system logging should never be used while parallel test execution is happening)
@@ -65,47 +116,73 @@ type ParallelTestOutputManager struct {
 	sideChannelLogger	   *logrus.Logger
 
 	// Captures all test output sent through the output manager
-	testOutputs  		   map[string]parallelTestOutput
+	testOutputs  		   map[testOutputKey]parallelTestOutput
+
+	// The baseline that the metrics recorded by tests are compared against (nil if no comparison should be done)
+	metricsBaseline        *MetricsBaseline
+
+	// How many times each test is being run (unboundedNumIterations if tests are run until they fail); if more than once,
+	//  the logs of passing iterations are hidden and the summary shows each test's pass rate
+	numIterations          uint
+
+	// Mapping of quarantined test name -> reason the test is quarantined
+	quarantinedTests       map[string]string
 }
 
 /*
 Creates a new output manager to handle the display of parallel test results.
+
+Args:
+	metricsBaseline: The baseline that test metrics will be compared against, with regressions failing the run (nil
+		to skip the comparison)
+	numIterations: How many times each test is being run (unboundedNumIterations if tests are run until they fail)
+	quarantinedTests: Mapping of quarantined test name -> reason the test is quarantined
  */
-func newParallelTestOutputManager() *ParallelTestOutputManager {
+func newParallelTestOutputManager(
+			metricsBaseline *MetricsBaseline,
+			numIterations uint,
+			quarantinedTests map[string]string) *ParallelTestOutputManager {
 	return &ParallelTestOutputManager{
 		interceptor:             newErroneousSystemLogCaptureWriter(),
 		writerBeforeManagement:  nil,
 		isInterceptingStdLogger: false,
 		mutex:                   &sync.Mutex{},
 		sideChannelLogger:       nil,
-		testOutputs:             make(map[string]parallelTestOutput),
+		testOutputs:             make(map[testOutputKey]parallelTestOutput),
+		metricsBaseline:         metricsBaseline,
+		numIterations:           numIterations,
+		quarantinedTests:        quarantinedTests,
 	}
 }
 
 /*
 Thread-safe method to log test output, to provide parallel tests a way to print their log messages in real time as
 	they finish.
+
+Args:
+	output: The output of a single run of a test (any metric regressions and quarantine info will be filled in by the
+		output manager)
+	testLogs: The logs of the test run
  */
-func (manager *ParallelTestOutputManager) logTestOutput(
-			testName string,
-			executionErr error,
-			testPassed bool,
-			testLogs io.Reader) {
+func (manager *ParallelTestOutputManager) logTestOutput(output parallelTestOutput, testLogs io.Reader) {
 	manager.mutex.Lock()
 	defer manager.mutex.Unlock()
 
-	if _, found := manager.testOutputs[testName]; found {
+	testName := output.testName
+	key := testOutputKey{testName: testName, iteration: output.iteration}
+	if _, found := manager.testOutputs[key]; found {
 		// We hijack whatever the actual test output was to ensure that the user gets notification of the test failing
-		executionErr = stacktrace.NewError(
+		output.executionErr = stacktrace.NewError(
 			"Test %v is logged twice, indicating that it was run twice! This is a bug in Kurtosis that should be fixed!",
-			testName)
-		testPassed = false
+			formatTestIterationName(testName, output.iteration, manager.numIterations))
+		output.testPassed = false
 	}
-	manager.testOutputs[testName] = parallelTestOutput{
-		testName:     testName,
-		executionErr: executionErr,
-		testPassed:   testPassed,
+	output.metricRegressions = []metricRegression{}
+	if manager.metricsBaseline != nil && output.executionResults != nil {
+		output.metricRegressions = manager.metricsBaseline.findRegressions(testName, output.executionResults.Metrics)
 	}
+	output.quarantineReason, output.quarantined = manager.quarantinedTests[testName]
+	manager.testOutputs[key] = output
 
 	var outputLogger *logrus.Logger
 	if !manager.isInterceptingStdLogger {
@@ -114,22 +191,79 @@ func (manager *ParallelTestOutputManager) logTestOutput(
 		outputLogger = manager.sideChannelLogger
 	}
 
-	printBanner(outputLogger, testName, logTestNameBannerAsError)
-	_, err := io.Copy(outputLogger.Out, testLogs)
-	if err != nil {
-		outputLogger.Error("An error occurred copying the test's logfile to STDOUT; the logs above may not be complete!")
-		fmt.Fprintln(outputLogger.Out, err) // Logrus will escape newlines so we don't actually log this
+	displayName := formatTestIterationName(testName, output.iteration, manager.numIterations)
+	printBanner(outputLogger, displayName, logTestNameBannerAsError)
+	if isRunRepeatedly(manager.numIterations) && isPassingOutput(output) {
+		// When tests are repeated to find flakiness, only the logs of the failing iterations are interesting
+		outputLogger.Info("Logs of passing iterations aren't shown when tests are run multiple times")
+	} else {
+		_, err := io.Copy(outputLogger.Out, testLogs)
+		if err != nil {
+			outputLogger.Error("An error occurred copying the test's logfile to STDOUT; the logs above may not be complete!")
+			fmt.Fprintln(outputLogger.Out, err) // Logrus will escape newlines so we don't actually log this
+		}
 	}
 
-	status := getTestStatusFromResult(executionErr, testPassed)
+	logStepBreakdown(outputLogger, output.executionResults)
+	logMetrics(outputLogger, output.executionResults, output.metricRegressions)
+
+	status := getTestStatus(output)
 	switch status {
 	case ERRORED:
-		outputLogger.Errorf("Test %v %v", testName, status)
-		outputLogger.Errorf("Error reason: %v", executionErr)
+		outputLogger.Errorf("Test %v %v", displayName, status)
+		outputLogger.Errorf("Error reason: %v", output.executionErr)
 	case PASSED:
-		outputLogger.Infof("Test %v %v", testName, status)
+		if len(output.retriedErrors) > 0 {
+			outputLogger.Warnf("Test %v %v after %v", displayName, status, formatRetries(len(output.retriedErrors)))
+		} else {
+			outputLogger.Infof("Test %v %v", displayName, status)
+		}
 	case FAILED:
-		outputLogger.Errorf("Test %v %v", testName, status)
+		outputLogger.Errorf("Test %v %v", displayName, status)
+	case REGRESSED:
+		outputLogger.Errorf("Test %v %v", displayName, status)
+		outputLogger.Errorf("The test passed, but its metrics regressed against the baseline")
+	case SKIPPED:
+		outputLogger.Infof("Test %v %v", displayName, status)
+		outputLogger.Infof("Skip reason: %v", output.executionResults.SkipReason)
+	case QUARANTINED_PASSED:
+		outputLogger.Infof("Test %v %v", displayName, status)
+	case QUARANTINED_FAILED:
+		outputLogger.Warnf("Test %v %v", displayName, status)
+		if output.executionErr != nil {
+			outputLogger.Warnf("Error reason: %v", output.executionErr)
+		}
+		outputLogger.Warn("The test is quarantined, so this won't fail the run")
+	}
+}
+
+/*
+Thread-safe method to record that a test was never started, e.g. because the execution was halted early. Unlike
+	logTestOutput, this doesn't print anything, since there's nothing to show until the summary.
+
+Args:
+	testName: The name of the test that wasn't started
+	iteration: Which iteration of the test wasn't started
+	reason: Why the test wasn't started, to show in the summary (empty if it's because the execution was halted, whose
+		reason is shown separately)
+ */
+func (manager *ParallelTestOutputManager) logNotRunTest(testName string, iteration uint, reason string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	key := testOutputKey{testName: testName, iteration: iteration}
+	if _, found := manager.testOutputs[key]; found {
+		return
+	}
+	quarantineReason, isQuarantined := manager.quarantinedTests[testName]
+	manager.testOutputs[key] = parallelTestOutput{
+		testName:          testName,
+		iteration:         iteration,
+		notRun:            true,
+		notRunReason:      reason,
+		metricRegressions: []metricRegression{},
+		quarantined:       isQuarantined,
+		quarantineReason:  quarantineReason,
 	}
 }
 
@@ -182,12 +316,6 @@ func (manager *ParallelTestOutputManager) printSummary() {
 	manager.mutex.Lock()
 	manager.mutex.Unlock()
 
-	// We sort tests by name because we want normalized output between runs of the suite
-	testPrintOrder := []string{}
-	for testName, _ := range manager.testOutputs {
-		testPrintOrder = append(testPrintOrder, testName)
-	}
-
 	var outputLogger *logrus.Logger
 	if !manager.isInterceptingStdLogger {
 		outputLogger = logrus.StandardLogger()
@@ -196,17 +324,12 @@ func (manager *ParallelTestOutputManager) printSummary() {
 	}
 
 	printBanner(outputLogger, "TEST RESULTS", logAllTestResultsAsError)
-	for _, testName := range testPrintOrder {
-		output := manager.testOutputs[testName]
-		passed := output.testPassed
-		executionErr := output.executionErr
-		status := getTestStatusFromResult(executionErr, passed)
-
-		logStr := fmt.Sprintf("- %v: %v", testName, status)
-		if status == ERRORED || status == FAILED {
-			outputLogger.Error(logStr)
+	// We sort tests by name because we want normalized output between runs of the suite
+	for _, testOutputs := range getTestOutputsByTestName(manager.testOutputs) {
+		if isRunRepeatedly(manager.numIterations) {
+			logTestIterationsSummary(outputLogger, testOutputs, manager.numIterations)
 		} else {
-			outputLogger.Info(logStr)
+			logTestSummary(outputLogger, testOutputs[0])
 		}
 	}
 
@@ -223,12 +346,42 @@ func (manager *ParallelTestOutputManager) getAllTestsPassed() bool {
 
 	allTestsPassed := true
 	for _, output := range manager.testOutputs {
-		testHadNoIssues := PASSED == getTestStatusFromResult(output.executionErr, output.testPassed)
-		allTestsPassed = allTestsPassed && testHadNoIssues
+		// Quarantined tests are still run so we know how they're doing, but they can't fail the run
+		allTestsPassed = allTestsPassed && (isPassingOutput(output) || output.quarantined)
 	}
 	return allTestsPassed
 }
 
+/*
+Gets how long each test took, for the tests that ran to completion on their first attempt (the durations of tests that
+	were skipped, errored, or retried don't reflect how long the test actually takes). If a test was run multiple
+	times, the mean duration of its iterations is used.
+
+Returns:
+	Mapping of test name -> duration
+ */
+func (manager *ParallelTestOutputManager) getCompletedTestDurations() map[string]time.Duration {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	totalDurations := map[string]time.Duration{}
+	numCompletedRuns := map[string]int64{}
+	for _, output := range manager.testOutputs {
+		isSkipped := output.executionResults != nil && output.executionResults.Skipped
+		if output.notRun || output.executionErr != nil || isSkipped || len(output.retriedErrors) > 0 {
+			continue
+		}
+		totalDurations[output.testName] += output.duration
+		numCompletedRuns[output.testName]++
+	}
+
+	result := map[string]time.Duration{}
+	for testName, totalDuration := range totalDurations {
+		result[testName] = time.Duration(int64(totalDuration) / numCompletedRuns[testName])
+	}
+	return result
+}
+
 // ================================== Private helper messages ==========================================
 func printBanner(log *logrus.Logger, contents string, isError bool) {
 	bannerString := "=================================================================================================="
@@ -260,6 +413,271 @@ func getTestStatusFromResult(executionErr error, testPassed bool) testStatus {
 	return result
 }
 
+/*
+Whether a run of a test had no issues (skipped tests didn't fail, so they count as passing). NOTE: this doesn't
+	take quarantine into account, so a quarantined test that failed doesn't count as passing.
+ */
+func isPassingOutput(output parallelTestOutput) bool {
+	status := getTestStatus(output)
+	return (status == PASSED || status == SKIPPED || status == QUARANTINED_PASSED) && len(output.metricRegressions) == 0
+}
+
+/*
+Gets the name to display for a run of a test, which includes the iteration if tests are being run multiple times
+ */
+func formatTestIterationName(testName string, iteration uint, numIterations uint) string {
+	if !isRunRepeatedly(numIterations) {
+		return testName
+	}
+	if numIterations == unboundedNumIterations {
+		return fmt.Sprintf("%v (iteration %v)", testName, iteration)
+	}
+	return fmt.Sprintf("%v (iteration %v of %v)", testName, iteration, numIterations)
+}
+
+/*
+Whether each test is being run more than once, given how many times each test is being run
+ */
+func isRunRepeatedly(numIterations uint) bool {
+	return numIterations == unboundedNumIterations || numIterations > 1
+}
+
+/*
+Groups the given test outputs by test name, returning the groups sorted by test name with each group's outputs sorted
+	by iteration
+ */
+func getTestOutputsByTestName(testOutputs map[testOutputKey]parallelTestOutput) [][]parallelTestOutput {
+	outputsByTestName := map[string][]parallelTestOutput{}
+	for _, output := range testOutputs {
+		outputsByTestName[output.testName] = append(outputsByTestName[output.testName], output)
+	}
+
+	testNames := make([]string, 0, len(outputsByTestName))
+	for testName, _ := range outputsByTestName {
+		testNames = append(testNames, testName)
+	}
+	sort.Strings(testNames)
+
+	result := [][]parallelTestOutput{}
+	for _, testName := range testNames {
+		outputs := outputsByTestName[testName]
+		sort.Slice(outputs, func(i, j int) bool {
+			return outputs[i].iteration < outputs[j].iteration
+		})
+		result = append(result, outputs)
+	}
+	return result
+}
+
+/*
+Helper function to print the summary line of a test that was run once, followed by its steps, metrics, and regressions
+ */
+func logTestSummary(log *logrus.Logger, output parallelTestOutput) {
+	status := getTestStatus(output)
+
+	logStr := fmt.Sprintf("- %v: %v", output.testName, status)
+	if failedStepName, found := getFailedStepName(output.executionResults); found && (status == FAILED || status == QUARANTINED_FAILED) {
+		logStr = fmt.Sprintf("%v (in step '%v')", logStr, failedStepName)
+	}
+	if output.quarantined && output.quarantineReason != "" {
+		logStr = fmt.Sprintf("%v (quarantined: %v)", logStr, output.quarantineReason)
+	}
+	if status == SKIPPED {
+		logStr = fmt.Sprintf("%v (%v)", logStr, output.executionResults.SkipReason)
+	}
+	if status == NOT_RUN && output.notRunReason != "" {
+		logStr = fmt.Sprintf("%v (%v)", logStr, output.notRunReason)
+	}
+	if len(output.retriedErrors) > 0 {
+		logStr = fmt.Sprintf("%v (after %v)", logStr, formatRetries(len(output.retriedErrors)))
+	}
+	if status == ERRORED || status == FAILED || status == REGRESSED || status == NOT_RUN {
+		log.Error(logStr)
+	} else if status == QUARANTINED_FAILED || len(output.retriedErrors) > 0 {
+		log.Warn(logStr)
+	} else {
+		log.Info(logStr)
+	}
+	if output.executionResults != nil {
+		for _, stepResult := range output.executionResults.Steps {
+			log.Infof("    %v", formatStepResult(stepResult))
+		}
+		for _, metric := range output.executionResults.Metrics {
+			log.Infof("    %v", formatMetric(metric))
+		}
+	}
+	for _, regression := range output.metricRegressions {
+		if output.quarantined {
+			log.Warnf("    METRIC REGRESSION: %v", regression)
+		} else {
+			log.Errorf("    METRIC REGRESSION: %v", regression)
+		}
+	}
+}
+
+/*
+Helper function to print the pass rate of a test that was run multiple times, followed by the iterations that didn't pass
+
+Args:
+	log: The logger to print to
+	outputs: The outputs of all the iterations of the test that were run, sorted by iteration
+	numIterations: How many iterations of the test were requested (unboundedNumIterations if it was run until it failed)
+ */
+func logTestIterationsSummary(log *logrus.Logger, allOutputs []parallelTestOutput, numIterations uint) {
+	// Iterations that were never started are covered by the count of iterations not run
+	outputs := []parallelTestOutput{}
+	for _, output := range allOutputs {
+		if !output.notRun {
+			outputs = append(outputs, output)
+		}
+	}
+	if len(outputs) == 0 {
+		logTestSummary(log, allOutputs[0])
+		return
+	}
+
+	testName := outputs[0].testName
+	numPassed := 0
+	allSkipped := true
+	for _, output := range outputs {
+		if isPassingOutput(output) {
+			numPassed++
+		}
+		allSkipped = allSkipped && getTestStatus(output) == SKIPPED
+	}
+	if allSkipped {
+		log.Infof("- %v: %v (%v)", testName, SKIPPED, outputs[0].executionResults.SkipReason)
+		return
+	}
+
+	numRun := len(outputs)
+	passRatePercent := 100 * float64(numPassed) / float64(numRun)
+	logStr := fmt.Sprintf("- %v: %v/%v iterations passed (%.1f%%)", testName, numPassed, numRun, passRatePercent)
+	if numIterations != unboundedNumIterations && uint(numRun) < numIterations {
+		logStr = fmt.Sprintf("%v, %v iterations not run", logStr, numIterations - uint(numRun))
+	}
+	// The iterations of a quarantined test can't fail the run, so we only warn about them
+	isQuarantined := outputs[0].quarantined
+	failureLogFunc := log.Error
+	if isQuarantined {
+		logStr = fmt.Sprintf("%v [quarantined]", logStr)
+		failureLogFunc = log.Warn
+	}
+	if numPassed < numRun {
+		failureLogFunc(logStr)
+	} else {
+		log.Info(logStr)
+	}
+
+	for _, output := range outputs {
+		if isPassingOutput(output) {
+			continue
+		}
+		status := getTestStatus(output)
+		iterationStr := fmt.Sprintf("    iteration %v: %v", output.iteration, status)
+		if failedStepName, found := getFailedStepName(output.executionResults); found && (status == FAILED || status == QUARANTINED_FAILED) {
+			iterationStr = fmt.Sprintf("%v (in step '%v')", iterationStr, failedStepName)
+		}
+		failureLogFunc(iterationStr)
+		for _, regression := range output.metricRegressions {
+			failureLogFunc(fmt.Sprintf("        METRIC REGRESSION: %v", regression))
+		}
+	}
+}
+
+/*
+Gets the status of a logged test, taking into account whether the test was skipped, is quarantined, or had metrics regress
+ */
+func getTestStatus(output parallelTestOutput) testStatus {
+	if output.notRun {
+		return NOT_RUN
+	}
+	status := getTestStatusFromResult(output.executionErr, output.testPassed)
+	// Only a test that otherwise passed counts as skipped, so that e.g. a hook failing after a skip still fails the test
+	if status == PASSED && output.executionResults != nil && output.executionResults.Skipped {
+		return SKIPPED
+	}
+	if output.quarantined {
+		if status == PASSED && len(output.metricRegressions) == 0 {
+			return QUARANTINED_PASSED
+		}
+		return QUARANTINED_FAILED
+	}
+	if status == PASSED && len(output.metricRegressions) > 0 {
+		return REGRESSED
+	}
+	return status
+}
+
+/*
+Helper function to print the breakdown of the steps a test ran (if any), with their timings
+ */
+func logStepBreakdown(log *logrus.Logger, executionResults *testsuite.TestExecutionResults) {
+	if executionResults == nil || len(executionResults.Steps) == 0 {
+		return
+	}
+
+	log.Info("Steps:")
+	for _, stepResult := range executionResults.Steps {
+		logStr := fmt.Sprintf("  - %v", formatStepResult(stepResult))
+		if stepResult.Status == testsuite.STEP_PASSED {
+			log.Info(logStr)
+		} else {
+			log.Error(logStr)
+		}
+	}
+}
+
+func formatStepResult(stepResult testsuite.StepResult) string {
+	return fmt.Sprintf("%v: %v (%v)", stepResult.Name, stepResult.Status, stepResult.Duration.Round(time.Millisecond))
+}
+
+/*
+Helper function to print the metrics a test recorded (if any), flagging the ones that regressed against the baseline
+ */
+func logMetrics(log *logrus.Logger, executionResults *testsuite.TestExecutionResults, regressions []metricRegression) {
+	if executionResults == nil || len(executionResults.Metrics) == 0 {
+		return
+	}
+
+	log.Info("Metrics:")
+	for _, metric := range executionResults.Metrics {
+		log.Infof("  - %v", formatMetric(metric))
+	}
+	for _, regression := range regressions {
+		log.Errorf("METRIC REGRESSION: %v", regression)
+	}
+}
+
+// Gets e.g. "1 retry" or "2 retries"
+func formatRetries(numRetries int) string {
+	if numRetries == 1 {
+		return "1 retry"
+	}
+	return fmt.Sprintf("%v retries", numRetries)
+}
+
+func formatMetric(metric testsuite.MetricResult) string {
+	return fmt.Sprintf("%v: %v %v", metric.Name, metric.Value, metric.Unit)
+}
+
+/*
+Gets the name of the step that the test failure should be attributed to, which is the most recently-started step that
+	didn't pass (so that the innermost of several nested steps gets the blame)
+ */
+func getFailedStepName(executionResults *testsuite.TestExecutionResults) (string, bool) {
+	if executionResults == nil {
+		return "", false
+	}
+	steps := executionResults.Steps
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].Status != testsuite.STEP_PASSED {
+			return steps[i].Name, true
+		}
+	}
+	return "", false
+}
+
 /*
 Helper function to print a big warning if there was logging to the system-level logging when there should only have been
  logging to the test-specific logger
@@ -1,8 +1,10 @@
 package parallelism
 
 import (
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
 	"github.com/palantir/stacktrace"
 	"gotest.tools/assert"
+	"strings"
 	"testing"
 )
 
@@ -13,3 +15,92 @@ func TestLogTestResult(t *testing.T) {
 	assert.Equal(t, getTestStatusFromResult(stacktrace.NewError("Test"), false), ERRORED, "Expected errored test")
 	assert.Equal(t, getTestStatusFromResult(stacktrace.NewError("Test"), true), ERRORED, "Expected errored test")
 }
+
+func TestGetFailedStepName(t *testing.T) {
+	_, found := getFailedStepName(nil)
+	assert.Assert(t, !found, "Expected no failed step when there are no results")
+
+	results := &testsuite.TestExecutionResults{
+		Steps: []testsuite.StepResult{
+			{Name: "outer", Status: testsuite.STEP_FAILED},
+			{Name: "inner", Status: testsuite.STEP_FAILED},
+			{Name: "passing", Status: testsuite.STEP_PASSED},
+		},
+	}
+	failedStepName, found := getFailedStepName(results)
+	assert.Assert(t, found, "Expected a failed step")
+	assert.Equal(t, failedStepName, "inner", "Expected the innermost failed step to be blamed")
+}
+
+func TestGetTestStatusWithSkip(t *testing.T) {
+	skippedResults := &testsuite.TestExecutionResults{Skipped: true, SkipReason: "Feature flag is off"}
+	assert.Equal(t, getTestStatus(parallelTestOutput{testPassed: true, executionResults: skippedResults}), SKIPPED, "Expected skipped test")
+	assert.Equal(t, getTestStatus(parallelTestOutput{testPassed: false, executionResults: skippedResults}), FAILED, "Expected a test whose hook failed after a skip to fail")
+	assert.Equal(t, getTestStatus(parallelTestOutput{executionErr: stacktrace.NewError("Test"), executionResults: skippedResults}), ERRORED, "Expected errored test")
+	assert.Equal(t, getTestStatus(parallelTestOutput{testPassed: true, executionResults: &testsuite.TestExecutionResults{}}), PASSED, "Expected passed test")
+}
+
+func TestGetTestOutputsByTestName(t *testing.T) {
+	testOutputs := map[testOutputKey]parallelTestOutput{
+		{testName: "b", iteration: 2}: {testName: "b", iteration: 2},
+		{testName: "a", iteration: 1}: {testName: "a", iteration: 1},
+		{testName: "b", iteration: 1}: {testName: "b", iteration: 1},
+	}
+	groups := getTestOutputsByTestName(testOutputs)
+	assert.Equal(t, len(groups), 2)
+	assert.Equal(t, len(groups[0]), 1)
+	assert.Equal(t, groups[0][0].testName, "a")
+	assert.Equal(t, len(groups[1]), 2)
+	assert.Equal(t, groups[1][0].iteration, uint(1))
+	assert.Equal(t, groups[1][1].iteration, uint(2))
+}
+
+func TestFormatTestIterationName(t *testing.T) {
+	assert.Equal(t, formatTestIterationName("consensus", 1, 1), "consensus")
+	assert.Equal(t, formatTestIterationName("consensus", 3, 20), "consensus (iteration 3 of 20)")
+	assert.Equal(t, formatTestIterationName("consensus", 3, unboundedNumIterations), "consensus (iteration 3)")
+}
+
+func TestGetTestStatusWithQuarantine(t *testing.T) {
+	passedResults := &testsuite.TestExecutionResults{}
+	assert.Equal(t, getTestStatus(parallelTestOutput{testPassed: true, executionResults: passedResults, quarantined: true}), QUARANTINED_PASSED)
+	assert.Equal(t, getTestStatus(parallelTestOutput{testPassed: false, executionResults: passedResults, quarantined: true}), QUARANTINED_FAILED)
+	assert.Equal(t, getTestStatus(parallelTestOutput{executionErr: stacktrace.NewError("Test"), quarantined: true}), QUARANTINED_FAILED)
+
+	regressions := []metricRegression{{MetricName: "latency"}}
+	regressedOutput := parallelTestOutput{testPassed: true, executionResults: passedResults, metricRegressions: regressions, quarantined: true}
+	assert.Equal(t, getTestStatus(regressedOutput), QUARANTINED_FAILED)
+	assert.Assert(t, !isPassingOutput(regressedOutput), "Expected a quarantined test with regressions to not count as passing")
+}
+
+func TestQuarantinedFailuresDontFailRun(t *testing.T) {
+	manager := newParallelTestOutputManager(nil, 1, map[string]string{"flakyTest": "Flaky"})
+	manager.logTestOutput(parallelTestOutput{testName: "flakyTest", iteration: 1, testPassed: false}, &strings.Reader{})
+	manager.logTestOutput(parallelTestOutput{testName: "goodTest", iteration: 1, testPassed: true}, &strings.Reader{})
+	assert.Assert(t, manager.getAllTestsPassed(), "Expected a quarantined failure to not fail the run")
+
+	manager.logTestOutput(parallelTestOutput{testName: "badTest", iteration: 1, testPassed: false}, &strings.Reader{})
+	assert.Assert(t, !manager.getAllTestsPassed(), "Expected a non-quarantined failure to fail the run")
+}
+
+func TestNotRunTestsFailRun(t *testing.T) {
+	manager := newParallelTestOutputManager(nil, 1, map[string]string{})
+	manager.logTestOutput(parallelTestOutput{testName: "goodTest", iteration: 1, testPassed: true}, &strings.Reader{})
+	manager.logNotRunTest("unstartedTest", 1, "")
+	assert.Equal(t, getTestStatus(manager.testOutputs[testOutputKey{testName: "unstartedTest", iteration: 1}]), NOT_RUN)
+	assert.Assert(t, !manager.getAllTestsPassed(), "Expected tests that weren't run to fail the run")
+}
+
+func TestMetricRegressionsGetRegressedStatus(t *testing.T) {
+	regressions := []metricRegression{{MetricName: "latency"}}
+	regressedOutput := parallelTestOutput{testPassed: true, executionResults: &testsuite.TestExecutionResults{}, metricRegressions: regressions}
+	assert.Equal(t, getTestStatus(regressedOutput), REGRESSED)
+	assert.Assert(t, !isPassingOutput(regressedOutput), "Expected a test with regressions to not count as passing")
+
+	// A failure is still reported as a failure, even if metrics also regressed
+	failedOutput := parallelTestOutput{testPassed: false, executionResults: &testsuite.TestExecutionResults{}, metricRegressions: regressions}
+	assert.Equal(t, getTestStatus(failedOutput), FAILED)
+
+	report := getJsonTestReport(regressedOutput, 1)
+	assert.Equal(t, report.Status, REGRESSED)
+}
@@ -0,0 +1,246 @@
+package parallelism
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	bytesInMebibyte = 1024 * 1024
+)
+
+/*
+How much of the host's resources the tests running at any one time are allowed to declare, in total, via
+	testsuite.ResourceDeclaringTest. A zero field means that resource is unlimited.
+ */
+type HostCapacity struct {
+	// The number of CPUs available to tests
+	CPUs float64
+
+	// The amount of memory available to tests, in bytes
+	MemoryBytes uint64
+
+	// The number of containers that may be running at once
+	Containers uint
+}
+
+func (capacity HostCapacity) String() string {
+	formatLimit := func(isUnlimited bool, value string) string {
+		if isUnlimited {
+			return "unlimited"
+		}
+		return value
+	}
+	return fmt.Sprintf(
+		"%v CPUs, %v memory, %v containers",
+		formatLimit(capacity.CPUs == 0, fmt.Sprintf("%v", capacity.CPUs)),
+		formatLimit(capacity.MemoryBytes == 0, fmt.Sprintf("%vMiB", capacity.MemoryBytes / bytesInMebibyte)),
+		formatLimit(capacity.Containers == 0, fmt.Sprintf("%v", capacity.Containers)))
+}
+
+/*
+Fills in the CPU and memory fields of the given host capacity that were left at zero with what the Docker daemon reports
+	having. Docker doesn't limit the number of containers, so a zero container limit stays unlimited.
+ */
+func DetectHostCapacity(ctx context.Context, dockerClient *client.Client, configuredCapacity HostCapacity) (HostCapacity, error) {
+	capacity := configuredCapacity
+	if capacity.CPUs != 0 && capacity.MemoryBytes != 0 {
+		return capacity, nil
+	}
+	info, err := dockerClient.Info(ctx)
+	if err != nil {
+		return HostCapacity{}, stacktrace.Propagate(err, "An error occurred getting the Docker daemon's info to detect the host capacity")
+	}
+	if capacity.CPUs == 0 {
+		capacity.CPUs = float64(info.NCPU)
+	}
+	if capacity.MemoryBytes == 0 && info.MemTotal > 0 {
+		capacity.MemoryBytes = uint64(info.MemTotal)
+	}
+	return capacity, nil
+}
+
+/*
+Gets the resources the given test declares it needs (none if it doesn't implement testsuite.ResourceDeclaringTest)
+ */
+func getTestResourceRequirements(test testsuite.Test) testsuite.TestResourceRequirements {
+	if resourceDeclaringTest, ok := test.(testsuite.ResourceDeclaringTest); ok {
+		return resourceDeclaringTest.GetResourceRequirements()
+	}
+	return testsuite.TestResourceRequirements{}
+}
+
+/*
+Gets a human-readable list of the ways the given requirements exceed the given capacity (empty if they fit)
+ */
+func getCapacityOverruns(requirements testsuite.TestResourceRequirements, capacity HostCapacity) []string {
+	overruns := []string{}
+	if capacity.CPUs != 0 && requirements.CPUs > capacity.CPUs {
+		overruns = append(overruns, fmt.Sprintf("%v CPUs of %v", requirements.CPUs, capacity.CPUs))
+	}
+	if capacity.MemoryBytes != 0 && requirements.MemoryBytes > capacity.MemoryBytes {
+		overruns = append(overruns, fmt.Sprintf(
+			"%vMiB memory of %vMiB",
+			requirements.MemoryBytes / bytesInMebibyte,
+			capacity.MemoryBytes / bytesInMebibyte))
+	}
+	if capacity.Containers != 0 && requirements.Containers > capacity.Containers {
+		overruns = append(overruns, fmt.Sprintf("%v containers of %v", requirements.Containers, capacity.Containers))
+	}
+	return overruns
+}
+
+/*
+Admits tests to run while the total resources they declare fit within the host's capacity, making the rest wait until
+	enough running tests have released their resources. A test that needs more than the whole host is admitted once no
+	other tests are running, so that it runs alone rather than never running at all.
+
+Waiting tests are admitted first-come, first-served: a test that doesn't fit yet holds up the tests that started waiting
+	after it, even ones that would fit, so that a big test can't be passed over forever by a stream of smaller tests.
+
+A nil admitter admits every test immediately.
+ */
+type resourceAdmitter struct {
+	capacity HostCapacity
+
+	mutex *sync.Mutex
+
+	// The total resources declared by the tests that are currently admitted
+	inUse testsuite.TestResourceRequirements
+
+	numAdmitted int
+
+	// The tickets of the tests waiting to be admitted, in the order they started waiting
+	waitingTickets []uint64
+
+	// The ticket that the next test to start waiting will get
+	nextTicket uint64
+
+	// Closed (and replaced) whenever resources are released or the line of waiting tests changes, to wake up the tests
+	//  waiting to be admitted
+	changedChan chan struct{}
+}
+
+func newResourceAdmitter(capacity HostCapacity) *resourceAdmitter {
+	return &resourceAdmitter{
+		capacity:       capacity,
+		mutex:          &sync.Mutex{},
+		waitingTickets: []uint64{},
+		changedChan:    make(chan struct{}),
+	}
+}
+
+/*
+Blocks until the test with the given requirements can be admitted and every test that started waiting before it has
+	been, or the context is cancelled.
+
+Returns:
+	True if the test was admitted (in which case release must be called once it's done), false if the context was
+		cancelled first
+ */
+func (admitter *resourceAdmitter) admit(ctx context.Context, requirements testsuite.TestResourceRequirements) bool {
+	if admitter == nil {
+		return true
+	}
+	admitter.mutex.Lock()
+	ticket := admitter.nextTicket
+	admitter.nextTicket++
+	admitter.waitingTickets = append(admitter.waitingTickets, ticket)
+	admitter.mutex.Unlock()
+
+	for {
+		admitter.mutex.Lock()
+		isFirstInLine := admitter.waitingTickets[0] == ticket
+		if isFirstInLine && (admitter.numAdmitted == 0 || admitter.fits(requirements)) {
+			admitter.inUse.CPUs += requirements.CPUs
+			admitter.inUse.MemoryBytes += requirements.MemoryBytes
+			admitter.inUse.Containers += requirements.Containers
+			admitter.numAdmitted++
+			admitter.removeWaitingTicket(ticket)
+			admitter.mutex.Unlock()
+			return true
+		}
+		changedChan := admitter.changedChan
+		admitter.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			admitter.mutex.Lock()
+			admitter.removeWaitingTicket(ticket)
+			admitter.mutex.Unlock()
+			return false
+		case <-changedChan:
+		}
+	}
+}
+
+/*
+Releases the resources of a test that was admitted, once it's done
+ */
+func (admitter *resourceAdmitter) release(requirements testsuite.TestResourceRequirements) {
+	if admitter == nil {
+		return
+	}
+	admitter.mutex.Lock()
+	defer admitter.mutex.Unlock()
+	admitter.inUse.CPUs -= requirements.CPUs
+	admitter.inUse.MemoryBytes -= requirements.MemoryBytes
+	admitter.inUse.Containers -= requirements.Containers
+	admitter.numAdmitted--
+	if admitter.numAdmitted == 0 {
+		// Resets any floating-point drift in the CPU total
+		admitter.inUse = testsuite.TestResourceRequirements{}
+	}
+	admitter.notifyChanged()
+}
+
+/*
+Removes the given ticket from the line of waiting tests, letting the test behind it be admitted if it's now first
+NOTE: must be called with the mutex held
+ */
+func (admitter *resourceAdmitter) removeWaitingTicket(ticket uint64) {
+	for i, waitingTicket := range admitter.waitingTickets {
+		if waitingTicket == ticket {
+			admitter.waitingTickets = append(admitter.waitingTickets[:i], admitter.waitingTickets[i+1:]...)
+			break
+		}
+	}
+	admitter.notifyChanged()
+}
+
+// NOTE: must be called with the mutex held
+func (admitter *resourceAdmitter) notifyChanged() {
+	close(admitter.changedChan)
+	admitter.changedChan = make(chan struct{})
+}
+
+// NOTE: must be called with the mutex held
+func (admitter *resourceAdmitter) fits(requirements testsuite.TestResourceRequirements) bool {
+	totalRequirements := testsuite.TestResourceRequirements{
+		CPUs:        admitter.inUse.CPUs + requirements.CPUs,
+		MemoryBytes: admitter.inUse.MemoryBytes + requirements.MemoryBytes,
+		Containers:  admitter.inUse.Containers + requirements.Containers,
+	}
+	return len(getCapacityOverruns(totalRequirements, admitter.capacity)) == 0
+}
+
+/*
+Gets a description of each of the given tests that needs more than the whole host's capacity, for warning the user
+ */
+func getOversizedTestDescriptions(allTestParams map[string]ParallelTestParams, capacity HostCapacity) []string {
+	result := []string{}
+	for testName, testParams := range allTestParams {
+		overruns := getCapacityOverruns(getTestResourceRequirements(testParams.Test), capacity)
+		if len(overruns) > 0 {
+			result = append(result, fmt.Sprintf("%v (needs %v)", testName, strings.Join(overruns, ", ")))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
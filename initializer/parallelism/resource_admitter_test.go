@@ -0,0 +1,120 @@
+package parallelism
+
+import (
+	"context"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+func TestResourceAdmitterWaitsForCapacity(t *testing.T) {
+	admitter := newResourceAdmitter(HostCapacity{CPUs: 4, Containers: 10})
+	bigTest := testsuite.TestResourceRequirements{CPUs: 3, Containers: 6}
+	smallTest := testsuite.TestResourceRequirements{CPUs: 1, Containers: 2}
+
+	assert.Assert(t, admitter.admit(context.Background(), bigTest))
+	assert.Assert(t, admitter.admit(context.Background(), smallTest))
+
+	// A second big test doesn't fit until the first one is released
+	admittedChan := make(chan bool)
+	go func() {
+		admittedChan <- admitter.admit(context.Background(), bigTest)
+	}()
+	select {
+	case <-admittedChan:
+		t.Fatal("A test was admitted beyond the host capacity")
+	case <-time.After(50 * time.Millisecond):
+	}
+	admitter.release(bigTest)
+	assert.Assert(t, <-admittedChan)
+}
+
+func TestResourceAdmitterRunsOversizedTestsAlone(t *testing.T) {
+	admitter := newResourceAdmitter(HostCapacity{MemoryBytes: 1024})
+	oversizedTest := testsuite.TestResourceRequirements{MemoryBytes: 2048}
+	smallTest := testsuite.TestResourceRequirements{MemoryBytes: 1}
+
+	assert.Assert(t, admitter.admit(context.Background(), oversizedTest))
+
+	// Nothing else fits while the oversized test runs, so cancelling the wait leaves the test unadmitted
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancelFunc()
+	assert.Assert(t, !admitter.admit(ctx, smallTest))
+
+	admitter.release(oversizedTest)
+	assert.Assert(t, admitter.admit(context.Background(), smallTest))
+}
+
+func TestNilResourceAdmitterAdmitsEverything(t *testing.T) {
+	var admitter *resourceAdmitter
+	assert.Assert(t, admitter.admit(context.Background(), testsuite.TestResourceRequirements{CPUs: 1000}))
+	admitter.release(testsuite.TestResourceRequirements{CPUs: 1000})
+}
+
+func TestResourceAdmitterDoesntLetSmallTestsBypassWaitingTests(t *testing.T) {
+	admitter := newResourceAdmitter(HostCapacity{CPUs: 4})
+	runningTest := testsuite.TestResourceRequirements{CPUs: 2}
+	bigTest := testsuite.TestResourceRequirements{CPUs: 3}
+	smallTest := testsuite.TestResourceRequirements{CPUs: 1}
+
+	assert.Assert(t, admitter.admit(context.Background(), runningTest))
+	bigAdmittedChan := make(chan bool)
+	go func() {
+		bigAdmittedChan <- admitter.admit(context.Background(), bigTest)
+	}()
+	waitForNumWaitingTests(t, admitter, 1)
+
+	// The small test would fit alongside the running test, but the big test started waiting first
+	smallAdmittedChan := make(chan bool)
+	go func() {
+		smallAdmittedChan <- admitter.admit(context.Background(), smallTest)
+	}()
+	waitForNumWaitingTests(t, admitter, 2)
+	select {
+	case <-smallAdmittedChan:
+		t.Fatal("A test was admitted ahead of a test that started waiting before it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	admitter.release(runningTest)
+	assert.Assert(t, <-bigAdmittedChan)
+	assert.Assert(t, <-smallAdmittedChan)
+}
+
+func TestResourceAdmitterCancelledWaiterLetsNextTestIn(t *testing.T) {
+	admitter := newResourceAdmitter(HostCapacity{CPUs: 4})
+	runningTest := testsuite.TestResourceRequirements{CPUs: 2}
+	bigTest := testsuite.TestResourceRequirements{CPUs: 3}
+	smallTest := testsuite.TestResourceRequirements{CPUs: 1}
+
+	assert.Assert(t, admitter.admit(context.Background(), runningTest))
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	bigAdmittedChan := make(chan bool)
+	go func() {
+		bigAdmittedChan <- admitter.admit(ctx, bigTest)
+	}()
+	waitForNumWaitingTests(t, admitter, 1)
+	smallAdmittedChan := make(chan bool)
+	go func() {
+		smallAdmittedChan <- admitter.admit(context.Background(), smallTest)
+	}()
+	waitForNumWaitingTests(t, admitter, 2)
+
+	// Once the big test stops waiting, the small test is first in line and fits
+	cancelFunc()
+	assert.Assert(t, !<-bigAdmittedChan)
+	assert.Assert(t, <-smallAdmittedChan)
+}
+
+func waitForNumWaitingTests(t *testing.T, admitter *resourceAdmitter, expectedNumWaiting int) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		admitter.mutex.Lock()
+		numWaiting := len(admitter.waitingTickets)
+		admitter.mutex.Unlock()
+		if numWaiting == expectedNumWaiting {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %v tests to be waiting for admission", expectedNumWaiting)
+}
@@ -0,0 +1,151 @@
+package parallelism
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/palantir/stacktrace"
+	"net"
+	"sort"
+	"sync"
+)
+
+const (
+	bitsInIp4Addr = 32
+)
+
+/*
+Thread-safe dispenser of non-overlapping subnets for test networks, so that no two test executions running at the same
+	time (including retries of a test) get the same subnet. Subnets are doled out consecutively from a fixed range, and
+	subnets that are given back are handed out again before any new ones, so that repeatedly running tests doesn't use up
+	the range.
+ */
+type SubnetAllocator struct {
+	// Mutex gating access to the subnets
+	mutex *sync.Mutex
+
+	// The integer representation of the IP at the start of the next never-used subnet to dole out (wider than an IP so
+	//  that it can't wrap around past the end of the address space)
+	nextSubnetIpInt uint64
+
+	// The integer representation of the IP just past the end of the range that subnets are doled out from
+	endIpInt uint64
+
+	// The integer representations of the IPs at the starts of the subnets that were given back and are free to be doled
+	//  out again
+	freeSubnetIpInts []uint32
+
+	// The number of bits in each subnet, such that each subnet has 2 ^ this_value IPs
+	networkWidthBits uint32
+}
+
+/*
+Creates a new allocator which will dole out consecutive subnets starting at the given IP.
+
+Args:
+	subnetStartAddr: The IP address that the first subnet will start at
+	subnetEndAddr: The IP address just past the end of the range that subnets are doled out from (e.g. 172.32.0.0 to
+		stay inside the 172.16.0.0/12 private range)
+	networkWidthBits: The number of bits in each subnet, such that each subnet will have 2 ^ network_width_bits IPs
+ */
+func NewSubnetAllocator(subnetStartAddr string, subnetEndAddr string, networkWidthBits uint32) (*SubnetAllocator, error) {
+	if networkWidthBits >= bitsInIp4Addr {
+		return nil, stacktrace.NewError("Network width bits must be less than %v, but was %v", bitsInIp4Addr, networkWidthBits)
+	}
+
+	subnetStartIpInt, err := parseIpToInt(subnetStartAddr)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid subnet start IP")
+	}
+	subnetEndIpInt, err := parseIpToInt(subnetEndAddr)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid subnet end IP")
+	}
+	if subnetEndIpInt <= subnetStartIpInt {
+		return nil, stacktrace.NewError("Subnet end IP %v must be after the subnet start IP %v", subnetEndAddr, subnetStartAddr)
+	}
+
+	return &SubnetAllocator{
+		mutex:            &sync.Mutex{},
+		nextSubnetIpInt:  uint64(subnetStartIpInt),
+		endIpInt:         uint64(subnetEndIpInt),
+		freeSubnetIpInts: []uint32{},
+		networkWidthBits: networkWidthBits,
+	}, nil
+}
+
+/*
+Gets the next free subnet, in CIDR notation (e.g. "172.23.0.0/24"), preferring the lowest subnet that was given back
+
+Returns:
+	The subnet, or an error if every subnet in the allocator's range is in use
+ */
+func (allocator *SubnetAllocator) GetNextSubnetMask() (string, error) {
+	allocator.mutex.Lock()
+	defer allocator.mutex.Unlock()
+
+	var subnetIpInt uint32
+	if len(allocator.freeSubnetIpInts) > 0 {
+		subnetIpInt = allocator.freeSubnetIpInts[0]
+		allocator.freeSubnetIpInts = allocator.freeSubnetIpInts[1:]
+	} else {
+		subnetSize := uint64(1) << allocator.networkWidthBits
+		if allocator.nextSubnetIpInt + subnetSize > allocator.endIpInt {
+			return "", stacktrace.NewError(
+				"Every subnet up to %v is in use, so no more test networks can be created",
+				getIpFromInt(uint32(allocator.endIpInt)))
+		}
+		subnetIpInt = uint32(allocator.nextSubnetIpInt)
+		allocator.nextSubnetIpInt += subnetSize
+	}
+
+	subnetMaskBits := bitsInIp4Addr - allocator.networkWidthBits
+	return fmt.Sprintf("%v/%v", getIpFromInt(subnetIpInt), subnetMaskBits), nil
+}
+
+/*
+Gives back a subnet that was gotten from GetNextSubnetMask and is no longer in use, so that it can be handed out again
+ */
+func (allocator *SubnetAllocator) ReleaseSubnetMask(subnetMask string) error {
+	subnetIp, _, err := net.ParseCIDR(subnetMask)
+	if err != nil {
+		return stacktrace.Propagate(err, "Couldn't parse subnet %v", subnetMask)
+	}
+	if subnetIp.To4() == nil {
+		return stacktrace.NewError("Subnet %v isn't an IPv4 subnet", subnetMask)
+	}
+	subnetIpInt := binary.BigEndian.Uint32(subnetIp.To4())
+
+	allocator.mutex.Lock()
+	defer allocator.mutex.Unlock()
+	for _, freeSubnetIpInt := range allocator.freeSubnetIpInts {
+		if freeSubnetIpInt == subnetIpInt {
+			return stacktrace.NewError("Subnet %v was already given back", subnetMask)
+		}
+	}
+	allocator.freeSubnetIpInts = append(allocator.freeSubnetIpInts, subnetIpInt)
+	sort.Slice(allocator.freeSubnetIpInts, func(i, j int) bool {
+		return allocator.freeSubnetIpInts[i] < allocator.freeSubnetIpInts[j]
+	})
+	return nil
+}
+
+func parseIpToInt(ipAddr string) (uint32, error) {
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return 0, stacktrace.NewError("%v was not a valid IP address", ipAddr)
+	}
+
+	// The IP can be either 4 bytes or 16 bytes long; we need to handle both
+	//  else we'll get a silent 0 value for the int!
+	// See https://gist.github.com/ammario/649d4c0da650162efd404af23e25b86b
+	if len(ip) == 16 {
+		return binary.BigEndian.Uint32(ip[12:16]), nil
+	}
+	return binary.BigEndian.Uint32(ip), nil
+}
+
+func getIpFromInt(ipInt uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, ipInt)
+	return ip
+}
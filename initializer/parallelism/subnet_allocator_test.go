@@ -0,0 +1,69 @@
+package parallelism
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestSubnetAllocatorDolesOutConsecutiveSubnets(t *testing.T) {
+	allocator, err := NewSubnetAllocator("172.23.0.0", "172.32.0.0", 8)
+	assert.NilError(t, err)
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.0.0/24")
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.1.0/24")
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.2.0/24")
+}
+
+func TestSubnetAllocatorReusesReleasedSubnets(t *testing.T) {
+	allocator, err := NewSubnetAllocator("172.23.0.0", "172.32.0.0", 8)
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		getNextSubnetMaskForTesting(t, allocator)
+	}
+	assert.NilError(t, allocator.ReleaseSubnetMask("172.23.2.0/24"))
+	assert.NilError(t, allocator.ReleaseSubnetMask("172.23.1.0/24"))
+	assert.Assert(t, allocator.ReleaseSubnetMask("172.23.1.0/24") != nil, "Expected an error giving back a subnet twice")
+
+	// The lowest subnet given back is handed out first, and new subnets only once none are left to reuse
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.1.0/24")
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.2.0/24")
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.23.3.0/24")
+}
+
+func TestSubnetAllocatorStopsAtEndOfRange(t *testing.T) {
+	allocator, err := NewSubnetAllocator("172.31.254.0", "172.32.0.0", 8)
+	assert.NilError(t, err)
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.31.254.0/24")
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.31.255.0/24")
+	_, err = allocator.GetNextSubnetMask()
+	assert.Assert(t, err != nil, "Expected an error once the subnets would leave the range")
+
+	assert.NilError(t, allocator.ReleaseSubnetMask("172.31.254.0/24"))
+	assert.Equal(t, getNextSubnetMaskForTesting(t, allocator), "172.31.254.0/24")
+}
+
+func TestSubnetAllocatorDoesntWrapAroundAddressSpace(t *testing.T) {
+	allocator, err := NewSubnetAllocator("255.255.255.0", "255.255.255.255", 8)
+	assert.NilError(t, err)
+	_, err = allocator.GetNextSubnetMask()
+	assert.Assert(t, err != nil, "Expected an error for a subnet that doesn't fit in the range")
+}
+
+func TestSubnetAllocatorRejectsBadParams(t *testing.T) {
+	_, err := NewSubnetAllocator("not-an-ip", "172.32.0.0", 8)
+	assert.Assert(t, err != nil, "Expected an error for an invalid start IP")
+
+	_, err = NewSubnetAllocator("172.23.0.0", "not-an-ip", 8)
+	assert.Assert(t, err != nil, "Expected an error for an invalid end IP")
+
+	_, err = NewSubnetAllocator("172.23.0.0", "172.23.0.0", 8)
+	assert.Assert(t, err != nil, "Expected an error for an empty range")
+
+	_, err = NewSubnetAllocator("172.23.0.0", "172.32.0.0", 32)
+	assert.Assert(t, err != nil, "Expected an error for a network width that leaves no subnet mask")
+}
+
+func getNextSubnetMaskForTesting(t *testing.T, allocator *SubnetAllocator) string {
+	subnetMask, err := allocator.GetNextSubnetMask()
+	assert.NilError(t, err)
+	return subnetMask
+}
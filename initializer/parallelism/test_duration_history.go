@@ -0,0 +1,155 @@
+package parallelism
+
+import (
+	"encoding/json"
+	"github.com/palantir/stacktrace"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+/*
+How long each test took in previous runs of the test suite, persisted in a local file so that longer tests can be
+	scheduled first. The file looks like:
+
+	{
+		"durations": {
+			"myTest": 93000000000,
+			"myOtherTest": 12000000000
+		}
+	}
+
+with durations in nanoseconds.
+ */
+type TestDurationHistory struct {
+	// Mapping of test name -> how long the test took the last time it ran to completion
+	Durations map[string]time.Duration `json:"durations"`
+}
+
+/*
+Loads the test duration history from the given JSON file. A file that doesn't exist yet (e.g. on the first run) is
+	treated as an empty history.
+ */
+func LoadTestDurationHistory(filepath string) (*TestDurationHistory, error) {
+	history := &TestDurationHistory{
+		Durations: map[string]time.Duration{},
+	}
+	historyBytes, err := ioutil.ReadFile(filepath)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred reading the test duration history file %v", filepath)
+	}
+	if err := json.Unmarshal(historyBytes, history); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred parsing the test duration history file %v", filepath)
+	}
+	if history.Durations == nil {
+		history.Durations = map[string]time.Duration{}
+	}
+	return history, nil
+}
+
+/*
+Writes the test duration history to the given JSON file
+ */
+func (history TestDurationHistory) writeToFile(filepath string) error {
+	historyBytes, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred serializing the test duration history")
+	}
+	if err := ioutil.WriteFile(filepath, historyBytes, 0644); err != nil {
+		return stacktrace.Propagate(err, "An error occurred writing the test duration history to %v", filepath)
+	}
+	return nil
+}
+
+/*
+Orders tests for scheduling longest-processing-time-first, which keeps a long test from being started last and
+	stretching out the total duration. Tests with no recorded duration go first, since they could be arbitrarily long
+	(and we'll learn their duration this run). Ties are broken by name so that the order is deterministic.
+ */
+func getTestScheduleOrder(allTestParams map[string]ParallelTestParams, history *TestDurationHistory) []ParallelTestParams {
+	result := make([]ParallelTestParams, 0, len(allTestParams))
+	for _, testParams := range allTestParams {
+		result = append(result, testParams)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		iName := result[i].TestName
+		jName := result[j].TestName
+		iDuration, iFound := history.Durations[iName]
+		jDuration, jFound := history.Durations[jName]
+		if iFound != jFound {
+			return !iFound
+		}
+		if iDuration != jDuration {
+			return iDuration > jDuration
+		}
+		return iName < jName
+	})
+	return result
+}
+
+/*
+Estimates how long it'll take to run tests with the given durations with the given parallelism, by simulating the
+	workers each picking up the next test (in the given order) as soon as they're free.
+ */
+func estimateTotalDuration(orderedTestDurations []time.Duration, parallelism uint) time.Duration {
+	if parallelism == 0 {
+		return 0
+	}
+	workerLoads := make([]time.Duration, parallelism)
+	for _, duration := range orderedTestDurations {
+		// The next test goes to whichever worker frees up first
+		leastLoadedWorkerIdx := 0
+		for i, load := range workerLoads {
+			if load < workerLoads[leastLoadedWorkerIdx] {
+				leastLoadedWorkerIdx = i
+			}
+		}
+		workerLoads[leastLoadedWorkerIdx] += duration
+	}
+
+	var result time.Duration
+	for _, load := range workerLoads {
+		if load > result {
+			result = load
+		}
+	}
+	return result
+}
+
+/*
+Estimates how long running the given tests will take based on their recorded durations.
+
+Args:
+	orderedTestParams: The tests to run, in the order they'll be scheduled
+	numIterations: How many times each test will be run
+	history: The recorded test durations
+	parallelism: How many tests will be run in parallel
+
+Returns:
+	expectedTotalDuration: The estimated duration, which doesn't take into account the tests with no recorded duration
+	numTestsWithoutHistory: How many of the given tests have no recorded duration
+ */
+func getExpectedTotalDuration(
+			orderedTestParams []ParallelTestParams,
+			numIterations uint,
+			history *TestDurationHistory,
+			parallelism uint) (expectedTotalDuration time.Duration, numTestsWithoutHistory int) {
+	orderedTestDurations := []time.Duration{}
+	for iteration := uint(1); iteration <= numIterations; iteration++ {
+		for _, testParams := range orderedTestParams {
+			if duration, found := history.Durations[testParams.TestName]; found {
+				orderedTestDurations = append(orderedTestDurations, duration)
+			}
+		}
+	}
+	for _, testParams := range orderedTestParams {
+		if _, found := history.Durations[testParams.TestName]; !found {
+			numTestsWithoutHistory++
+		}
+	}
+	return estimateTotalDuration(orderedTestDurations, parallelism), numTestsWithoutHistory
+}
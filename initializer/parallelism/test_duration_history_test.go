@@ -0,0 +1,58 @@
+package parallelism
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestGetTestScheduleOrderIsLongestFirst(t *testing.T) {
+	allTestParams := map[string]ParallelTestParams{
+		"short": {TestName: "short"},
+		"long": {TestName: "long"},
+		"unknown": {TestName: "unknown"},
+		"medium": {TestName: "medium"},
+	}
+	history := &TestDurationHistory{
+		Durations: map[string]time.Duration{
+			"short": time.Second,
+			"long": time.Minute,
+			"medium": 10 * time.Second,
+		},
+	}
+	orderedTestNames := []string{}
+	for _, testParams := range getTestScheduleOrder(allTestParams, history) {
+		orderedTestNames = append(orderedTestNames, testParams.TestName)
+	}
+	assert.DeepEqual(t, orderedTestNames, []string{"unknown", "long", "medium", "short"})
+}
+
+func TestEstimateTotalDuration(t *testing.T) {
+	durations := []time.Duration{5 * time.Second, 4 * time.Second, 3 * time.Second, 3 * time.Second}
+	// Two workers: [5, 3] and [4, 3]
+	assert.Equal(t, estimateTotalDuration(durations, 2), 8 * time.Second)
+	assert.Equal(t, estimateTotalDuration(durations, 1), 15 * time.Second)
+	assert.Equal(t, estimateTotalDuration(durations, 10), 5 * time.Second)
+}
+
+func TestTestDurationHistoryRoundTrip(t *testing.T) {
+	dirpath, err := ioutil.TempDir("", "duration-history")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+	filepath := path.Join(dirpath, "durations.json")
+
+	// A history file that doesn't exist yet is treated as empty
+	history, err := LoadTestDurationHistory(filepath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(history.Durations), 0)
+
+	history.Durations["myTest"] = 93 * time.Second
+	assert.NilError(t, history.writeToFile(filepath))
+
+	reloadedHistory, err := LoadTestDurationHistory(filepath)
+	assert.NilError(t, err)
+	assert.Equal(t, reloadedHistory.Durations["myTest"], 93 * time.Second)
+}
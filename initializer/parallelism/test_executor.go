@@ -2,6 +2,8 @@ package parallelism
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/docker/client"
@@ -11,10 +13,10 @@ import (
 	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
-	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	"regexp"
 	"time"
 )
 
@@ -35,6 +37,9 @@ const (
 	// TODO Make this configurable based on the controller image the user defines!
 	controllerLogMountFilepath = "/test-controller.log"
 
+	// TODO Make this configurable based on the controller image the user defines!
+	controllerResultsMountFilepath = "/test-controller-results.json"
+
 	// TODO Make this configurable based on the controller image the user defines!
 	testVolumeMountpoint = "/shared"
 
@@ -45,6 +50,7 @@ const (
 	subnetMaskArg           = "SUBNET_MASK"
 	gatewayIpArg            = "GATEWAY_IP"
 	logFilepathArg          = "LOG_FILEPATH"
+	resultsFilepathArg      = "RESULTS_FILEPATH"
 	logLevelArg             = "LOG_LEVEL"
 	testControllerIpArg     = "TEST_CONTROLLER_IP"
 	testVolumeMountpointArg = "TEST_VOLUME_MOUNTPOINT"
@@ -56,8 +62,14 @@ const (
 	// When we're tearing down a network after a test (either after normal exit or test timeout), this is the maximum
 	//  time we'll wait for each container to stop
 	networkTeardownContainerStopTimeout = 10 * time.Second
+
+	// How many hex characters of a test name's hash are used to keep sanitized Docker object names unique
+	testNameHashLength = 8
 )
 
+// Matches the characters that aren't allowed in Docker object (e.g. network and volume) names
+var dockerNameDisallowedCharsRegex = regexp.MustCompile("[^a-zA-Z0-9_.-]")
+
 /*
 Because a test is run in its own goroutine to allow us to time it out, we need to pass the results back
 	via a channel. This struct is what's passed over the channel.
@@ -66,6 +78,9 @@ type testResult struct {
 	// Whether the test passed or not (undefined if an error occurred that prevented us from retrieving test results)
 	testPassed   bool
 
+	// The structured results the controller reported for the test (nil if the controller didn't report any)
+	executionResults *testsuite.TestExecutionResults
+
 	// If not nil, the error that prevented us from retrieving the test result
 	executionErr error
 }
@@ -95,9 +110,17 @@ type testExecutor struct {
 	// Mapping of user-defined custom environment variables that will also be passed to the controller image
 	customTestControllerEnvVars map[string]string
 
+	// The least severe level of structured test log entry that will be shown if the test passes (all entries are shown
+	//  for tests that don't pass)
+	passingTestLogLevel logrus.Level
+
 	// Name of the test being run
 	testName string
 
+	// Distinguishes this run of the test from other runs of the same test in the same execution (e.g. "attempt2" for a
+	//  retry), so that their Docker objects don't collide; empty for a test's first run
+	testRunLabel string
+
 	// The actual test object to run
 	test testsuite.Test
 }
@@ -117,7 +140,11 @@ Args:
 		should be meaningful to the user-defined controller code
 	customTestControllerEnvVars: A key-value mapping of custom Docker environment variables that will be passed to the
 		controller image (as a method for the user to pass their own custom params between initializer and controller)
+	passingTestLogLevel: The least severe level of structured test log entry (logged via the TestContext) that will be
+		shown if the test passes
 	testName: The name of the test the executor should execute
+	testRunLabel: Label distinguishing this run of the test from other runs of the same test in the same execution
+		(empty for a test's first run)
 	test: The logic of the test being executed
  */
 func newTestExecutor(
@@ -128,7 +155,9 @@ func newTestExecutor(
 			testControllerImageName string,
 			testControllerLogLevel string,
 			customTestControllerEnvVars map[string]string,
+			passingTestLogLevel logrus.Level,
 			testName string,
+			testRunLabel string,
 			test testsuite.Test) *testExecutor {
 	return &testExecutor{
 		log:                         log,
@@ -138,7 +167,9 @@ func newTestExecutor(
 		testControllerImageName:     testControllerImageName,
 		testControllerLogLevel:      testControllerLogLevel,
 		customTestControllerEnvVars: customTestControllerEnvVars,
+		passingTestLogLevel:         passingTestLogLevel,
 		testName:                    testName,
+		testRunLabel:                testRunLabel,
 		test:                        test,
 	}
 }
@@ -152,9 +183,10 @@ Args:
 
 Returns:
 	bool: A boolean indicating if the test passed (will be undefined if the test result couldn't be retrieved for any reason)
+	*TestExecutionResults: The structured results the controller reported for the test (nil if none were reported)
 	error: If not nil, represents the error hit while running the test that prevented the retrieval of the test result
  */
-func (executor testExecutor) runTest(ctx *context.Context) (bool, error) {
+func (executor testExecutor) runTest(ctx *context.Context) (bool, *testsuite.TestExecutionResults, error) {
 	testResultChan := make(chan testResult)
 
 	// When this is breached, we'll try to tear down everything
@@ -167,10 +199,11 @@ func (executor testExecutor) runTest(ctx *context.Context) (bool, error) {
 	//  we hope so, but (because this runs user-written code) we can't trust it so we give ourselves the option to move
 	//  on if the test, e.g., infinite-loops
 	go func() {
-		testPassed, setupErr := executor.runTestGoroutine(context)
+		testPassed, executionResults, setupErr := executor.runTestGoroutine(context)
 		testResultChan <- testResult{
-			testPassed:   testPassed,
-			executionErr: setupErr,
+			testPassed:       testPassed,
+			executionResults: executionResults,
+			executionErr:     setupErr,
 		}
 	}()
 
@@ -197,9 +230,9 @@ func (executor testExecutor) runTest(ctx *context.Context) (bool, error) {
 				networkTeardownGraceTime,
 			)
 		}
-		return false, stacktrace.NewError("Test hit hard timeout, %v", totalTimeout)
+		return false, testExecutionResult.executionResults, stacktrace.NewError("Test hit hard timeout, %v", totalTimeout)
 	} else {
-		return testExecutionResult.testPassed, testExecutionResult.executionErr
+		return testExecutionResult.testPassed, testExecutionResult.executionResults, testExecutionResult.executionErr
 	}
 }
 
@@ -212,32 +245,33 @@ Args:
 	ctx: the context of the calling function, used to handle graceful shutdowns
 
 Returns:
-	error: If an error occurred that prevented us from running the test & retrieving the results (independent from whether the test itself passed)
 	bool: A boolean indicating whether the test passed (undefined if an error occurred running the test)
+	*TestExecutionResults: The structured results the controller reported for the test (nil if none were reported)
+	error: If an error occurred that prevented us from running the test & retrieving the results (independent from whether the test itself passed)
 */
-func (executor testExecutor) runTestGoroutine(context context.Context) (bool, error) {
+func (executor testExecutor) runTestGoroutine(context context.Context) (bool, *testsuite.TestExecutionResults, error) {
 	executor.log.Info("Creating Docker manager from environment settings...")
 	// NOTE: at this point, all Docker commands from here forward will be bound by the Context that we pass in here - we'll
 	//  only need to cancel this context once
 	dockerManager, err := docker.NewDockerManager(executor.log, executor.dockerClient)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "An error occurred getting the Docker manager for test %v", executor.testName)
+		return false, nil, stacktrace.Propagate(err, "An error occurred getting the Docker manager for test %v", executor.testName)
 	}
 	executor.log.Info("Docker manager created successfully")
 
 	executor.log.Infof("Creating Docker network for test with subnet mask %v...", executor.subnetMask)
-	networkName := fmt.Sprintf("%v-%v", executor.executionInstanceId.String(), executor.testName)
+	networkName := getUniqueTestIdentifier(executor.executionInstanceId, executor.testName, executor.testRunLabel)
 	publicIpProvider, err := networks.NewFreeIpAddrTracker(executor.log, executor.subnetMask, map[string]bool{})
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Could not create the free IP address tracker")
+		return false, nil, stacktrace.Propagate(err, "Could not create the free IP address tracker")
 	}
 	gatewayIp, err := publicIpProvider.GetFreeIpAddr()
 	if err != nil {
-		return false, stacktrace.Propagate(err, "An error occurred getting the gateway IP")
+		return false, nil, stacktrace.Propagate(err, "An error occurred getting the gateway IP")
 	}
 	networkId, err := dockerManager.CreateNetwork(context, networkName, executor.subnetMask, gatewayIp)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Error occurred creating Docker network %v for test %v", networkName, executor.testName)
+		return false, nil, stacktrace.Propagate(err, "Error occurred creating Docker network %v for test %v", networkName, executor.testName)
 	}
 	defer removeNetworkDeferredFunc(executor.log, dockerManager, networkId)
 	executor.log.Infof("Docker network %v created successfully", networkId)
@@ -245,20 +279,20 @@ func (executor testExecutor) runTestGoroutine(context context.Context) (bool, er
 	executor.log.Info("Running test controller...")
 	controllerIp, err := publicIpProvider.GetFreeIpAddr()
 	if err != nil {
-		return false, stacktrace.NewError("An error occurred getting an IP for the test controller")
+		return false, nil, stacktrace.NewError("An error occurred getting an IP for the test controller")
 	}
-	testPassed, err := executor.runControllerContainer(
+	testPassed, executionResults, err := executor.runControllerContainer(
 		context,
 		dockerManager,
 		networkId,
 		gatewayIp,
 		controllerIp)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "An error occurred while running the test, independent of test success")
+		return false, nil, stacktrace.Propagate(err, "An error occurred while running the test, independent of test success")
 	}
 	executor.log.Info("The test controller ran and exited successfully")
 
-	return testPassed, nil
+	return testPassed, executionResults, nil
 }
 
 /*
@@ -273,6 +307,7 @@ Args:
 
 Returns:
 	bool: true if the test succeeded, false if not
+	*TestExecutionResults: the structured results the controller reported for the test (nil if none were reported)
 	error: if any error occurred during the execution of the controller (independent of the test itself)
 */
 func (executor testExecutor) runControllerContainer(
@@ -280,13 +315,13 @@ func (executor testExecutor) runControllerContainer(
 			manager *docker.DockerManager,
 			networkId string,
 			gatewayIp net.IP,
-			controllerIpAddr net.IP) (bool, error){
-	uniqueTestIdentifier := fmt.Sprintf("%v-%v", executor.executionInstanceId.String(), executor.testName)
+			controllerIpAddr net.IP) (bool, *testsuite.TestExecutionResults, error){
+	uniqueTestIdentifier := getUniqueTestIdentifier(executor.executionInstanceId, executor.testName, executor.testRunLabel)
 
 	volumeName := uniqueTestIdentifier
 	executor.log.Debugf("Creating Docker volume %v which will be shared with the test network...", volumeName)
 	if err := manager.CreateVolume(context, volumeName); err != nil {
-		return false, stacktrace.Propagate(err, "Error creating Docker volume to share amongst test nodes")
+		return false, nil, stacktrace.Propagate(err, "Error creating Docker volume to share amongst test nodes")
 	}
 	executor.log.Debugf("Docker volume %v created successfully", volumeName)
 
@@ -294,11 +329,21 @@ func (executor testExecutor) runControllerContainer(
 	executor.log.Debugf("Creating temporary file with name %v to store controller logs...", testControllerLogFilename)
 	logTmpFile, err := ioutil.TempFile("", testControllerLogFilename)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Could not create tempfile to store log info for passing to test controller")
+		return false, nil, stacktrace.Propagate(err, "Could not create tempfile to store log info for passing to test controller")
 	}
 	logTmpFile.Close()
 	executor.log.Debugf("Successfully created temporary file to store controller logs at path %v", logTmpFile.Name())
 
+	testControllerResultsFilename := fmt.Sprintf("%v-controller-results", uniqueTestIdentifier)
+	executor.log.Debugf("Creating temporary file with name %v to store controller results...", testControllerResultsFilename)
+	resultsTmpFile, err := ioutil.TempFile("", testControllerResultsFilename)
+	if err != nil {
+		return false, nil, stacktrace.Propagate(err, "Could not create tempfile to store the results reported by the test controller")
+	}
+	resultsTmpFile.Close()
+	defer os.Remove(resultsTmpFile.Name()) // We're responsible for removing the tempfile we created
+	executor.log.Debugf("Successfully created temporary file to store controller results at path %v", resultsTmpFile.Name())
+
 	envVariables, err := generateTestControllerEnvVariables(
 		networkId,
 		executor.subnetMask,
@@ -309,7 +354,7 @@ func (executor testExecutor) runControllerContainer(
 		volumeName,
 		executor.customTestControllerEnvVars)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Failed to map test controller environment variables.")
+		return false, nil, stacktrace.Propagate(err, "Failed to map test controller environment variables.")
 	}
 	executor.log.Debugf("Environment variables that are being passed to the controller: %v", envVariables)
 
@@ -317,6 +362,7 @@ func (executor testExecutor) runControllerContainer(
 		// Because the test controller will need to spin up new images, we need to bind-mount the host Docker engine into the test controller
 		"/var/run/docker.sock": "/var/run/docker.sock",
 		logTmpFile.Name():      controllerLogMountFilepath,
+		resultsTmpFile.Name():  controllerResultsMountFilepath,
 	}
 
 	volumeMounts := map[string]string{
@@ -332,36 +378,81 @@ func (executor testExecutor) runControllerContainer(
 		nil, // The controller image's CMD should be parameterized, so we don't specify a start command here
 		envVariables,
 		bindMounts,
-		volumeMounts)
+		volumeMounts,
+		docker.ContainerHostOptions{})
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Failed to run test controller container")
+		return false, nil, stacktrace.Propagate(err, "Failed to run test controller container")
 	}
 	executor.log.Infof("Controller container started successfully with id %s", controllerContainerId)
 
 	executor.log.Info("Waiting for controller container to exit...")
 	exitCode, err := manager.WaitForExit(context, controllerContainerId)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Failed when waiting for controller to exit")
+		return false, nil, stacktrace.Propagate(err, "Failed when waiting for controller to exit")
 	}
 	executor.log.Info("Controller container exited successfully")
+	testPassed := exitCode == containerSuccessExitCode
+
+	// We show everything the test logged if it didn't pass, because that's when the user will need to debug
+	structuredLogLevel := logrus.TraceLevel
+	if testPassed {
+		structuredLogLevel = executor.passingTestLogLevel
+	}
 
 	// We open a new fp for reading because our original FP is only for writing
 	executor.log.Info("- - - - - - - - - - - - - - - - - - - CONTROLLER LOGS - - - - - - - - - - - - - - - - - -")
 	logReadFp, err := os.Open(logTmpFile.Name())
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Failed to open controller log file for reading")
+		return false, nil, stacktrace.Propagate(err, "Failed to open controller log file for reading")
+	}
+	numDroppedEntries, err := renderControllerLogs(executor.log.Out, logReadFp, structuredLogLevel)
+	if err != nil {
+		executor.log.Error("An error occurred rendering the controller logs; the logs above may not be complete!")
+		executor.log.Error(err.Error())
 	}
-	io.Copy(executor.log.Out, logReadFp)
 	executor.log.Info("- - - - - - - - - - - - - - - - - - END CONTROLLER LOGS - - - - - - - - - - - - - - - - - -")
+	if numDroppedEntries > 0 {
+		executor.log.Infof(
+			"%v test log entries less severe than %v were hidden because the test passed",
+			numDroppedEntries,
+			structuredLogLevel)
+	}
 	logReadFp.Close()
 	os.Remove(logTmpFile.Name()) // We're responsible for removing the tempfile we created
 
-	return exitCode == containerSuccessExitCode, nil
+	executionResults, err := testsuite.ReadTestExecutionResultsFromFile(resultsTmpFile.Name())
+	if err != nil {
+		// The test result itself is still valid, so we don't fail the test just because we can't show the details
+		executor.log.Warn("An error occurred reading the results reported by the test controller; they won't be reported:")
+		executor.log.Warn(err.Error())
+		executionResults = nil
+	}
+
+	return testPassed, executionResults, nil
 }
 
 
 // =========================== "STATIC" HELPER FUNCTIONS =========================================
 
+/*
+Gets an identifier for the test execution that's safe to use in Docker object names (which only allow alphanumerics,
+	'_', '.', and '-'). Test names with other characters - e.g. parameterized test names like "consensus[nodes=7]" - have
+	those characters replaced, and get a hash of the original name appended so that distinct tests can't collide. A
+	non-empty run label (e.g. "attempt2") is appended so that multiple runs of the same test don't collide either.
+ */
+func getUniqueTestIdentifier(executionInstanceId uuid.UUID, testName string, testRunLabel string) string {
+	sanitizedTestName := dockerNameDisallowedCharsRegex.ReplaceAllString(testName, "_")
+	if sanitizedTestName != testName {
+		testNameHash := sha1.Sum([]byte(testName))
+		sanitizedTestName = fmt.Sprintf("%v-%v", sanitizedTestName, hex.EncodeToString(testNameHash[:])[:testNameHashLength])
+	}
+	identifier := fmt.Sprintf("%v-%v", executionInstanceId.String(), sanitizedTestName)
+	if testRunLabel != "" {
+		identifier = fmt.Sprintf("%v-%v", identifier, dockerNameDisallowedCharsRegex.ReplaceAllString(testRunLabel, "_"))
+	}
+	return identifier
+}
+
 /*
 Helper function for making a best-effort attempt at removing a network and logging any error states; intended to be run
 as a deferred function.
@@ -411,6 +502,7 @@ func generateTestControllerEnvVariables(
 		networkIdArg:            networkId,
 		gatewayIpArg:            gatewayIp.String(),
 		logFilepathArg:          controllerLogMountFilepath,
+		resultsFilepathArg:      controllerResultsMountFilepath,
 		logLevelArg:             logLevel,
 		testControllerIpArg:     controllerIpAddr.String(),
 		testVolumeArg:           testVolumeName,
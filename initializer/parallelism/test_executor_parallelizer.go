@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/docker/client"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
 	"io"
@@ -14,6 +15,33 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
+)
+
+const (
+	// Prefix of the label distinguishing a retry of a test from the test's earlier attempts, e.g. "attempt2"
+	attemptTestRunLabelPrefix = "attempt"
+
+	// Prefix of the label distinguishing a repetition of a test from the test's other iterations, e.g. "iteration3"
+	iterationTestRunLabelPrefix = "iteration"
+
+	// Stands in for the number of iterations when tests are run until they fail, which has no upper bound
+	unboundedNumIterations uint = 0
+
+	// How long removing a test's Docker network and volume, and producing the summary and reports, is allowed to take
+	//  once the test has exited
+	executionDeadlineRemovalTime = 20 * time.Second
+
+	// How long before the execution deadline the execution is halted, to leave time for the tests in flight to exit
+	//  after being cancelled (which may take up to their grace time), stop their controllers, and be torn down, and for
+	//  the summary and reports to be produced before the deadline
+	executionDeadlineTeardownMargin = networkTeardownGraceTime + networkTeardownContainerStopTimeout + executionDeadlineRemovalTime
+
+	// Why a test that couldn't have finished before the execution is halted for the deadline wasn't started
+	tooLongForDeadlineNotRunReason = "it couldn't have finished before the execution deadline"
+
+	// Why an iteration of a test that no subnet was left for wasn't started
+	noSubnetNotRunReason = "no subnet was left for its network"
 )
 
 /*
@@ -35,8 +63,162 @@ type TestExecutorParallelizer struct {
 	// A ke-value map of custom Docker environment variables that will be passed as-is to the controller container during startup
 	customTestControllerEnvVars map[string]string
 
+	// The least severe level of structured test log entry that will be shown for tests that pass
+	passingTestLogLevel         logrus.Level
+
 	// The number of tests to run in parallel
 	parallelism                 uint
+
+	// If non-nil, tests are only started while the resources they declare fit within this capacity, on top of the
+	//  parallelism limit
+	hostCapacity                *HostCapacity
+
+	// The allocator that fresh subnets are taken from when a test is retried
+	subnetAllocator             *SubnetAllocator
+
+	// The maximum number of times a test that errors with a transient error will be retried
+	maxErroredTestRetries       uint
+
+	// How many times each test will be run, for detecting flaky tests (0 and 1 both mean each test is run once)
+	testIterations              uint
+
+	// If true, each test is run over and over until one of its iterations doesn't pass (testIterations is ignored)
+	runUntilFailure             bool
+
+	// If true, a test's remaining iterations won't be run once one of its iterations doesn't pass
+	stopIteratingOnFailure      bool
+
+	// If true, the first non-quarantined test that doesn't pass will halt the execution, cancelling in-flight tests and
+	//  leaving the remaining tests unrun
+	failFast                    bool
+
+	// The time by which the execution must be over, with no more tests being started and the tests in flight being
+	//  cancelled a teardown margin before it (the zero time if there's no deadline)
+	executionDeadline           time.Time
+
+	// The baseline that test metrics will be compared against (nil if no comparison should be done)
+	metricsBaseline             *MetricsBaseline
+
+	// Mapping of quarantined test name -> reason the test is quarantined
+	quarantinedTests            map[string]string
+
+	// How long tests took in previous runs, used to schedule the longest tests first (nil if there's no history)
+	testDurationHistory         *TestDurationHistory
+
+	// Filepath that the test duration history, updated with this run's durations, will be written back to (empty if it
+	//  shouldn't be written)
+	testDurationHistoryFilepath string
+
+	// The index of the shard of the test suite being run, recorded in the JSON report (only meaningful if shardCount > 1)
+	shardIndex                  uint
+
+	// How many shards the test suite was split into (0 or 1 if it wasn't sharded)
+	shardCount                  uint
+
+	// Filepath to write a JSON report of the test results to (empty if no JSON report should be written)
+	jsonReportFilepath          string
+
+	// Filepath to write a JUnit XML report of the test results to (empty if no JUnit report should be written)
+	junitReportFilepath         string
+
+	// Runs an iteration of a test and logs its output (always runTestWithRetries, except in unit tests of the scheduling)
+	runTestIteration            testIterationRunner
+}
+
+/*
+Runs an iteration of a test on the given subnet and logs its output to the output manager
+
+Returns:
+	passed: Whether the test passed (undefined if executionErr is non-nil)
+	executionErr: The error that prevented the test from running, if any
+ */
+type testIterationRunner func(
+	parentContext *context.Context,
+	outputManager *ParallelTestOutputManager,
+	testParams ParallelTestParams,
+	iteration uint,
+	subnetMask string) (passed bool, executionErr error)
+
+/*
+Configuration for how a TestExecutorParallelizer runs tests, where the zero value of each field other than Parallelism
+	disables the corresponding feature
+ */
+type TestExecutorParallelizerConfig struct {
+	// The name of the Docker image that will be used to run the test controller
+	TestControllerImageName string
+
+	// A string, meaningful to the test controller, that represents the user's desired log level
+	TestControllerLogLevel string
+
+	// A custom user-defined map from <env variable name> -> <env variable value> that will be passed via Docker
+	//  environment variables to the test controller
+	CustomTestControllerEnvVars map[string]string
+
+	// The least severe level of structured test log entry (logged via the TestContext) that will be shown for tests that
+	//  pass; all entries are shown for tests that don't pass
+	PassingTestLogLevel logrus.Level
+
+	// The number of tests to run concurrently
+	Parallelism uint
+
+	// If non-nil, a test is only started once the resources it declares via testsuite.ResourceDeclaringTest fit within
+	//  this capacity alongside the tests already running, so Parallelism becomes an upper bound (nil to run tests purely
+	//  by Parallelism)
+	HostCapacity *HostCapacity
+
+	// The maximum number of times a test that ERRORED due to a transient error will be retried on a fresh subnet (0 to
+	//  disable retries)
+	MaxErroredTestRetries uint
+
+	// How many times to run each test, each time on its own subnet, for detecting flaky tests (0 or 1 to run each test
+	//  once)
+	TestIterations uint
+
+	// If true, each test is run over and over, each time on its own subnet, until one of its iterations doesn't pass,
+	//  with no upper bound on the number of iterations (TestIterations is ignored). The execution then only ends once
+	//  every test has stopped passing or the execution is halted, e.g. by fail-fast or the execution deadline.
+	RunUntilFailure bool
+
+	// If true, a test's remaining iterations won't be run once one of its iterations doesn't pass
+	StopIteratingOnFailure bool
+
+	// If true, the first non-quarantined test that FAILS or ERRORS will stop any more tests from being started and
+	//  cancel the tests in flight, with the tests that weren't started reported as NOT-RUN
+	FailFast bool
+
+	// The time by which the execution must be over (the zero time for no deadline). The execution is halted like it is
+	//  for fail-fast a teardown margin before the deadline, with no more tests being started and the tests in flight
+	//  being cancelled, so that the summary and reports can still be produced in time. Tests that couldn't finish before
+	//  then, going by their execution timeout and setup buffer, aren't started.
+	ExecutionDeadline time.Time
+
+	// The baseline that metrics recorded by tests will be compared against, with regressions beyond the allowed
+	//  threshold failing the run (nil to skip the comparison)
+	MetricsBaseline *MetricsBaseline
+
+	// Mapping of quarantined test name -> reason the test is quarantined, where quarantined tests are run and reported
+	//  as usual but their failures don't fail the run
+	QuarantinedTests map[string]string
+
+	// How long tests took in previous runs, used to schedule the longest tests first and to estimate the total duration
+	//  (nil if there's no history, in which case tests are scheduled in no particular order)
+	TestDurationHistory *TestDurationHistory
+
+	// Filepath to write the test duration history, updated with this run's durations, back to (empty to skip)
+	TestDurationHistoryFilepath string
+
+	// The index of the shard of the test suite being run, recorded in the JSON report so that the reports of all the
+	//  shards can be merged (only meaningful if ShardCount > 1)
+	ShardIndex uint
+
+	// How many shards the test suite was split into (0 or 1 if it wasn't sharded)
+	ShardCount uint
+
+	// Filepath to write a JSON report of the test results to (empty to skip)
+	JsonReportFilepath string
+
+	// Filepath to write a JUnit XML report of the test results to (empty to skip)
+	JunitReportFilepath string
 }
 
 /*
@@ -45,27 +227,42 @@ Creates a new TestExecutorParallelizer which will run tests in parallel using th
 Args:
 	executionId: The UUID uniquely identifying this execution of the tests
 	dockerClient: The handle to manipulating the Docker environment
-	testControllerImageName: The name of the Docker image that will be used to run the test controller
-	testControllerLogLevel: A string, meaningful to the test controller, that represents the user's desired log level
-	customTestControllerEnvVars: A custom user-defined map from <env variable name> -> <env variable value> that will be
-		passed via Docker environment variables to the test controller
-	parallelism: The number of tests to run concurrently
+	subnetAllocator: The allocator that fresh subnets will be taken from when a test is retried (which must be the same
+		allocator that the subnets in the test params were taken from, so that subnets don't collide)
+	config: How to run the tests, e.g. how many to run in parallel and where to write the reports
  */
 func NewTestExecutorParallelizer(
 			executionId uuid.UUID,
 			dockerClient *client.Client,
-			testControllerImageName string,
-			testControllerLogLevel string,
-			customTestControllerEnvVars map[string]string,
-			parallelism uint) *TestExecutorParallelizer {
-	return &TestExecutorParallelizer{
+			subnetAllocator *SubnetAllocator,
+			config TestExecutorParallelizerConfig) *TestExecutorParallelizer {
+	executor := &TestExecutorParallelizer{
 		executionId:                 executionId,
 		dockerClient:                dockerClient,
-		testControllerImageName:     testControllerImageName,
-		testControllerLogLevel:      testControllerLogLevel,
-		customTestControllerEnvVars: customTestControllerEnvVars,
-		parallelism:                 parallelism,
+		testControllerImageName:     config.TestControllerImageName,
+		testControllerLogLevel:      config.TestControllerLogLevel,
+		customTestControllerEnvVars: config.CustomTestControllerEnvVars,
+		passingTestLogLevel:         config.PassingTestLogLevel,
+		parallelism:                 config.Parallelism,
+		hostCapacity:                config.HostCapacity,
+		subnetAllocator:             subnetAllocator,
+		maxErroredTestRetries:       config.MaxErroredTestRetries,
+		testIterations:              config.TestIterations,
+		runUntilFailure:             config.RunUntilFailure,
+		stopIteratingOnFailure:      config.StopIteratingOnFailure,
+		failFast:                    config.FailFast,
+		executionDeadline:           config.ExecutionDeadline,
+		metricsBaseline:             config.MetricsBaseline,
+		quarantinedTests:            config.QuarantinedTests,
+		testDurationHistory:         config.TestDurationHistory,
+		testDurationHistoryFilepath: config.TestDurationHistoryFilepath,
+		shardIndex:                  config.ShardIndex,
+		shardCount:                  config.ShardCount,
+		jsonReportFilepath:          config.JsonReportFilepath,
+		junitReportFilepath:         config.JunitReportFilepath,
 	}
+	executor.runTestIteration = executor.runTestWithRetries
+	return executor
 }
 
 /*
@@ -95,33 +292,146 @@ func (executor TestExecutorParallelizer) RunInParallelAndPrintResults(allTestPar
 		fmt.Printf("\nReceived signal: %v. Cleaning up tests and exiting gracefully...\n", sig)
 		cancelFunc()
 	}()
-	// These need to be buffered else sending to the channel will be blocking
-	testParamsChan := make(chan ParallelTestParams, len(allTestParams))
+	numIterations := executor.getNumTestIterations()
 
-	logrus.Info("Loading test params into work queue...")
-	for _, testParams := range allTestParams {
-		testParamsChan <- testParams
+	testDurationHistory := executor.testDurationHistory
+	if testDurationHistory == nil {
+		testDurationHistory = &TestDurationHistory{Durations: map[string]time.Duration{}}
 	}
-	close(testParamsChan) // We close the channel so that when all params are consumed, the worker threads won't block on waiting for more params
-	logrus.Info("All test params loaded into work queue")
+	orderedTestParams := getTestScheduleOrder(allTestParams, testDurationHistory)
 
-	outputManager := newParallelTestOutputManager()
+	haltTracker := newExecutionHaltTracker(cancelFunc)
+	stoppedTests := newStoppedTestTracker()
+	var testIterationsChan chan testIteration
+	if executor.runUntilFailure {
+		// There's no end to the iterations to load up front, so they're queued as workers become free instead; the channel
+		//  is unbuffered so that whether a test has failed yet is only checked when its next iteration is about to run
+		testIterationsChan = make(chan testIteration)
+		go queueTestIterationsUntilFailure(ctx, orderedTestParams, stoppedTests, haltTracker, testIterationsChan)
+	} else {
+		// These need to be buffered else sending to the channel will be blocking
+		testIterationsChan = make(chan testIteration, len(allTestParams) * int(numIterations))
+
+		logrus.Info("Loading test params into work queue...")
+		// All tests' first iterations are queued before any of their second iterations (and so on), so that the iterations
+		//  of a test are spread out over the whole execution
+		for iteration := uint(1); iteration <= numIterations; iteration++ {
+			for _, testParams := range orderedTestParams {
+				testIterationsChan <- testIteration{testParams: testParams, iteration: iteration}
+			}
+		}
+		close(testIterationsChan) // We close the channel so that when all params are consumed, the worker threads won't block on waiting for more params
+		logrus.Info("All test params loaded into work queue")
+	}
+
+	outputManager := newParallelTestOutputManager(executor.metricsBaseline, numIterations, executor.quarantinedTests)
+
+	if executor.runUntilFailure {
+		logrus.Infof(
+			"Launching %v tests, each repeatedly until it fails, with parallelism %v...",
+			len(allTestParams),
+			executor.parallelism)
+	} else if numIterations > 1 {
+		logrus.Infof(
+			"Launching %v tests, %v times each, with parallelism %v...",
+			len(allTestParams),
+			numIterations,
+			executor.parallelism)
+	} else {
+		logrus.Infof("Launching %v tests with parallelism %v...", len(allTestParams), executor.parallelism)
+	}
 
-	logrus.Infof("Launching %v tests with parallelism %v...", len(allTestParams), executor.parallelism)
+	// There's nothing to estimate when the number of iterations isn't known up front
+	var expectedTotalDuration time.Duration
+	showExpectedTotalDuration := executor.testDurationHistory != nil && !executor.runUntilFailure
+	if showExpectedTotalDuration {
+		var numTestsWithoutHistory int
+		expectedTotalDuration, numTestsWithoutHistory = getExpectedTotalDuration(
+			orderedTestParams,
+			numIterations,
+			testDurationHistory,
+			executor.parallelism)
+		logrus.Infof("Expected total duration, based on previous runs: %v", expectedTotalDuration.Round(time.Second))
+		if numTestsWithoutHistory > 0 {
+			logrus.Infof("%v tests have no duration recorded from previous runs, so aren't included in the estimate", numTestsWithoutHistory)
+		}
+	}
+	var admitter *resourceAdmitter
+	if executor.hostCapacity != nil {
+		logrus.Infof("Scheduling tests by their declared resources, with host capacity: %v", executor.hostCapacity)
+		for _, oversizedTestDescription := range getOversizedTestDescriptions(allTestParams, *executor.hostCapacity) {
+			logrus.Warnf("Test %v, which exceeds the host capacity and so will be run alone", oversizedTestDescription)
+		}
+		admitter = newResourceAdmitter(*executor.hostCapacity)
+	}
+	executionStartTime := time.Now()
 
-	executor.disableSystemLogAndRunTestThreads(&ctx, outputManager, testParamsChan)
+	if haltTime := executor.getDeadlineHaltTime(); !haltTime.IsZero() {
+		haltForDeadline := func() {
+			haltTracker.halt(fmt.Sprintf(
+				"the execution deadline of %v was nearly reached (tests are halted %v before it, to leave time for teardown and reports)",
+				executor.executionDeadline.Format(time.RFC3339),
+				executionDeadlineTeardownMargin))
+		}
+		// If the halt time has already passed (e.g. because of a slow suite setup hook), we halt before any tests start
+		if timeUntilHalt := time.Until(haltTime); timeUntilHalt <= 0 {
+			haltForDeadline()
+		} else {
+			deadlineTimer := time.AfterFunc(timeUntilHalt, haltForDeadline)
+			defer deadlineTimer.Stop()
+		}
+	}
+	executor.disableSystemLogAndRunTestThreads(&ctx, outputManager, stoppedTests, haltTracker, admitter, testIterationsChan)
 
 	logrus.Info("All tests exited")
+	if isHalted, haltReason := haltTracker.getHaltState(); isHalted {
+		logrus.Warnf(
+			"The test execution was halted early because %v; tests in flight at the time were cancelled, and tests that hadn't started yet weren't run",
+			haltReason)
+	}
+
+	actualTotalDuration := time.Since(executionStartTime)
 
 	outputManager.printSummary()
-	return outputManager.getAllTestsPassed()
+	if showExpectedTotalDuration {
+		logrus.Infof(
+			"Total duration: %v (expected: %v)",
+			actualTotalDuration.Round(time.Second),
+			expectedTotalDuration.Round(time.Second))
+	} else {
+		logrus.Infof("Total duration: %v", actualTotalDuration.Round(time.Second))
+	}
+	if executor.testDurationHistoryFilepath != "" {
+		for testName, duration := range outputManager.getCompletedTestDurations() {
+			testDurationHistory.Durations[testName] = duration
+		}
+		if err := testDurationHistory.writeToFile(executor.testDurationHistoryFilepath); err != nil {
+			logrus.Error("An error occurred writing the test duration history; test durations from this run won't be used for scheduling:")
+			fmt.Fprintln(logrus.StandardLogger().Out, err)
+		}
+	}
+	allTestsPassed := outputManager.getAllTestsPassed()
+	if err := outputManager.writeReports(
+			executor.executionId,
+			allTestsPassed,
+			executor.shardIndex,
+			executor.shardCount,
+			executor.jsonReportFilepath,
+			executor.junitReportFilepath); err != nil {
+		logrus.Error("An error occurred writing the test reports:")
+		fmt.Fprintln(logrus.StandardLogger().Out, err)
+	}
+	return allTestsPassed
 }
 
 
 func (executor TestExecutorParallelizer) disableSystemLogAndRunTestThreads(
 		parentContext *context.Context,
 		outputManager *ParallelTestOutputManager,
-		testParamsChan chan ParallelTestParams) {
+		stoppedTests *stoppedTestTracker,
+		haltTracker *executionHaltTracker,
+		admitter *resourceAdmitter,
+		testIterationsChan chan testIteration) {
 	/*
     Because each test needs to have its logs written to an independent file to avoid getting logs all mixed up, we need to make
     sure that all code below this point uses the per-test logger rather than the systemwide logger. However, it's very difficult for
@@ -134,67 +444,441 @@ func (executor TestExecutorParallelizer) disableSystemLogAndRunTestThreads(
 	var waitGroup sync.WaitGroup
 	for i := uint(0); i < executor.parallelism; i++ {
 		waitGroup.Add(1)
-		go executor.runTestWorkerGoroutine(parentContext, outputManager, &waitGroup, testParamsChan)
+		go executor.runTestWorkerGoroutine(parentContext, outputManager, stoppedTests, haltTracker, admitter, &waitGroup, testIterationsChan)
 	}
 	waitGroup.Wait()
 }
 
 /*
-A function, designed to be run inside a worker thread, that will pull test params from the given test params channel, execute the test, and
-push the result to the test results channel
+A function, designed to be run inside a worker thread, that will pull test iterations from the given channel, execute
+	them, and log their output to the output manager
  */
 func (executor TestExecutorParallelizer) runTestWorkerGoroutine(
 			parentContext *context.Context,
 			outputManager *ParallelTestOutputManager,
+			stoppedTests *stoppedTestTracker,
+			haltTracker *executionHaltTracker,
+			admitter *resourceAdmitter,
 			waitGroup *sync.WaitGroup,
-			testParamsChan chan ParallelTestParams) {
+			testIterationsChan chan testIteration) {
 	// IMPORTANT: make sure that we mark a thread as done!
 	defer waitGroup.Done()
 
-	for testParams := range testParamsChan {
+	for testIteration := range testIterationsChan {
+		testParams := testIteration.testParams
 		testName := testParams.TestName
+		if stoppedTests.isStopped(testName) {
+			continue
+		}
 
-		tempFilename := fmt.Sprintf("%v-%v", executor.executionId, testName)
-		writingTempFp, err := ioutil.TempFile("", tempFilename)
-		if err != nil {
-			emptyOutputReader := &strings.Reader{}
-			executionErr := stacktrace.Propagate(err, "An error occurred creating temporary file to contain logs of test %v", testName)
-			outputManager.logTestOutput(testName, executionErr, false, emptyOutputReader)
+		// Once the execution is halted we drain the work queue without starting anything, so we can report what didn't run
+		//  (when running until failure there's no set number of iterations, so iterations that weren't started aren't missing)
+		if isHalted, _ := haltTracker.getHaltState(); isHalted {
+			if !executor.runUntilFailure {
+				outputManager.logNotRunTest(testName, testIteration.iteration, "")
+			}
 			continue
 		}
-		defer os.Remove(writingTempFp.Name())
 
-		// Create a separate logger just for this test that writes to a tempfile
-		log := logrus.New()
-		log.SetLevel(logrus.GetLevel())
-		log.SetOutput(writingTempFp)
-		log.SetFormatter(logrus.StandardLogger().Formatter)
+		// Tests that know up front that they can't run get skipped before we spend any time setting them up
+		if skippableTest, ok := testParams.Test.(testsuite.SkippableTest); ok {
+			if shouldSkip, reason := skippableTest.ShouldSkip(); shouldSkip {
+				skippedOutput := parallelTestOutput{
+					testName:  testName,
+					iteration: testIteration.iteration,
+					executionResults: &testsuite.TestExecutionResults{
+						Skipped:    true,
+						SkipReason: reason,
+					},
+					testPassed: true,
+				}
+				outputManager.logTestOutput(skippedOutput, &strings.Reader{})
+				// There's no point running the remaining iterations of a test that can't run
+				stoppedTests.stop(testName)
+				continue
+			}
+		}
 
-		testExecutor := newTestExecutor(
-			log,
-			executor.executionId,
-			executor.dockerClient,
-			testParams.SubnetMask,
-			executor.testControllerImageName,
-			executor.testControllerLogLevel,
-			executor.customTestControllerEnvVars,
-			testName,
-			testParams.Test)
+		// A test that's waiting for resources when the execution is halted never started, so it's reported as not run
+		resourceRequirements := getTestResourceRequirements(testParams.Test)
+		if !admitter.admit(*parentContext, resourceRequirements) {
+			outputManager.logNotRunTest(testName, testIteration.iteration, "")
+			continue
+		}
+
+		// A test that would still be running when the execution is halted for the deadline would only be cancelled, so
+		//  we don't start it (checked after admission, since waiting for resources uses up time)
+		if !executor.canFinishBeforeDeadlineHalt(testParams.Test) {
+			admitter.release(resourceRequirements)
+			if !executor.runUntilFailure {
+				outputManager.logNotRunTest(testName, testIteration.iteration, tooLongForDeadlineNotRunReason)
+			}
+			// The test's later iterations would have even less time
+			stoppedTests.stop(testName)
+			continue
+		}
+
+		// Each iteration of a test gets its own subnet, so that iterations can run in parallel (runTestWithRetries gives
+		//  it back once the iteration is done)
+		subnetMask := testParams.SubnetMask
+		if testIteration.iteration > 1 {
+			var err error
+			subnetMask, err = executor.subnetAllocator.GetNextSubnetMask()
+			if err != nil {
+				admitter.release(resourceRequirements)
+				logrus.Warnf(
+					"Test %v can't be run because of the following error getting a subnet for it:\n%v",
+					formatTestIterationName(testName, testIteration.iteration, executor.getNumTestIterations()),
+					err)
+				if !executor.runUntilFailure {
+					outputManager.logNotRunTest(testName, testIteration.iteration, noSubnetNotRunReason)
+				}
+				// The test's later iterations would need subnets too
+				stoppedTests.stop(testName)
+				continue
+			}
+		}
+		passed, executionErr := executor.runTestIteration(
+			parentContext,
+			outputManager,
+			testParams,
+			testIteration.iteration,
+			subnetMask)
+		admitter.release(resourceRequirements)
+		testDidntPass := executionErr != nil || !passed
+		if (executor.stopIteratingOnFailure || executor.runUntilFailure) && testDidntPass {
+			stoppedTests.stop(testName)
+		}
+		// Quarantined tests can't fail the run, so they shouldn't be able to stop it either
+		if _, isQuarantined := executor.quarantinedTests[testName]; executor.failFast && testDidntPass && !isQuarantined {
+			haltTracker.halt(fmt.Sprintf(
+				"fail-fast was triggered by test %v",
+				formatTestIterationName(testName, testIteration.iteration, executor.getNumTestIterations())))
+		}
+	}
+}
 
+/*
+Runs a single test, retrying it on a fresh subnet each time it ERRORs with a transient error (up to the configured
+	maximum number of retries), and logs the output of all its attempts to the output manager.
 
-		passed, executionErr := testExecutor.runTest(parentContext)
-		writingTempFp.Close() // Close to flush out anything remaining in the buffer
+The subnet of the final attempt is given back to the subnet allocator once the test is done, unless it's the test's own
+	subnet from its params. The subnets of attempts that errored transiently aren't given back, since the error may have
+	been caused by the subnet colliding with a network outside of Kurtosis.
 
-		// Create a new FP to read the logfile from the start
-		var testOutputReader io.Reader
-		readingTempFp, err := os.Open(writingTempFp.Name())
+Returns:
+	passed: Whether the test passed (undefined if executionErr is non-nil)
+	executionErr: The error that prevented the final attempt at the test from running, if any
+ */
+func (executor TestExecutorParallelizer) runTestWithRetries(
+			parentContext *context.Context,
+			outputManager *ParallelTestOutputManager,
+			testParams ParallelTestParams,
+			iteration uint,
+			subnetMask string) (passed bool, executionErr error) {
+	attemptLogFilepaths := []string{}
+	defer func() {
+		for _, logFilepath := range attemptLogFilepaths {
+			os.Remove(logFilepath)
+		}
+	}()
+
+	testStartTime := time.Now()
+	priorAttemptErrs := []error{}
+	var executionResults *testsuite.TestExecutionResults
+	for attemptNumber := uint(1); ; attemptNumber++ {
+		var logFilepath string
+		var shouldRetry bool
+		passed, executionResults, executionErr, logFilepath, shouldRetry = executor.runTestAttempt(
+			parentContext,
+			testParams,
+			iteration,
+			subnetMask,
+			attemptNumber)
+		if logFilepath != "" {
+			attemptLogFilepaths = append(attemptLogFilepaths, logFilepath)
+		}
+		if !shouldRetry {
+			break
+		}
+		retrySubnetMask, err := executor.subnetAllocator.GetNextSubnetMask()
 		if err != nil {
-			errorMsg := fmt.Sprintf("An error occurred opening the test's logfile for reading; logs for this test are unavailable:\n%s", err)
-			testOutputReader = strings.NewReader(errorMsg)
-		} else {
-			defer readingTempFp.Close()
-			testOutputReader = readingTempFp
+			executionErr = stacktrace.Propagate(
+				executionErr,
+				"The test errored with a transient error, but couldn't be retried because of an error getting a subnet for the retry: %v",
+				err)
+			subnetMask = ""
+			break
+		}
+		priorAttemptErrs = append(priorAttemptErrs, executionErr)
+		subnetMask = retrySubnetMask
+	}
+	if subnetMask != "" && subnetMask != testParams.SubnetMask {
+		if err := executor.subnetAllocator.ReleaseSubnetMask(subnetMask); err != nil {
+			logrus.Warnf("An error occurred giving back subnet %v after test %v:\n%v", subnetMask, testParams.TestName, err)
+		}
+	}
+	testDuration := time.Since(testStartTime)
+
+	// Create new FPs to read the logfiles from the start, with the logs of every attempt shown in order
+	attemptLogReaders := []io.Reader{}
+	for _, logFilepath := range attemptLogFilepaths {
+		readingFp, err := os.Open(logFilepath)
+		if err != nil {
+			errorMsg := fmt.Sprintf("An error occurred opening a logfile of the test for reading; logs for this attempt are unavailable:\n%s\n", err)
+			attemptLogReaders = append(attemptLogReaders, strings.NewReader(errorMsg))
+			continue
 		}
-		outputManager.logTestOutput(testName, executionErr, passed, testOutputReader)
+		defer readingFp.Close()
+		attemptLogReaders = append(attemptLogReaders, readingFp)
+	}
+	output := parallelTestOutput{
+		testName:         testParams.TestName,
+		iteration:        iteration,
+		executionErr:     executionErr,
+		testPassed:       passed,
+		duration:         testDuration,
+		retriedErrors:    priorAttemptErrs,
+		executionResults: executionResults,
+	}
+	outputManager.logTestOutput(output, io.MultiReader(attemptLogReaders...))
+	return passed, executionErr
+}
+
+/*
+Runs a single attempt at an iteration of a test on the given subnet, with the attempt's logs written to a new tempfile.
+
+Returns:
+	passed: Whether the test passed (undefined if executionErr is non-nil)
+	executionResults: The structured results the controller reported for the test (nil if none were reported)
+	executionErr: The error that prevented the test from running, if any
+	logFilepath: The filepath of the tempfile containing the attempt's logs, which the caller is responsible for
+		removing (empty if the tempfile couldn't be created)
+	shouldRetry: Whether the attempt errored in a way that warrants another attempt
+ */
+func (executor TestExecutorParallelizer) runTestAttempt(
+			parentContext *context.Context,
+			testParams ParallelTestParams,
+			iteration uint,
+			subnetMask string,
+			attemptNumber uint) (passed bool, executionResults *testsuite.TestExecutionResults, executionErr error, logFilepath string, shouldRetry bool) {
+	testName := testParams.TestName
+
+	testRunLabel := getTestRunLabel(iteration, attemptNumber)
+
+	tempFilename := fmt.Sprintf("%v-%v", executor.executionId, testName)
+	if testRunLabel != "" {
+		tempFilename = fmt.Sprintf("%v-%v", tempFilename, testRunLabel)
+	}
+	writingTempFp, err := ioutil.TempFile("", tempFilename)
+	if err != nil {
+		executionErr := stacktrace.Propagate(err, "An error occurred creating temporary file to contain logs of test %v", testName)
+		return false, nil, executionErr, "", false
+	}
+	defer writingTempFp.Close()
+
+	// Create a separate logger just for this attempt that writes to a tempfile
+	log := logrus.New()
+	log.SetLevel(logrus.GetLevel())
+	log.SetOutput(writingTempFp)
+	log.SetFormatter(logrus.StandardLogger().Formatter)
+
+	if attemptNumber > 1 {
+		log.Infof("Starting attempt %v of test %v on fresh subnet %v...", attemptNumber, testName, subnetMask)
+	} else if iteration > 1 {
+		log.Infof("Starting iteration %v of test %v on subnet %v...", iteration, testName, subnetMask)
+	}
+
+	testExecutor := newTestExecutor(
+		log,
+		executor.executionId,
+		executor.dockerClient,
+		subnetMask,
+		executor.testControllerImageName,
+		executor.testControllerLogLevel,
+		executor.customTestControllerEnvVars,
+		executor.passingTestLogLevel,
+		testName,
+		testRunLabel,
+		testParams.Test)
+	passed, executionResults, executionErr = testExecutor.runTest(parentContext)
+
+	// We don't retry if the user is trying to stop the tests, nor if the error is likely to happen again
+	shouldRetry = executionErr != nil &&
+		attemptNumber <= executor.maxErroredTestRetries &&
+		(*parentContext).Err() == nil &&
+		isTransientTestError(executionErr)
+	if shouldRetry {
+		log.Warnf("Attempt %v of test %v errored with a transient error; it will be retried on a fresh subnet", attemptNumber, testName)
+		log.Warnf("Error reason: %v", executionErr)
+	}
+	return passed, executionResults, executionErr, writingTempFp.Name(), shouldRetry
+}
+
+/*
+Gets the time at which the execution is halted so that it's over by the execution deadline (the zero time if there's no
+	deadline)
+ */
+func (executor TestExecutorParallelizer) getDeadlineHaltTime() time.Time {
+	if executor.executionDeadline.IsZero() {
+		return time.Time{}
+	}
+	return executor.executionDeadline.Add(-executionDeadlineTeardownMargin)
+}
+
+/*
+Whether the given test, if started now, would finish before the execution is halted for the deadline even if it took
+	as long as its timeout allows
+ */
+func (executor TestExecutorParallelizer) canFinishBeforeDeadlineHalt(test testsuite.Test) bool {
+	haltTime := executor.getDeadlineHaltTime()
+	if haltTime.IsZero() {
+		return true
+	}
+	latestFinishTime := time.Now().Add(test.GetExecutionTimeout() + test.GetSetupBuffer())
+	return !latestFinishTime.After(haltTime)
+}
+
+/*
+Gets the number of times each test should be run (unboundedNumIterations if tests are run until they fail)
+ */
+func (executor TestExecutorParallelizer) getNumTestIterations() uint {
+	if executor.runUntilFailure {
+		return unboundedNumIterations
+	}
+	if executor.testIterations == 0 {
+		return 1
 	}
+	return executor.testIterations
+}
+
+// =============================== Test iterations =========================================
+/*
+A single run of a test, which is the unit of work that the worker threads pull off the work queue
+ */
+type testIteration struct {
+	testParams ParallelTestParams
+
+	// The 1-indexed number of this run of the test
+	iteration uint
+}
+
+/*
+Feeds iterations of the given tests into the given channel, round-robin, for as long as each test keeps passing. The
+	channel is closed once every test has stopped or the execution is halted or cancelled.
+ */
+func queueTestIterationsUntilFailure(
+			ctx context.Context,
+			orderedTestParams []ParallelTestParams,
+			stoppedTests *stoppedTestTracker,
+			haltTracker *executionHaltTracker,
+			testIterationsChan chan testIteration) {
+	defer close(testIterationsChan)
+	for iteration := uint(1); ; iteration++ {
+		numQueued := 0
+		for _, testParams := range orderedTestParams {
+			if isHalted, _ := haltTracker.getHaltState(); isHalted || ctx.Err() != nil {
+				return
+			}
+			if stoppedTests.isStopped(testParams.TestName) {
+				continue
+			}
+			testIterationsChan <- testIteration{testParams: testParams, iteration: iteration}
+			numQueued++
+		}
+		if numQueued == 0 {
+			return
+		}
+	}
+}
+
+/*
+Thread-safe "set" of the tests whose remaining iterations shouldn't be run, e.g. because the test was skipped or because
+	it failed and we're only running tests until their first failure
+ */
+type stoppedTestTracker struct {
+	mutex *sync.Mutex
+
+	stoppedTestNames map[string]bool
+}
+
+func newStoppedTestTracker() *stoppedTestTracker {
+	return &stoppedTestTracker{
+		mutex:            &sync.Mutex{},
+		stoppedTestNames: map[string]bool{},
+	}
+}
+
+func (tracker *stoppedTestTracker) stop(testName string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.stoppedTestNames[testName] = true
+}
+
+func (tracker *stoppedTestTracker) isStopped(testName string) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.stoppedTestNames[testName]
+}
+
+/*
+Gets the label distinguishing a run of a test from the test's other runs, e.g. "iteration3-attempt2". The first attempt
+	at the first iteration gets no label, so that the Docker objects of tests that aren't repeated or retried keep their
+	plain names.
+ */
+func getTestRunLabel(iteration uint, attemptNumber uint) string {
+	labelParts := []string{}
+	if iteration > 1 {
+		labelParts = append(labelParts, fmt.Sprintf("%v%v", iterationTestRunLabelPrefix, iteration))
+	}
+	if attemptNumber > 1 {
+		labelParts = append(labelParts, fmt.Sprintf("%v%v", attemptTestRunLabelPrefix, attemptNumber))
+	}
+	return strings.Join(labelParts, "-")
+}
+
+/*
+Thread-safe tracker of whether the test suite execution has been halted early (e.g. by fail-fast), meaning that no more
+	tests should be started and the tests in flight should be cancelled
+ */
+type executionHaltTracker struct {
+	mutex *sync.Mutex
+
+	// Cancels the context that the tests in flight are running in
+	cancelFunc context.CancelFunc
+
+	isHalted bool
+
+	// Human-readable explanation of why the execution was halted
+	haltReason string
+}
+
+func newExecutionHaltTracker(cancelFunc context.CancelFunc) *executionHaltTracker {
+	return &executionHaltTracker{
+		mutex:      &sync.Mutex{},
+		cancelFunc: cancelFunc,
+		isHalted:   false,
+		haltReason: "",
+	}
+}
+
+/*
+Halts the execution and cancels the tests in flight, if the execution isn't already halted (in which case the original
+	halt reason is kept)
+ */
+func (tracker *executionHaltTracker) halt(reason string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if tracker.isHalted {
+		return
+	}
+	tracker.isHalted = true
+	tracker.haltReason = reason
+	tracker.cancelFunc()
+}
+
+func (tracker *executionHaltTracker) getHaltState() (isHalted bool, haltReason string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.isHalted, tracker.haltReason
 }
@@ -0,0 +1,140 @@
+package parallelism
+
+import (
+	"context"
+	"github.com/docker/distribution/uuid"
+	"github.com/kurtosis-tech/kurtosis/commons/networks"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timeoutTestForParallelizer struct {
+	executionTimeout time.Duration
+}
+
+func (test timeoutTestForParallelizer) Run(network networks.Network, context testsuite.TestContext) {}
+
+func (test timeoutTestForParallelizer) GetNetworkLoader() (networks.NetworkLoader, error) {
+	return nil, nil
+}
+
+func (test timeoutTestForParallelizer) GetExecutionTimeout() time.Duration {
+	return test.executionTimeout
+}
+
+func (test timeoutTestForParallelizer) GetSetupBuffer() time.Duration {
+	return 0
+}
+
+/*
+Runs the given tests, one at a time, through a parallelizer with the given deadline, where each test that's started
+	runs until it's cancelled
+
+Returns:
+	startedTestNames: The names of the tests that were started, in order
+	testStatuses: Mapping of test name -> status from the JSON report
+ */
+func runTestsWithDeadlineForTesting(
+			t *testing.T,
+			executionDeadline time.Time,
+			testTimeouts map[string]time.Duration) (startedTestNames []string, testStatuses map[string]testStatus) {
+	dirpath, err := ioutil.TempDir("", "parallelizer-test")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+	jsonReportFilepath := path.Join(dirpath, "report.json")
+
+	executor := NewTestExecutorParallelizer(
+		uuid.Generate(),
+		nil,
+		nil,
+		TestExecutorParallelizerConfig{
+			PassingTestLogLevel: logrus.InfoLevel,
+			Parallelism:         1,
+			ExecutionDeadline:   executionDeadline,
+			QuarantinedTests:    map[string]string{},
+			JsonReportFilepath:  jsonReportFilepath,
+		})
+	executor.runTestIteration = func(
+			parentContext *context.Context,
+			outputManager *ParallelTestOutputManager,
+			testParams ParallelTestParams,
+			iteration uint,
+			subnetMask string) (bool, error) {
+		startedTestNames = append(startedTestNames, testParams.TestName)
+		<-(*parentContext).Done()
+		executionErr := stacktrace.NewError("Test was cancelled")
+		outputManager.logTestOutput(
+			parallelTestOutput{testName: testParams.TestName, iteration: iteration, executionErr: executionErr},
+			&strings.Reader{})
+		return false, executionErr
+	}
+
+	allTestParams := map[string]ParallelTestParams{}
+	for testName, executionTimeout := range testTimeouts {
+		allTestParams[testName] = ParallelTestParams{
+			TestName: testName,
+			Test:     timeoutTestForParallelizer{executionTimeout: executionTimeout},
+		}
+	}
+	assert.Assert(t, !executor.RunInParallelAndPrintResults(allTestParams))
+
+	report, err := readJsonReport(jsonReportFilepath)
+	assert.NilError(t, err)
+	testStatuses = map[string]testStatus{}
+	for _, testReport := range report.Tests {
+		testStatuses[testReport.Name] = testReport.Status
+	}
+	return startedTestNames, testStatuses
+}
+
+func TestDeadlineAlreadyPassedRunsNoTests(t *testing.T) {
+	// The deadline is still in the future, but too close to leave the margin for teardown and reports
+	executionDeadline := time.Now().Add(executionDeadlineTeardownMargin / 2)
+	startedTestNames, testStatuses := runTestsWithDeadlineForTesting(t, executionDeadline, map[string]time.Duration{
+		"a": time.Millisecond,
+		"b": time.Millisecond,
+	})
+	assert.Equal(t, len(startedTestNames), 0)
+	assert.DeepEqual(t, testStatuses, map[string]testStatus{"a": NOT_RUN, "b": NOT_RUN})
+}
+
+func TestDeadlineReachedDuringRun(t *testing.T) {
+	timeUntilHalt := 500 * time.Millisecond
+	executionDeadline := time.Now().Add(executionDeadlineTeardownMargin + timeUntilHalt)
+	startedTestNames, testStatuses := runTestsWithDeadlineForTesting(t, executionDeadline, map[string]time.Duration{
+		// Tests are scheduled by name, so this is picked up first, when it can't finish before the halt
+		"a-tooLong": time.Hour,
+		// This fits, so it's started and then cancelled at the halt, leaving the margin before the deadline
+		"b-inFlight": timeUntilHalt / 2,
+		"c-queued":   time.Millisecond,
+	})
+	assert.Assert(t, time.Now().Before(executionDeadline))
+	assert.DeepEqual(t, startedTestNames, []string{"b-inFlight"})
+	assert.DeepEqual(t, testStatuses, map[string]testStatus{
+		"a-tooLong":  NOT_RUN,
+		"b-inFlight": ERRORED,
+		"c-queued":   NOT_RUN,
+	})
+}
+
+func TestCanFinishBeforeDeadlineHalt(t *testing.T) {
+	noDeadlineExecutor := TestExecutorParallelizer{}
+	assert.Assert(t, noDeadlineExecutor.canFinishBeforeDeadlineHalt(timeoutTestForParallelizer{executionTimeout: time.Hour}))
+
+	executor := TestExecutorParallelizer{executionDeadline: time.Now().Add(executionDeadlineTeardownMargin + time.Minute)}
+	assert.Assert(t, executor.canFinishBeforeDeadlineHalt(timeoutTestForParallelizer{executionTimeout: time.Second}))
+	assert.Assert(t, !executor.canFinishBeforeDeadlineHalt(timeoutTestForParallelizer{executionTimeout: 2 * time.Minute}))
+}
+
+func TestDeadlineTeardownMarginCoversCancelledTestGraceTime(t *testing.T) {
+	// A test cancelled at the halt may take its whole grace time to exit, and must still be torn down before the deadline
+	assert.Assert(t, executionDeadlineTeardownMargin > networkTeardownGraceTime + networkTeardownContainerStopTimeout)
+}
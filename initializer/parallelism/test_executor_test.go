@@ -0,0 +1,88 @@
+package parallelism
+
+import (
+	"context"
+	"github.com/docker/distribution/uuid"
+	"gotest.tools/assert"
+	"regexp"
+	"testing"
+)
+
+func TestUniqueTestIdentifierIsDockerSafe(t *testing.T) {
+	executionId := uuid.Generate()
+	dockerSafeRegex := regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+	assert.Equal(t, getUniqueTestIdentifier(executionId, "plainTest", ""), executionId.String() + "-plainTest")
+
+	identifier := getUniqueTestIdentifier(executionId, "consensus[nodes=7,variant=b]", "")
+	assert.Assert(t, dockerSafeRegex.MatchString(identifier), "Identifier '%v' isn't Docker-safe", identifier)
+
+	otherIdentifier := getUniqueTestIdentifier(executionId, "consensus[nodes=7_variant=b]", "")
+	assert.Assert(t, identifier != otherIdentifier, "Expected distinct test names to get distinct identifiers")
+
+	retryIdentifier := getUniqueTestIdentifier(executionId, "plainTest", "attempt2")
+	assert.Equal(t, retryIdentifier, executionId.String() + "-plainTest-attempt2")
+}
+
+func TestGetTestRunLabel(t *testing.T) {
+	assert.Equal(t, getTestRunLabel(1, 1), "")
+	assert.Equal(t, getTestRunLabel(1, 2), "attempt2")
+	assert.Equal(t, getTestRunLabel(3, 1), "iteration3")
+	assert.Equal(t, getTestRunLabel(3, 2), "iteration3-attempt2")
+}
+
+func TestExecutionHaltTrackerKeepsFirstReason(t *testing.T) {
+	numCancels := 0
+	tracker := newExecutionHaltTracker(func() { numCancels++ })
+	isHalted, _ := tracker.getHaltState()
+	assert.Assert(t, !isHalted)
+
+	tracker.halt("first")
+	tracker.halt("second")
+	isHalted, haltReason := tracker.getHaltState()
+	assert.Assert(t, isHalted)
+	assert.Equal(t, haltReason, "first")
+	assert.Equal(t, numCancels, 1)
+}
+
+func TestQueueTestIterationsUntilFailure(t *testing.T) {
+	orderedTestParams := []ParallelTestParams{{TestName: "a"}, {TestName: "b"}}
+	stoppedTests := newStoppedTestTracker()
+	haltTracker := newExecutionHaltTracker(func() {})
+	testIterationsChan := make(chan testIteration)
+	go queueTestIterationsUntilFailure(context.Background(), orderedTestParams, stoppedTests, haltTracker, testIterationsChan)
+
+	assertNextIteration := func(expectedTestName string, expectedIteration uint) {
+		next := <-testIterationsChan
+		assert.Equal(t, next.testParams.TestName, expectedTestName)
+		assert.Equal(t, next.iteration, expectedIteration)
+	}
+	// Test "a" fails on its first iteration, so only "b" keeps being queued
+	assertNextIteration("a", 1)
+	stoppedTests.stop("a")
+	assertNextIteration("b", 1)
+	assertNextIteration("b", 2)
+	assertNextIteration("b", 3)
+
+	// Once halted, at most the iteration that was already waiting to be queued comes through before the queue closes
+	haltTracker.halt("test")
+	numAfterHalt := 0
+	for range testIterationsChan {
+		numAfterHalt++
+	}
+	assert.Assert(t, numAfterHalt <= 1)
+}
+
+func TestQueueTestIterationsUntilFailureEndsWhenAllTestsStop(t *testing.T) {
+	stoppedTests := newStoppedTestTracker()
+	stoppedTests.stop("a")
+	testIterationsChan := make(chan testIteration)
+	go queueTestIterationsUntilFailure(
+		context.Background(),
+		[]ParallelTestParams{{TestName: "a"}},
+		stoppedTests,
+		newExecutionHaltTracker(func() {}),
+		testIterationsChan)
+	_, isOpen := <-testIterationsChan
+	assert.Assert(t, !isOpen)
+}
@@ -0,0 +1,428 @@
+package parallelism
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/docker/distribution/uuid"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	junitTestSuiteName = "kurtosis"
+
+	// The JUnit failure type used for tests whose metrics regressed against the baseline
+	junitMetricRegressionFailureType = "MetricRegression"
+)
+
+// =============================== JSON report =========================================
+/*
+Machine-readable report of an entire test suite execution
+ */
+type jsonSuiteReport struct {
+	// The ID of the execution being reported on (empty for a report merged from the reports of several shards)
+	ExecutionId string `json:"executionId,omitempty"`
+
+	// The IDs of the shard executions that the report was merged from, if it's a merged report
+	MergedExecutionIds []string `json:"mergedExecutionIds,omitempty"`
+
+	// Which shard of the test suite was run, if the test suite was sharded
+	Shard *jsonReportShard `json:"shard,omitempty"`
+
+	AllTestsPassed bool `json:"allTestsPassed"`
+	Tests []jsonTestReport `json:"tests"`
+}
+
+type jsonReportShard struct {
+	Index uint `json:"index"`
+	Count uint `json:"count"`
+}
+
+/*
+Machine-readable report of a single test's execution
+ */
+type jsonTestReport struct {
+	Name string `json:"name"`
+
+	// Which run of the test this was (1-indexed), if tests were run multiple times to detect flakiness
+	Iteration uint `json:"iteration,omitempty"`
+
+	Status testStatus `json:"status"`
+	Duration time.Duration `json:"duration"`
+
+	// The error that prevented the test from running, if any
+	Error string `json:"error,omitempty"`
+
+	// Why the test skipped itself, if it did
+	SkipReason string `json:"skipReason,omitempty"`
+
+	// Why the test is quarantined, if it is (a quarantined test's failures don't fail the run)
+	Quarantined bool `json:"quarantined,omitempty"`
+	QuarantineReason string `json:"quarantineReason,omitempty"`
+
+	// How many times the test was run, which is more than one if it was retried after transient errors
+	Attempts int `json:"attempts"`
+
+	// The transient errors that earlier attempts at running the test ERRORED with, in order
+	RetriedErrors []string `json:"retriedErrors,omitempty"`
+
+	Steps []testsuite.StepResult `json:"steps"`
+	Metrics []testsuite.MetricResult `json:"metrics"`
+	MetricRegressions []metricRegression `json:"metricRegressions"`
+}
+
+// =============================== JUnit report =========================================
+type junitTestSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Suites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Errors int `xml:"errors,attr"`
+	Skipped int `xml:"skipped,attr"`
+	Time string `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	Time string `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Error *junitFailure `xml:"error,omitempty"`
+	Skipped *junitSkipped `xml:"skipped,omitempty"`
+
+	// Errors from earlier attempts at a test that was retried, in the format understood by Maven Surefire & friends
+	FlakyErrors []junitFailure `xml:"flakyError,omitempty"`
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Contents string `xml:",chardata"`
+}
+
+// =============================== Report writing =========================================
+/*
+Writes reports of all the test outputs captured so far in the formats that were requested.
+
+Args:
+	executionId: The ID of the test suite execution being reported on
+	allTestsPassed: Whether the execution as a whole passed
+	shardIndex: The index of the shard of the test suite that was run (only meaningful if shardCount > 1)
+	shardCount: How many shards the test suite was split into (0 or 1 if it wasn't sharded)
+	jsonReportFilepath: Filepath to write a JSON report to (empty to skip writing a JSON report)
+	junitReportFilepath: Filepath to write a JUnit XML report to (empty to skip writing a JUnit report)
+ */
+func (manager *ParallelTestOutputManager) writeReports(
+			executionId uuid.UUID,
+			allTestsPassed bool,
+			shardIndex uint,
+			shardCount uint,
+			jsonReportFilepath string,
+			junitReportFilepath string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	report := jsonSuiteReport{
+		ExecutionId:    executionId.String(),
+		AllTestsPassed: allTestsPassed,
+		Tests:          []jsonTestReport{},
+	}
+	if shardCount > 1 {
+		report.Shard = &jsonReportShard{
+			Index: shardIndex,
+			Count: shardCount,
+		}
+	}
+	// We sort tests by name (and iteration) because we want normalized reports between runs of the suite
+	for _, testOutputs := range getTestOutputsByTestName(manager.testOutputs) {
+		for _, output := range testOutputs {
+			report.Tests = append(report.Tests, getJsonTestReport(output, manager.numIterations))
+		}
+	}
+
+	if jsonReportFilepath != "" {
+		if err := writeJsonReport(jsonReportFilepath, report); err != nil {
+			return stacktrace.Propagate(err, "An error occurred writing the JSON report")
+		}
+	}
+	if junitReportFilepath != "" {
+		if err := writeJunitReport(junitReportFilepath, report.Tests); err != nil {
+			return stacktrace.Propagate(err, "An error occurred writing the JUnit report")
+		}
+	}
+	return nil
+}
+
+/*
+Converts a test's output to its JSON report, which every report format is generated from (so that reports of sharded
+	executions, which are merged from JSON reports, can be generated in every format too)
+ */
+func getJsonTestReport(output parallelTestOutput, numIterations uint) jsonTestReport {
+	testReport := jsonTestReport{
+		Name:              output.testName,
+		Status:            getTestStatus(output),
+		Duration:          output.duration,
+		Steps:             []testsuite.StepResult{},
+		Metrics:           []testsuite.MetricResult{},
+		MetricRegressions: output.metricRegressions,
+		Attempts:          len(output.retriedErrors) + 1,
+		Quarantined:       output.quarantined,
+		QuarantineReason:  output.quarantineReason,
+	}
+	if testReport.MetricRegressions == nil {
+		testReport.MetricRegressions = []metricRegression{}
+	}
+	if isRunRepeatedly(numIterations) {
+		testReport.Iteration = output.iteration
+	}
+	if output.notRun {
+		testReport.Attempts = 0
+	}
+	for _, retriedErr := range output.retriedErrors {
+		testReport.RetriedErrors = append(testReport.RetriedErrors, retriedErr.Error())
+	}
+	if output.executionErr != nil {
+		testReport.Error = output.executionErr.Error()
+	}
+	if output.executionResults != nil {
+		testReport.Steps = output.executionResults.Steps
+		testReport.Metrics = output.executionResults.Metrics
+		testReport.SkipReason = output.executionResults.SkipReason
+	}
+	return testReport
+}
+
+func writeJsonReport(filepath string, report jsonSuiteReport) error {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred serializing the JSON report")
+	}
+	if err := ioutil.WriteFile(filepath, reportBytes, 0644); err != nil {
+		return stacktrace.Propagate(err, "An error occurred writing the JSON report to %v", filepath)
+	}
+	return nil
+}
+
+func writeJunitReport(filepath string, testReports []jsonTestReport) error {
+	suite := junitTestSuite{
+		Name:      junitTestSuiteName,
+		TestCases: []junitTestCase{},
+	}
+	var totalDuration time.Duration
+	for _, testReport := range testReports {
+		// JUnit consumers identify test cases by name, so each iteration of a repeated test needs a distinct one
+		testCaseName := testReport.Name
+		if testReport.Iteration > 0 {
+			testCaseName = fmt.Sprintf("%v#%v", testReport.Name, testReport.Iteration)
+		}
+		testCase := junitTestCase{
+			Name:      testCaseName,
+			ClassName: junitTestSuiteName,
+			Time:      formatJunitDuration(testReport.Duration),
+			SystemOut: getJunitSystemOut(testReport),
+		}
+		for _, retriedErr := range testReport.RetriedErrors {
+			testCase.FlakyErrors = append(testCase.FlakyErrors, junitFailure{
+				Message:  "The test could not be run, and was retried",
+				Contents: retriedErr,
+			})
+		}
+
+		switch testReport.Status {
+		case SKIPPED:
+			testCase.Skipped = &junitSkipped{
+				Message: testReport.SkipReason,
+			}
+			suite.Skipped++
+		case NOT_RUN:
+			testCase.Skipped = &junitSkipped{
+				Message: "The test wasn't run because the execution was halted early",
+			}
+			suite.Skipped++
+		case QUARANTINED_FAILED:
+			// JUnit has no notion of quarantine, and a failure would fail the CI build, so we report it as a skip
+			message := "The test is quarantined, and didn't pass"
+			if testReport.QuarantineReason != "" {
+				message = fmt.Sprintf("%v (quarantined: %v)", message, testReport.QuarantineReason)
+			}
+			testCase.Skipped = &junitSkipped{
+				Message: message,
+			}
+			suite.Skipped++
+		case ERRORED:
+			testCase.Error = &junitFailure{
+				Message:  "The test could not be run",
+				Contents: testReport.Error,
+			}
+			suite.Errors++
+		case FAILED:
+			message := "The test failed"
+			if failedStepName, found := getFailedStepName(&testsuite.TestExecutionResults{Steps: testReport.Steps}); found {
+				message = fmt.Sprintf("The test failed in step '%v'", failedStepName)
+			}
+			testCase.Failure = &junitFailure{
+				Message: message,
+			}
+			suite.Failures++
+		case REGRESSED:
+			regressionStrs := []string{}
+			for _, regression := range testReport.MetricRegressions {
+				regressionStrs = append(regressionStrs, regression.String())
+			}
+			testCase.Failure = &junitFailure{
+				Message:  "Metrics regressed against the baseline",
+				Type:     junitMetricRegressionFailureType,
+				Contents: strings.Join(regressionStrs, "\n"),
+			}
+			suite.Failures++
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+		totalDuration += testReport.Duration
+	}
+	suite.Time = formatJunitDuration(totalDuration)
+
+	reportBytes, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "An error occurred serializing the JUnit report")
+	}
+	reportBytes = append([]byte(xml.Header), reportBytes...)
+	if err := ioutil.WriteFile(filepath, reportBytes, 0644); err != nil {
+		return stacktrace.Propagate(err, "An error occurred writing the JUnit report to %v", filepath)
+	}
+	return nil
+}
+
+// JUnit durations are expressed in seconds
+func formatJunitDuration(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+// Renders the step breakdown and metrics of a test as text, since JUnit has no dedicated place for them
+func getJunitSystemOut(testReport jsonTestReport) string {
+	lines := []string{}
+	for _, stepResult := range testReport.Steps {
+		lines = append(lines, fmt.Sprintf("Step %v", formatStepResult(stepResult)))
+	}
+	for _, metric := range testReport.Metrics {
+		lines = append(lines, fmt.Sprintf("Metric %v", formatMetric(metric)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// =============================== Report merging =========================================
+/*
+Merges the JSON reports of the shards of a sharded test suite execution (see TestSuiteRunner.RunTests) into a single
+	report of the whole suite, in the formats that are requested. Every shard's report must be given exactly once.
+
+Args:
+	shardJsonReportFilepaths: The filepaths of the JSON reports written by each of the shards
+	mergedJsonReportFilepath: Filepath to write the merged JSON report to (empty to skip)
+	mergedJunitReportFilepath: Filepath to write the merged JUnit XML report to (empty to skip)
+
+Returns:
+	allTestsPassed: Whether every shard passed
+	err: An error if the reports couldn't be read, don't belong to the same sharded execution, or couldn't be written
+ */
+func MergeShardJsonReports(
+			shardJsonReportFilepaths []string,
+			mergedJsonReportFilepath string,
+			mergedJunitReportFilepath string) (allTestsPassed bool, err error) {
+	if len(shardJsonReportFilepaths) == 0 {
+		return false, stacktrace.NewError("No shard reports were given to merge")
+	}
+
+	mergedReport := jsonSuiteReport{
+		AllTestsPassed:     true,
+		MergedExecutionIds: []string{},
+		Tests:              []jsonTestReport{},
+	}
+	var shardCount uint
+	seenShardIndices := map[uint]bool{}
+	seenTests := map[string]bool{}
+	for _, filepath := range shardJsonReportFilepaths {
+		shardReport, err := readJsonReport(filepath)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred reading shard report %v", filepath)
+		}
+		if shardReport.Shard == nil {
+			return false, stacktrace.NewError("Report %v isn't the report of a shard", filepath)
+		}
+		if shardCount == 0 {
+			shardCount = shardReport.Shard.Count
+		} else if shardReport.Shard.Count != shardCount {
+			return false, stacktrace.NewError(
+				"Report %v is from a run split into %v shards, but other reports are from a run split into %v shards",
+				filepath,
+				shardReport.Shard.Count,
+				shardCount)
+		}
+		if seenShardIndices[shardReport.Shard.Index] {
+			return false, stacktrace.NewError("Shard %v was given more than once (in report %v)", shardReport.Shard.Index, filepath)
+		}
+		seenShardIndices[shardReport.Shard.Index] = true
+
+		for _, testReport := range shardReport.Tests {
+			testKey := fmt.Sprintf("%v#%v", testReport.Name, testReport.Iteration)
+			if seenTests[testKey] {
+				return false, stacktrace.NewError(
+					"Test %v appears in more than one shard, meaning the shards weren't created from the same test selection",
+					testReport.Name)
+			}
+			seenTests[testKey] = true
+			mergedReport.Tests = append(mergedReport.Tests, testReport)
+		}
+		mergedReport.AllTestsPassed = mergedReport.AllTestsPassed && shardReport.AllTestsPassed
+		mergedReport.MergedExecutionIds = append(mergedReport.MergedExecutionIds, shardReport.ExecutionId)
+	}
+	if uint(len(seenShardIndices)) != shardCount {
+		return false, stacktrace.NewError("Only %v of the %v shards' reports were given", len(seenShardIndices), shardCount)
+	}
+
+	sort.Slice(mergedReport.Tests, func(i, j int) bool {
+		if mergedReport.Tests[i].Name != mergedReport.Tests[j].Name {
+			return mergedReport.Tests[i].Name < mergedReport.Tests[j].Name
+		}
+		return mergedReport.Tests[i].Iteration < mergedReport.Tests[j].Iteration
+	})
+
+	if mergedJsonReportFilepath != "" {
+		if err := writeJsonReport(mergedJsonReportFilepath, mergedReport); err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred writing the merged JSON report")
+		}
+	}
+	if mergedJunitReportFilepath != "" {
+		if err := writeJunitReport(mergedJunitReportFilepath, mergedReport.Tests); err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred writing the merged JUnit report")
+		}
+	}
+	return mergedReport.AllTestsPassed, nil
+}
+
+func readJsonReport(filepath string) (*jsonSuiteReport, error) {
+	reportBytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred reading JSON report %v", filepath)
+	}
+	report := &jsonSuiteReport{}
+	if err := json.Unmarshal(reportBytes, report); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred parsing JSON report %v", filepath)
+	}
+	return report, nil
+}
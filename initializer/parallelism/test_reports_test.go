@@ -0,0 +1,95 @@
+package parallelism
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeShardReportForTesting(t *testing.T, dirpath string, shardIndex uint, shardCount uint, allTestsPassed bool, testNames ...string) string {
+	report := jsonSuiteReport{
+		ExecutionId:    "execution-" + testNames[0],
+		Shard:          &jsonReportShard{Index: shardIndex, Count: shardCount},
+		AllTestsPassed: allTestsPassed,
+		Tests:          []jsonTestReport{},
+	}
+	for _, testName := range testNames {
+		report.Tests = append(report.Tests, jsonTestReport{Name: testName, Status: PASSED})
+	}
+	filepath := path.Join(dirpath, testNames[0] + ".json")
+	assert.NilError(t, writeJsonReport(filepath, report))
+	return filepath
+}
+
+func TestMergeShardJsonReports(t *testing.T) {
+	dirpath, err := ioutil.TempDir("", "shard-reports")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+
+	shard0Filepath := writeShardReportForTesting(t, dirpath, 0, 2, true, "c", "a")
+	shard1Filepath := writeShardReportForTesting(t, dirpath, 1, 2, false, "b")
+	mergedJsonFilepath := path.Join(dirpath, "merged.json")
+	mergedJunitFilepath := path.Join(dirpath, "merged.xml")
+
+	allTestsPassed, err := MergeShardJsonReports(
+		[]string{shard1Filepath, shard0Filepath},
+		mergedJsonFilepath,
+		mergedJunitFilepath)
+	assert.NilError(t, err)
+	assert.Assert(t, !allTestsPassed)
+
+	mergedReport, err := readJsonReport(mergedJsonFilepath)
+	assert.NilError(t, err)
+	assert.Assert(t, mergedReport.Shard == nil)
+	assert.Assert(t, !mergedReport.AllTestsPassed)
+	assert.DeepEqual(t, mergedReport.MergedExecutionIds, []string{"execution-b", "execution-c"})
+	mergedTestNames := []string{}
+	for _, testReport := range mergedReport.Tests {
+		mergedTestNames = append(mergedTestNames, testReport.Name)
+	}
+	assert.DeepEqual(t, mergedTestNames, []string{"a", "b", "c"})
+
+	junitBytes, err := ioutil.ReadFile(mergedJunitFilepath)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(junitBytes), `tests="3"`))
+}
+
+func TestMergeShardJsonReportsRejectsIncompleteShards(t *testing.T) {
+	dirpath, err := ioutil.TempDir("", "shard-reports")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+
+	shard0Filepath := writeShardReportForTesting(t, dirpath, 0, 3, true, "a")
+	shard1Filepath := writeShardReportForTesting(t, dirpath, 1, 3, true, "b")
+	_, err = MergeShardJsonReports([]string{shard0Filepath, shard1Filepath}, "", "")
+	assert.ErrorContains(t, err, "Only 2 of the 3")
+
+	duplicateTestFilepath := writeShardReportForTesting(t, dirpath, 2, 3, true, "c", "a")
+	_, err = MergeShardJsonReports([]string{shard0Filepath, shard1Filepath, duplicateTestFilepath}, "", "")
+	assert.ErrorContains(t, err, "more than one shard")
+
+	otherCountFilepath := writeShardReportForTesting(t, dirpath, 2, 4, true, "d")
+	_, err = MergeShardJsonReports([]string{shard0Filepath, shard1Filepath, otherCountFilepath}, "", "")
+	assert.ErrorContains(t, err, "split into")
+}
+
+func TestRegressedTestsFailJunitReport(t *testing.T) {
+	dirpath, err := ioutil.TempDir("", "regressed-reports")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dirpath)
+
+	junitFilepath := path.Join(dirpath, "report.xml")
+	testReports := []jsonTestReport{
+		{Name: "a", Status: PASSED},
+		{Name: "b", Status: REGRESSED, MetricRegressions: []metricRegression{{MetricName: "latency"}}},
+	}
+	assert.NilError(t, writeJunitReport(junitFilepath, testReports))
+
+	junitBytes, err := ioutil.ReadFile(junitFilepath)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(junitBytes), `failures="1"`))
+	assert.Assert(t, strings.Contains(string(junitBytes), "Metrics regressed against the baseline"))
+}
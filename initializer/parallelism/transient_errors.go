@@ -0,0 +1,49 @@
+package parallelism
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+Patterns matching (lowercased) error messages that indicate a transient problem with the Docker environment, rather than
+	a problem with the test itself, such that rerunning the test on a fresh subnet has a good chance of succeeding. They
+	match the Docker client's and daemon's exact wording, because looser matches (e.g. any "connection refused" or "already
+	exists") also catch errors that would just happen again on every retry.
+ */
+var transientDockerErrorPatterns = []*regexp.Regexp{
+	// The Docker client couldn't reach the daemon
+	regexp.MustCompile(`cannot connect to the docker daemon`),
+	regexp.MustCompile(`error during connect:`),
+	regexp.MustCompile(`connection reset by peer`),
+	regexp.MustCompile(`broken pipe`),
+	regexp.MustCompile(`i/o timeout`),
+	regexp.MustCompile(`tls handshake timeout`),
+	regexp.MustCompile(`service unavailable`),
+	regexp.MustCompile(`toomanyrequests`),
+	regexp.MustCompile(`device or resource busy`),
+	regexp.MustCompile(`address already in use`),
+	regexp.MustCompile(`is already in use by container`),
+	// Occurs when a subnet collides with a network left behind by something else, which a fresh subnet fixes
+	regexp.MustCompile(`pool overlaps with other one on this address space`),
+	// Occurs when creating a network races with another network of the same name being created (each attempt's network
+	//  is named after the attempt, so a network left over from an earlier attempt can't cause this)
+	regexp.MustCompile(`network with name \S+ already exists`),
+}
+
+/*
+Classifies an error that prevented a test from running (i.e. an ERRORED test) as transient or not, based on whether its
+	message (including all the messages of the errors it wraps) matches a known transient Docker error
+ */
+func isTransientTestError(err error) bool {
+	if err == nil {
+		return false
+	}
+	lowercaseErrStr := strings.ToLower(err.Error())
+	for _, pattern := range transientDockerErrorPatterns {
+		if pattern.MatchString(lowercaseErrStr) {
+			return true
+		}
+	}
+	return false
+}
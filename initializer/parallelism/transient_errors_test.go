@@ -0,0 +1,50 @@
+package parallelism
+
+import (
+	"github.com/palantir/stacktrace"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestIsTransientTestError(t *testing.T) {
+	assert.Assert(t, !isTransientTestError(nil), "Expected a nil error to not be transient")
+
+	rootErr := stacktrace.NewError("Error response from daemon: Pool overlaps with other one on this address space")
+	wrappedErr := stacktrace.Propagate(rootErr, "Error occurred creating Docker network")
+	assert.Assert(t, isTransientTestError(wrappedErr), "Expected a wrapped subnet collision to be transient")
+
+	daemonErr := stacktrace.NewError("Cannot connect to the Docker daemon at unix:///var/run/docker.sock")
+	assert.Assert(t, isTransientTestError(daemonErr), "Expected an unreachable Docker daemon to be transient")
+
+	timeoutErr := stacktrace.NewError("Test hit hard timeout, 5m0s")
+	assert.Assert(t, !isTransientTestError(timeoutErr), "Expected a test timeout to not be transient")
+}
+
+func TestIsTransientTestErrorFragments(t *testing.T) {
+	errMsgsAreTransient := map[string]bool{
+		"Error response from daemon: network with name kurtosis-test already exists": true,
+		"error during connect: Post http://10.0.0.2:2375/v1.40/containers/create: dial tcp 10.0.0.2:2375: connect: connection refused": true,
+		"Error response from daemon: Pool overlaps with other one on this address space": true,
+		"Error response from daemon: Get https://registry-1.docker.io/v2/: net/http: TLS handshake timeout": true,
+		"The test's network loader returned an error": false,
+	}
+	for errMsg, expectedIsTransient := range errMsgsAreTransient {
+		err := stacktrace.Propagate(stacktrace.NewError(errMsg), "Failed to connect container to network")
+		assert.Equal(t, isTransientTestError(err), expectedIsTransient, "Unexpected transience for error: %v", errMsg)
+	}
+}
+
+func TestNonTransientErrorsWithTransientSoundingWordsAreNotRetried(t *testing.T) {
+	errMsgs := []string{
+		// A controller that crashed and was removed won't come back on a retry
+		"Error response from daemon: No such container: 3f4e8a9b1c2d",
+		// A volume left behind by an earlier attempt will still be there on a retry
+		"Error response from daemon: a volume with the name kurtosis-test already exists",
+		// A service under test refusing connections is a problem with the test itself
+		"dial tcp 172.23.0.5:8080: connect: connection refused",
+	}
+	for _, errMsg := range errMsgs {
+		err := stacktrace.Propagate(stacktrace.NewError(errMsg), "An error occurred running the test")
+		assert.Assert(t, !isTransientTestError(err), "Expected error to not be transient: %v", errMsg)
+	}
+}
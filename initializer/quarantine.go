@@ -0,0 +1,105 @@
+package initializer
+
+import (
+	"bufio"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+const (
+	// Everything after this character on a line of a quarantine file is the reason the test is quarantined
+	quarantineFileCommentChar = "#"
+)
+
+/*
+A single entry of a quarantine file
+ */
+type quarantineFileEntry struct {
+	// A pattern matching the names of the quarantined tests, in the same format as the test name patterns used for
+	//  selecting tests (an exact name, a glob, or a regex wrapped in slashes)
+	testNamePattern string
+
+	// Why the tests are quarantined (may be empty)
+	reason string
+}
+
+/*
+Loads a quarantine file, which has one test name pattern per line optionally followed by a '#' and the reason the tests
+	are quarantined, e.g.:
+
+	# Tests whose failures won't fail the run
+	consensus-7  # Flaky leader election, see issue 123
+	/^network-partition-.*$/
+
+Blank lines and lines that are only comments are ignored.
+ */
+func loadQuarantineFile(filepath string) ([]quarantineFileEntry, error) {
+	fp, err := os.Open(filepath)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred opening quarantine file %v", filepath)
+	}
+	defer fp.Close()
+
+	result := []quarantineFileEntry{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := scanner.Text()
+		reason := ""
+		if commentIdx := strings.Index(line, quarantineFileCommentChar); commentIdx >= 0 {
+			reason = strings.TrimSpace(line[commentIdx + len(quarantineFileCommentChar):])
+			line = line[:commentIdx]
+		}
+		pattern := strings.TrimSpace(line)
+		if pattern == "" {
+			continue
+		}
+		result = append(result, quarantineFileEntry{testNamePattern: pattern, reason: reason})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred reading quarantine file %v", filepath)
+	}
+	return result, nil
+}
+
+/*
+Gets the tests that are quarantined, either because they declare themselves quarantined via QuarantinedTest or because
+	they match an entry of the quarantine file.
+
+Args:
+	allTests: All the tests in the test suite, keyed by name
+	quarantineFileEntries: The entries of the quarantine file (empty if no quarantine file was given)
+
+Returns:
+	A mapping of quarantined test name -> reason the test is quarantined (which may be empty)
+ */
+func getQuarantinedTests(allTests map[string]testsuite.Test, quarantineFileEntries []quarantineFileEntry) (map[string]string, error) {
+	result := map[string]string{}
+	for testName, test := range allTests {
+		if quarantinedTest, ok := test.(testsuite.QuarantinedTest); ok {
+			if isQuarantined, reason := quarantinedTest.IsQuarantined(); isQuarantined {
+				result[testName] = reason
+			}
+		}
+	}
+
+	for _, entry := range quarantineFileEntries {
+		matchingTestNames, err := getTestNamesMatchingPattern(allTests, entry.testNamePattern)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred matching quarantine file pattern '%v'", entry.testNamePattern)
+		}
+		if len(matchingTestNames) == 0 {
+			// Not an error, because the test may have been fixed & removed without the quarantine file being updated
+			logrus.Warnf("Quarantine file pattern '%v' doesn't match any tests", entry.testNamePattern)
+		}
+		for _, testName := range matchingTestNames {
+			// A reason declared in code takes precedence, since it lives next to the test
+			if existingReason, found := result[testName]; !found || existingReason == "" {
+				result[testName] = entry.reason
+			}
+		}
+	}
+	return result, nil
+}
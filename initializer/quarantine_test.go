@@ -0,0 +1,51 @@
+package initializer
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type quarantinedTestForSelection struct {
+	taggedTestForSelection
+	reason string
+}
+func (test quarantinedTestForSelection) IsQuarantined() (bool, string) {
+	return true, test.reason
+}
+
+func TestLoadQuarantineFile(t *testing.T) {
+	fp, err := ioutil.TempFile("", "quarantine")
+	assert.NilError(t, err)
+	defer os.Remove(fp.Name())
+	contents := "# Quarantined tests\n\nsmokeTest  # Flaky, see issue 123\n  /^slow.*/\n"
+	_, err = fp.WriteString(contents)
+	assert.NilError(t, err)
+	fp.Close()
+
+	entries, err := loadQuarantineFile(fp.Name())
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].testNamePattern, "smokeTest")
+	assert.Equal(t, entries[0].reason, "Flaky, see issue 123")
+	assert.Equal(t, entries[1].testNamePattern, "/^slow.*/")
+	assert.Equal(t, entries[1].reason, "")
+}
+
+func TestGetQuarantinedTests(t *testing.T) {
+	tests := getTestsForSelection()
+	tests["declaredQuarantinedTest"] = quarantinedTestForSelection{reason: "Declared in code"}
+
+	entries := []quarantineFileEntry{
+		{testNamePattern: "smokeTest", reason: "From file"},
+		{testNamePattern: "declaredQuarantinedTest", reason: "Also from file"},
+		{testNamePattern: "nonexistentTest", reason: ""},
+	}
+	quarantinedTests, err := getQuarantinedTests(tests, entries)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, quarantinedTests, map[string]string{
+		"smokeTest": "From file",
+		"declaredQuarantinedTest": "Declared in code",
+	})
+}
@@ -0,0 +1,196 @@
+package initializer
+
+import (
+	"github.com/palantir/stacktrace"
+	"strings"
+	"unicode"
+)
+
+/*
+A boolean expression over test tags (e.g. "smoke && !slow", "(chaos || nightly) && !flaky"), used to select which tests
+	to run. Bare words are tags, which evaluate to true if the test has the tag. Supported operators, from highest to
+	lowest precedence, are: parentheses, "!" (not), "&&" (and), and "||" (or).
+ */
+type tagExpression interface {
+	// Evaluates the expression against the given "set" of tags a test has
+	matches(tags map[string]bool) bool
+}
+
+type tagLiteralExpression struct {
+	tag string
+}
+func (expr tagLiteralExpression) matches(tags map[string]bool) bool {
+	return tags[expr.tag]
+}
+
+type notExpression struct {
+	operand tagExpression
+}
+func (expr notExpression) matches(tags map[string]bool) bool {
+	return !expr.operand.matches(tags)
+}
+
+type andExpression struct {
+	left tagExpression
+	right tagExpression
+}
+func (expr andExpression) matches(tags map[string]bool) bool {
+	return expr.left.matches(tags) && expr.right.matches(tags)
+}
+
+type orExpression struct {
+	left tagExpression
+	right tagExpression
+}
+func (expr orExpression) matches(tags map[string]bool) bool {
+	return expr.left.matches(tags) || expr.right.matches(tags)
+}
+
+// =============================== Parsing =========================================
+const (
+	andOperator = "&&"
+	orOperator = "||"
+	notOperator = "!"
+	openParen = "("
+	closeParen = ")"
+)
+
+/*
+Parses a tag selection expression (see tagExpression for the syntax)
+ */
+func parseTagExpression(expressionStr string) (tagExpression, error) {
+	tokens, err := tokenizeTagExpression(expressionStr)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred tokenizing tag expression '%v'", expressionStr)
+	}
+	if len(tokens) == 0 {
+		return nil, stacktrace.NewError("Tag expression '%v' is empty", expressionStr)
+	}
+
+	parser := &tagExpressionParser{tokens: tokens}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred parsing tag expression '%v'", expressionStr)
+	}
+	if parser.position < len(tokens) {
+		return nil, stacktrace.NewError("Unexpected '%v' in tag expression '%v'", tokens[parser.position], expressionStr)
+	}
+	return expression, nil
+}
+
+func tokenizeTagExpression(expressionStr string) ([]string, error) {
+	tokens := []string{}
+	runes := []rune(expressionStr)
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			i++
+		case strings.HasPrefix(string(runes[i:]), andOperator):
+			tokens = append(tokens, andOperator)
+			i += len(andOperator)
+		case strings.HasPrefix(string(runes[i:]), orOperator):
+			tokens = append(tokens, orOperator)
+			i += len(orOperator)
+		case string(char) == notOperator || string(char) == openParen || string(char) == closeParen:
+			tokens = append(tokens, string(char))
+			i++
+		case isTagChar(char):
+			start := i
+			for i < len(runes) && isTagChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, stacktrace.NewError("Unexpected character '%v' at position %v", string(char), i)
+		}
+	}
+	return tokens, nil
+}
+
+func isTagChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' || char == '-' || char == '.' || char == ':'
+}
+
+/*
+Recursive-descent parser, with one function per precedence level
+ */
+type tagExpressionParser struct {
+	tokens []string
+	position int
+}
+
+func (parser *tagExpressionParser) peek() string {
+	if parser.position >= len(parser.tokens) {
+		return ""
+	}
+	return parser.tokens[parser.position]
+}
+
+func (parser *tagExpressionParser) parseOr() (tagExpression, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek() == orOperator {
+		parser.position++
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpression{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *tagExpressionParser) parseAnd() (tagExpression, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek() == andOperator {
+		parser.position++
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpression{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *tagExpressionParser) parseNot() (tagExpression, error) {
+	if parser.peek() == notOperator {
+		parser.position++
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpression{operand: operand}, nil
+	}
+	return parser.parseOperand()
+}
+
+func (parser *tagExpressionParser) parseOperand() (tagExpression, error) {
+	token := parser.peek()
+	switch token {
+	case "":
+		return nil, stacktrace.NewError("Unexpected end of expression")
+	case openParen:
+		parser.position++
+		expression, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek() != closeParen {
+			return nil, stacktrace.NewError("Expected '%v' but found '%v'", closeParen, parser.peek())
+		}
+		parser.position++
+		return expression, nil
+	case andOperator, orOperator, closeParen:
+		return nil, stacktrace.NewError("Expected a tag but found '%v'", token)
+	default:
+		parser.position++
+		return tagLiteralExpression{tag: token}, nil
+	}
+}
@@ -0,0 +1,141 @@
+package initializer
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/palantir/stacktrace"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Test name patterns wrapped in this character are treated as regexes, e.g. "/^consensus.*/"
+	regexPatternDelimiter = "/"
+
+	// If a test name pattern contains any of these characters, it's treated as a glob
+	globSpecialChars = "*?["
+)
+
+/*
+Selects the tests to run from the test suite.
+
+Args:
+	allTests: All the tests in the test suite, keyed by name
+	testNamePatterns: A "set" of patterns that test names must match at least one of, with each pattern being an exact
+		test name, a glob (e.g. "consensus*"), or a regex wrapped in slashes (e.g. "/^consensus-(4|7)$/"). If empty,
+		all test names are selected.
+	tagSelectionExpression: A boolean expression over test tags that selected tests must satisfy (e.g. "smoke && !slow").
+		If empty, tests aren't filtered by tag.
+
+Returns:
+	The selected tests, keyed by name
+ */
+func selectTests(
+			allTests map[string]testsuite.Test,
+			testNamePatterns map[string]bool,
+			tagSelectionExpression string) (map[string]testsuite.Test, error) {
+	testsMatchingNames := map[string]testsuite.Test{}
+	if len(testNamePatterns) == 0 {
+		for testName, test := range allTests {
+			testsMatchingNames[testName] = test
+		}
+	}
+	for pattern, _ := range testNamePatterns {
+		matchingTestNames, err := getTestNamesMatchingPattern(allTests, pattern)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred matching test name pattern '%v'", pattern)
+		}
+		if len(matchingTestNames) == 0 {
+			return nil, stacktrace.NewError("No test registered with a name matching '%v'", pattern)
+		}
+		for _, testName := range matchingTestNames {
+			testsMatchingNames[testName] = allTests[testName]
+		}
+	}
+
+	if tagSelectionExpression == "" {
+		return testsMatchingNames, nil
+	}
+
+	expression, err := parseTagExpression(tagSelectionExpression)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "An error occurred parsing the tag selection expression")
+	}
+	result := map[string]testsuite.Test{}
+	for testName, test := range testsMatchingNames {
+		if expression.matches(getTestTags(test)) {
+			result[testName] = test
+		}
+	}
+	return result, nil
+}
+
+/*
+Gets the "set" of tags a test declares (empty if the test doesn't implement TaggedTest)
+ */
+func getTestTags(test testsuite.Test) map[string]bool {
+	taggedTest, ok := test.(testsuite.TaggedTest)
+	if !ok {
+		return map[string]bool{}
+	}
+	tags := taggedTest.GetTags()
+	if tags == nil {
+		return map[string]bool{}
+	}
+	return tags
+}
+
+/*
+Gets the sorted names of the tags that the given test has set, leaving out tags that it maps to false
+ */
+func getSortedSetTestTags(test testsuite.Test) []string {
+	result := []string{}
+	for tag, isSet := range getTestTags(test) {
+		if isSet {
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func getTestNamesMatchingPattern(allTests map[string]testsuite.Test, pattern string) ([]string, error) {
+	// Exact names take priority, so that test names containing special characters can still be selected exactly
+	if _, found := allTests[pattern]; found {
+		return []string{pattern}, nil
+	}
+
+	var matcher func(testName string) (bool, error)
+	if len(pattern) > 2 && strings.HasPrefix(pattern, regexPatternDelimiter) && strings.HasSuffix(pattern, regexPatternDelimiter) {
+		regex, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(pattern, regexPatternDelimiter), regexPatternDelimiter))
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Pattern '%v' isn't a valid regex", pattern)
+		}
+		matcher = func(testName string) (bool, error) {
+			return regex.MatchString(testName), nil
+		}
+	} else if strings.ContainsAny(pattern, globSpecialChars) {
+		// Validate the glob up front, because path.Match only reports bad patterns when it gets to the bad part
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, stacktrace.Propagate(err, "Pattern '%v' isn't a valid glob", pattern)
+		}
+		matcher = func(testName string) (bool, error) {
+			return path.Match(pattern, testName)
+		}
+	} else {
+		return []string{}, nil
+	}
+
+	result := []string{}
+	for testName, _ := range allTests {
+		isMatch, err := matcher(testName)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred matching test name '%v'", testName)
+		}
+		if isMatch {
+			result = append(result, testName)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package initializer
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/networks"
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+type taggedTestForSelection struct {
+	tags map[string]bool
+}
+func (test taggedTestForSelection) Run(network networks.Network, context testsuite.TestContext) {}
+func (test taggedTestForSelection) GetNetworkLoader() (networks.NetworkLoader, error) {
+	return nil, nil
+}
+func (test taggedTestForSelection) GetExecutionTimeout() time.Duration {
+	return time.Minute
+}
+func (test taggedTestForSelection) GetSetupBuffer() time.Duration {
+	return time.Minute
+}
+func (test taggedTestForSelection) GetTags() map[string]bool {
+	return test.tags
+}
+
+func getTestsForSelection() map[string]testsuite.Test {
+	return map[string]testsuite.Test{
+		"smokeTest": taggedTestForSelection{tags: map[string]bool{"smoke": true}},
+		"slowSmokeTest": taggedTestForSelection{tags: map[string]bool{"smoke": true, "slow": true}},
+		"chaosTest": taggedTestForSelection{tags: map[string]bool{"chaos": true, "nightly": true}},
+		"consensus[nodes=7]": taggedTestForSelection{tags: map[string]bool{}},
+	}
+}
+
+func TestTagExpressions(t *testing.T) {
+	tags := map[string]bool{"smoke": true, "slow": true}
+	expectedResults := map[string]bool{
+		"smoke":                      true,
+		"chaos":                      false,
+		"!chaos":                     true,
+		"smoke && !slow":             false,
+		"smoke && slow":              true,
+		"chaos || smoke":             true,
+		"chaos || smoke && !slow":    false,
+		"(chaos || smoke) && slow":   true,
+		"!(chaos || nightly)":        true,
+	}
+	for expressionStr, expected := range expectedResults {
+		expression, err := parseTagExpression(expressionStr)
+		assert.NilError(t, err, "Failed to parse '%v'", expressionStr)
+		assert.Equal(t, expression.matches(tags), expected, "Unexpected result for '%v'", expressionStr)
+	}
+
+	for _, invalidExpressionStr := range []string{"", "smoke &&", "(smoke", "smoke slow", "smoke & slow", "&& smoke"} {
+		_, err := parseTagExpression(invalidExpressionStr)
+		assert.Assert(t, err != nil, "Expected an error parsing '%v'", invalidExpressionStr)
+	}
+}
+
+func TestSelectTests(t *testing.T) {
+	allTests := getTestsForSelection()
+
+	selected, err := selectTests(allTests, map[string]bool{}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(selected), 4)
+
+	selected, err = selectTests(allTests, map[string]bool{}, "smoke && !slow")
+	assert.NilError(t, err)
+	assert.Equal(t, len(selected), 1)
+	_, found := selected["smokeTest"]
+	assert.Assert(t, found)
+
+	selected, err = selectTests(allTests, map[string]bool{"*Smoke*": true, "/^chaos/": true}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(selected), 2)
+
+	selected, err = selectTests(allTests, map[string]bool{"consensus[nodes=7]": true}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(selected), 1)
+
+	_, err = selectTests(allTests, map[string]bool{"nonexistentTest": true}, "")
+	assert.Assert(t, err != nil, "Expected an error selecting a nonexistent test")
+}
+
+func TestGetSortedSetTestTags(t *testing.T) {
+	test := taggedTestForSelection{tags: map[string]bool{"smoke": true, "slow": false, "nightly": true}}
+	assert.DeepEqual(t, getSortedSetTestTags(test), []string{"nightly", "smoke"})
+	assert.DeepEqual(t, getSortedSetTestTags(taggedTestForSelection{}), []string{})
+}
@@ -0,0 +1,145 @@
+package initializer
+
+import (
+	"github.com/kurtosis-tech/kurtosis/commons/testsuite"
+	"github.com/kurtosis-tech/kurtosis/initializer/parallelism"
+	"github.com/palantir/stacktrace"
+	"sort"
+	"time"
+)
+
+/*
+Identifies one shard of a test suite that's split across several machines (e.g. CI jobs), each running its own
+	TestSuiteRunner. Every shard must be given the same test selection, and each selected test is run by exactly one
+	shard; the JSON reports of all the shards can then be combined with parallelism.MergeShardJsonReports.
+
+The zero value means the test suite isn't sharded.
+ */
+type TestShard struct {
+	// The index of this shard, in [0, Count)
+	Index uint
+
+	// How many shards the test suite is split into (0 or 1 if the test suite isn't sharded)
+	Count uint
+
+	// If true, tests are assigned to shards so that each shard's expected total duration, from the test duration
+	//  history, is about the same. This requires every shard to be given an identical copy of the history file, or
+	//  shards could disagree about which tests are theirs! If false, tests are assigned round-robin by name.
+	BalanceByDuration bool
+}
+
+func (shard TestShard) isSharded() bool {
+	return shard.Count > 1
+}
+
+/*
+Deterministically picks the subset of the selected tests that the given shard will run, such that across all the shards
+	every selected test is picked exactly once.
+
+Args:
+	testsToRun: The tests selected to run, which must be the same on every shard
+	shard: The shard to pick tests for
+	testDurationHistory: How long tests took in previous runs, used if the shard balances tests by duration (nil if
+		there's no history)
+ */
+func getShardTests(
+			testsToRun map[string]testsuite.Test,
+			shard TestShard,
+			testDurationHistory *parallelism.TestDurationHistory) (map[string]testsuite.Test, error) {
+	if !shard.isSharded() {
+		return testsToRun, nil
+	}
+	if shard.Index >= shard.Count {
+		return nil, stacktrace.NewError("Shard index %v is out of range for a test suite split into %v shards", shard.Index, shard.Count)
+	}
+	if shard.BalanceByDuration && testDurationHistory == nil {
+		return nil, stacktrace.NewError("Balancing shards by test duration requires a test duration history file")
+	}
+
+	testNames := make([]string, 0, len(testsToRun))
+	for testName, _ := range testsToRun {
+		testNames = append(testNames, testName)
+	}
+	sort.Strings(testNames)
+
+	var testShardIndices map[string]uint
+	if shard.BalanceByDuration {
+		testShardIndices = getDurationBalancedShardIndices(testNames, shard.Count, testDurationHistory)
+	} else {
+		testShardIndices = map[string]uint{}
+		for i, testName := range testNames {
+			testShardIndices[testName] = uint(i) % shard.Count
+		}
+	}
+
+	result := map[string]testsuite.Test{}
+	for testName, shardIndex := range testShardIndices {
+		if shardIndex == shard.Index {
+			result[testName] = testsToRun[testName]
+		}
+	}
+	return result, nil
+}
+
+/*
+Assigns each test to a shard by handing out the longest tests first, each to the shard with the least expected duration
+	so far. Tests with no recorded duration are assumed to take the mean of the recorded durations.
+
+Args:
+	testNames: The names of the tests to assign, sorted
+	shardCount: The number of shards to assign the tests to
+	testDurationHistory: How long tests took in previous runs
+
+Returns:
+	Mapping of test name -> index of the shard the test is assigned to
+ */
+func getDurationBalancedShardIndices(
+			testNames []string,
+			shardCount uint,
+			testDurationHistory *parallelism.TestDurationHistory) map[string]uint {
+	var totalKnownDuration time.Duration
+	numKnownDurations := 0
+	for _, testName := range testNames {
+		if duration, found := testDurationHistory.Durations[testName]; found {
+			totalKnownDuration += duration
+			numKnownDurations++
+		}
+	}
+	var assumedDuration time.Duration
+	if numKnownDurations > 0 {
+		assumedDuration = totalKnownDuration / time.Duration(numKnownDurations)
+	}
+
+	expectedDurations := map[string]time.Duration{}
+	for _, testName := range testNames {
+		duration, found := testDurationHistory.Durations[testName]
+		if !found {
+			duration = assumedDuration
+		}
+		expectedDurations[testName] = duration
+	}
+
+	// Copied so that we don't reorder the caller's slice; the stable sort keeps equal-duration tests in name order
+	orderedTestNames := append([]string{}, testNames...)
+	sort.SliceStable(orderedTestNames, func(i, j int) bool {
+		return expectedDurations[orderedTestNames[i]] > expectedDurations[orderedTestNames[j]]
+	})
+
+	shardDurations := make([]time.Duration, shardCount)
+	shardNumTests := make([]int, shardCount)
+	result := map[string]uint{}
+	for _, testName := range orderedTestNames {
+		// Ties go to the shard with the fewest tests, then the lowest index, so every shard computes the same assignment
+		leastLoadedShard := uint(0)
+		for shardIndex := uint(1); shardIndex < shardCount; shardIndex++ {
+			if shardDurations[shardIndex] < shardDurations[leastLoadedShard] ||
+					(shardDurations[shardIndex] == shardDurations[leastLoadedShard] && shardNumTests[shardIndex] < shardNumTests[leastLoadedShard]) {
+				leastLoadedShard = shardIndex
+			}
+		}
+		result[testName] = leastLoadedShard
+		shardDurations[leastLoadedShard] += expectedDurations[testName]
+		shardNumTests[leastLoadedShard]++
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package initializer
+
+import (
+	"github.com/kurtosis-tech/kurtosis/initializer/parallelism"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+func TestShardsCoverEachTestExactlyOnce(t *testing.T) {
+	testsToRun := getTestsForSelection()
+	history := &parallelism.TestDurationHistory{
+		Durations: map[string]time.Duration{
+			"smokeTest": time.Second,
+			"slowSmokeTest": time.Minute,
+		},
+	}
+	for _, balanceByDuration := range []bool{false, true} {
+		timesRun := map[string]int{}
+		for shardIndex := uint(0); shardIndex < 3; shardIndex++ {
+			shard := TestShard{Index: shardIndex, Count: 3, BalanceByDuration: balanceByDuration}
+			shardTests, err := getShardTests(testsToRun, shard, history)
+			assert.NilError(t, err)
+			for testName, _ := range shardTests {
+				timesRun[testName]++
+			}
+		}
+		assert.Equal(t, len(timesRun), len(testsToRun))
+		for testName, numTimesRun := range timesRun {
+			assert.Equal(t, numTimesRun, 1, "Test %v was run by %v shards", testName, numTimesRun)
+		}
+	}
+}
+
+func TestDurationBalancedShards(t *testing.T) {
+	history := &parallelism.TestDurationHistory{
+		Durations: map[string]time.Duration{
+			"a": 10 * time.Second,
+			"b": 6 * time.Second,
+			"c": 5 * time.Second,
+		},
+	}
+	// "d" has no recorded duration, so is assumed to take the mean (7s)
+	shardIndices := getDurationBalancedShardIndices([]string{"a", "b", "c", "d"}, 2, history)
+	assert.DeepEqual(t, shardIndices, map[string]uint{"a": 0, "d": 1, "b": 1, "c": 0})
+}
+
+func TestInvalidShards(t *testing.T) {
+	testsToRun := getTestsForSelection()
+	_, err := getShardTests(testsToRun, TestShard{Index: 3, Count: 3}, nil)
+	assert.ErrorContains(t, err, "out of range")
+	_, err = getShardTests(testsToRun, TestShard{Index: 0, Count: 3, BalanceByDuration: true}, nil)
+	assert.ErrorContains(t, err, "history")
+
+	// The zero value doesn't shard
+	shardTests, err := getShardTests(testsToRun, TestShard{}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(shardTests), len(testsToRun))
+}
@@ -1,7 +1,7 @@
 package initializer
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/docker/client"
@@ -9,8 +9,9 @@ import (
 	"github.com/kurtosis-tech/kurtosis/initializer/parallelism"
 	"github.com/palantir/stacktrace"
 	"github.com/sirupsen/logrus"
-	"math"
-	"net"
+	"sort"
+	"strings"
+	"time"
 )
 
 // =============================== Test Suite Runner =========================================
@@ -19,7 +20,9 @@ const (
 	//  increasing IPs corresponding to the NETWORK_WIDTH_BITS
 	SUBNET_START_ADDR = "172.23.0.0"
 
-	BITS_IN_IP4_ADDR = 32
+	// The IP address just past the end of the range that Docker subnets are doled out from, which is the end of the
+	//  172.16.0.0/12 private range so that test networks never use public IPs
+	SUBNET_END_ADDR = "172.32.0.0"
 )
 
 /*
@@ -40,9 +43,82 @@ type TestSuiteRunner struct {
 	//	run with
 	testControllerLogLevel	string
 
+	// The least severe level of structured test log entry (logged via the TestContext) that will be shown for tests that
+	//  pass; all entries are shown for tests that don't pass
+	passingTestLogLevel logrus.Level
+
 	// The number of bits in a test network's subnet mask, such that 2 ^ this_value will be the maximum number of allowed
 	//  services in any given test network
 	networkWidthBits uint32
+
+	// If non-nil, tests are only run in parallel while the resources they declare fit within this capacity, with any
+	//  zero CPU or memory field detected from the Docker daemon
+	hostCapacity *parallelism.HostCapacity
+
+	// The maximum number of times a test that errors with a transient error (e.g. a flaky Docker daemon) will be retried
+	maxErroredTestRetries uint
+
+	// Filepath to a JSON file of expected test metric values, which metrics recorded by tests will be compared against
+	//  (empty if no comparison should be done)
+	metricsBaselineFilepath string
+
+	// Filepath to a file listing quarantined tests, whose failures won't fail the run (empty if there's no such file)
+	quarantineFilepath string
+
+	// Filepath to a JSON file where how long each test took is persisted between runs, to schedule the longest tests
+	//  first (empty if durations shouldn't be persisted)
+	testDurationHistoryFilepath string
+
+	// Filepath to write a JSON report of the test results to (empty if no JSON report should be written)
+	jsonReportFilepath string
+
+	// Filepath to write a JUnit XML report of the test results to (empty if no JUnit report should be written)
+	junitReportFilepath string
+}
+
+/*
+Options controlling how a TestSuiteRunner schedules, retries, and reports on tests, where the zero value of each field
+	other than NetworkWidthBits disables the corresponding feature
+ */
+type TestSuiteRunnerOptions struct {
+	// The least severe level of structured test log entry (logged via the TestContext) that will be shown for tests that
+	//  pass, e.g. Warn to only show warnings and errors for passing tests (use Trace to show everything); all entries are
+	//  shown for tests that don't pass
+	PassingTestLogLevel logrus.Level
+
+	// Each test will get a Docker network with a number of available IP addresses = 2^NetworkWidthBits, so this should
+	//  be set high enough that each test can fit all the services it wants (must be at least 1)
+	NetworkWidthBits uint32
+
+	// If non-nil, enables resource-aware scheduling, where a test (up to the test parallelism) is only started once the
+	//  CPU, memory, and containers it declares via testsuite.ResourceDeclaringTest fit within this capacity alongside the
+	//  tests already running. CPU and memory left at zero are detected from the Docker daemon; a zero container count
+	//  means containers are unlimited. Leave nil to run tests purely by the test parallelism.
+	HostCapacity *parallelism.HostCapacity
+
+	// The maximum number of times a test that ERRORED due to a transient error (e.g. the Docker daemon being briefly
+	//  unavailable) will be retried on a fresh subnet; 0 disables retries. Tests that FAILED aren't retried.
+	MaxErroredTestRetries uint
+
+	// Filepath to a JSON file of expected test metric values (see MetricsBaseline for the format); if a metric recorded
+	//  by a test regresses beyond the allowed threshold, the run fails. Leave empty to skip the comparison.
+	MetricsBaselineFilepath string
+
+	// Filepath to a file listing quarantined tests, one test name pattern per line with an optional '#'-prefixed reason
+	//  (see loadQuarantineFile for the format). Quarantined tests are run and reported as usual, but their failures don't
+	//  fail the run. Tests can also quarantine themselves via QuarantinedTest. Leave empty if there's no quarantine file.
+	QuarantineFilepath string
+
+	// Filepath to a JSON file where how long each test took is persisted between runs (see TestDurationHistory for the
+	//  format), which is used to schedule the longest tests first and to estimate the total duration. The file is
+	//  created if it doesn't exist. Leave empty to not persist durations.
+	TestDurationHistoryFilepath string
+
+	// Filepath to write a JSON report of the test results to (leave empty to skip)
+	JsonReportFilepath string
+
+	// Filepath to write a JUnit XML report of the test results to (leave empty to skip)
+	JunitReportFilepath string
 }
 
 /*
@@ -53,61 +129,172 @@ Args:
 	testControllerImageName: The name of the Docker image of the test controller that will orchestrate test execution
 	testControllerLogLevel: The string representing the loglevel of the controller (the test suite runner won't be able
 		to parse this, so this should be meaningful to the controller image)
-	networkWidthBits: Each test will get a Docker network with a number of available IP addresses = 2^network_width_bits.
-		This parameter should be set high enough so that each test can fit all the services they want.
+	testControllerEnvVars: Custom key-value mapping that will be passed as-is to the controller container as Docker
+		environment variables
+	options: How to schedule, retry, and report on the tests, e.g. the size of each test's network and where to write
+		the reports
  */
 func NewTestSuiteRunner(
 			testSuite testsuite.TestSuite,
 			testControllerImageName string,
 			testControllerLogLevel string,
 			testControllerEnvVars map[string]string,
-			networkWidthBits uint32) *TestSuiteRunner {
+			options TestSuiteRunnerOptions) *TestSuiteRunner {
 	return &TestSuiteRunner{
 		testSuite:                   testSuite,
 		testControllerImageName:     testControllerImageName,
 		testControllerLogLevel:      testControllerLogLevel,
 		customTestControllerEnvVars: testControllerEnvVars,
-		networkWidthBits:            networkWidthBits,
+		passingTestLogLevel:         options.PassingTestLogLevel,
+		networkWidthBits:            options.NetworkWidthBits,
+		hostCapacity:                options.HostCapacity,
+		maxErroredTestRetries:       options.MaxErroredTestRetries,
+		metricsBaselineFilepath:     options.MetricsBaselineFilepath,
+		quarantineFilepath:          options.QuarantineFilepath,
+		testDurationHistoryFilepath: options.TestDurationHistoryFilepath,
+		jsonReportFilepath:          options.JsonReportFilepath,
+		junitReportFilepath:         options.JunitReportFilepath,
 	}
 }
 
 /*
-Runs the tests with the given names and prints the results to STDOUT. If no tests are specifically defined, all tests are run.
+Options controlling how RunTests runs the selected tests, where the zero value of each field other than Parallelism runs
+	each selected test once with no time limit
+ */
+type RunTestsOptions struct {
+	// How many tests to run in parallel (must be at least 1)
+	Parallelism uint
+
+	// How many times to run each test, to detect flaky tests (0 or 1 to run each test once). Each iteration runs on its
+	//  own subnet, the iterations share the test parallelism, and the summary shows each test's pass rate.
+	Iterations uint
+
+	// If true, each test is run over and over until one of its iterations doesn't pass, with no upper bound on the
+	//  number of iterations, to hunt down rare flakes (can't be combined with Iterations). The run only ends once every
+	//  test has stopped passing, or it's halted by FailFast, ExecutionTimeout, or an interrupt signal, so it's best
+	//  combined with an ExecutionTimeout.
+	RunUntilFailure bool
+
+	// If true, a test's remaining iterations aren't run once one of its iterations doesn't pass
+	StopIteratingOnFailure bool
+
+	// If true, the first non-quarantined test that FAILS or ERRORS stops any more tests from being started and cancels
+	//  the tests in flight; tests that weren't started are reported as NOT-RUN
+	FailFast bool
+
+	// How long the whole RunTests call is allowed to take (0 for no limit). A minute and a half before it's reached, which
+	//  leaves time for cancelled tests to exit and be torn down and for the reports, no more tests are started and the
+	//  tests in flight are cancelled gracefully, as with fail-fast, but the summary is still printed and the reports are
+	//  still written. Tests whose execution timeout plus setup buffer wouldn't fit in the time left aren't started, and
+	//  are reported as NOT-RUN.
+	ExecutionTimeout time.Duration
+
+	// Which shard of the selected tests to run, when the test suite is split across several machines (the zero value to
+	//  run all the selected tests). The shard is recorded in the JSON report, so that the reports of all the shards can
+	//  be merged with parallelism.MergeShardJsonReports.
+	Shard TestShard
+}
+
+/*
+Runs the tests selected by the given name patterns and tag expression, and prints the results to STDOUT. If no name
+	patterns or tag expression are given, all tests are run.
 
 Args:
-	testNamesToRun: A "set" of test names to run
-	testParallelism: How many tests to run in parallel
+	testNamesToRun: A "set" of patterns selecting the tests to run, where each pattern is an exact test name, a glob
+		(e.g. "consensus*"), or a regex wrapped in slashes (e.g. "/^consensus-(4|7)$/"). If empty, all tests are selected.
+	tagSelectionExpression: A boolean expression over the tags that tests declare via TaggedTest, which selected tests
+		must satisfy (e.g. "smoke && !slow", "(chaos || nightly) && !flaky"). If empty, tests aren't filtered by tag.
+	options: How to run the selected tests, e.g. how many to run in parallel and how many times to run each
+
+If the test suite implements HookedTestSuite, its BeforeAllTests hook is run before any tests are started and its
+	AfterAllTests hook is run after all tests have finished.
 
 Returns:
 	allTestsPassed: True if all tests passed, false otherwise
 	executionErr: An error that will be non-nil if an error occurred that prevented the test from running and/or the result
 		being retrieved. If this is non-nil, the allTestsPassed value is undefined!
  */
-func (runner TestSuiteRunner) RunTests(testNamesToRun map[string]bool, testParallelism uint) (allTestsPassed bool, executionErr error) {
-	allTests := runner.testSuite.GetTests()
-
-	// If the user doesn't specify any test names to run, run all of them
-	if len(testNamesToRun) == 0 {
-		testNamesToRun = map[string]bool{}
-		for testName, _ := range allTests {
-			testNamesToRun[testName] = true
+func (runner TestSuiteRunner) RunTests(
+			testNamesToRun map[string]bool,
+			tagSelectionExpression string,
+			options RunTestsOptions) (allTestsPassed bool, executionErr error) {
+	// The deadline covers everything this function does, including e.g. the test suite's hooks
+	var executionDeadline time.Time
+	if options.ExecutionTimeout > 0 {
+		executionDeadline = time.Now().Add(options.ExecutionTimeout)
+	}
+
+	if err := options.validate(); err != nil {
+		return false, stacktrace.Propagate(err, "Invalid options for running the tests")
+	}
+	if runner.networkWidthBits == 0 {
+		return false, stacktrace.NewError("Network width bits must be at least 1")
+	}
+
+	allTests, err := testsuite.GetAllTests(runner.testSuite)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "An error occurred getting the tests in the test suite")
+	}
+
+	testsToRun, err := selectTests(allTests, testNamesToRun, tagSelectionExpression)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "An error occurred selecting the tests to run")
+	}
+	if len(testsToRun) == 0 {
+		return false, stacktrace.NewError("No tests matched the given selection")
+	}
+
+	var testDurationHistory *parallelism.TestDurationHistory
+	if runner.testDurationHistoryFilepath != "" {
+		testDurationHistory, err = parallelism.LoadTestDurationHistory(runner.testDurationHistoryFilepath)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred loading the test duration history")
+		}
+	}
+
+	shard := options.Shard
+	if shard.isSharded() {
+		numSelectedTests := len(testsToRun)
+		testsToRun, err = getShardTests(testsToRun, shard, testDurationHistory)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred picking the tests for shard %v", shard.Index)
+		}
+		logrus.Infof("Running shard %v of %v: %v of %v selected tests", shard.Index, shard.Count, len(testsToRun), numSelectedTests)
+		if len(testsToRun) == 0 {
+			// There are more shards than tests; report an empty shard rather than failing, so the reports still merge
+			logrus.Warnf("Shard %v has no tests to run", shard.Index)
 		}
 	}
 
-	// Validate all the requested tests exist
-	testsToRun := make(map[string]testsuite.Test)
-	for testName, _ := range testNamesToRun {
-		test, found := allTests[testName]
-		if !found {
-			return false, stacktrace.NewError("No test registered with name '%v'", testName)
+	quarantineFileEntries := []quarantineFileEntry{}
+	if runner.quarantineFilepath != "" {
+		quarantineFileEntries, err = loadQuarantineFile(runner.quarantineFilepath)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred loading the quarantine file")
 		}
-		testsToRun[testName] = test
 	}
+	quarantinedTests, err := getQuarantinedTests(allTests, quarantineFileEntries)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "An error occurred determining the quarantined tests")
+	}
+	logSelectedTests(testsToRun, quarantinedTests)
 
 	executionInstanceId := uuid.Generate()
-	testParams, err := buildTestParams(executionInstanceId, testsToRun, runner.networkWidthBits)
+	subnetAllocator, err := parallelism.NewSubnetAllocator(SUBNET_START_ADDR, SUBNET_END_ADDR, runner.networkWidthBits)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "An error occurred creating the subnet allocator")
+	}
+	testParams, err := buildTestParams(executionInstanceId, testsToRun, subnetAllocator)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "An error occurred building the test params map")
+		return false, stacktrace.Propagate(err, "An error occurred building the test params")
+	}
+
+	var metricsBaseline *parallelism.MetricsBaseline
+	if runner.metricsBaselineFilepath != "" {
+		metricsBaseline, err = parallelism.LoadMetricsBaseline(runner.metricsBaselineFilepath)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred loading the metrics baseline")
+		}
 	}
 
 	// Initialize a Docker client
@@ -116,13 +303,65 @@ func (runner TestSuiteRunner) RunTests(testNamesToRun map[string]bool, testParal
 		return false, stacktrace.Propagate(err,"Failed to initialize Docker client from environment.")
 	}
 
+	var hostCapacity *parallelism.HostCapacity
+	if runner.hostCapacity != nil {
+		detectedHostCapacity, err := parallelism.DetectHostCapacity(context.Background(), dockerClient, *runner.hostCapacity)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred determining the host capacity")
+		}
+		hostCapacity = &detectedHostCapacity
+	}
+
 	testExecutor := parallelism.NewTestExecutorParallelizer(
 		executionInstanceId,
 		dockerClient,
-		runner.testControllerImageName,
-		runner.testControllerLogLevel,
-		runner.customTestControllerEnvVars,
-		testParallelism)
+		subnetAllocator,
+		parallelism.TestExecutorParallelizerConfig{
+			TestControllerImageName:     runner.testControllerImageName,
+			TestControllerLogLevel:      runner.testControllerLogLevel,
+			CustomTestControllerEnvVars: runner.customTestControllerEnvVars,
+			PassingTestLogLevel:         runner.passingTestLogLevel,
+			Parallelism:                 options.Parallelism,
+			HostCapacity:                hostCapacity,
+			MaxErroredTestRetries:       runner.maxErroredTestRetries,
+			TestIterations:              options.Iterations,
+			RunUntilFailure:             options.RunUntilFailure,
+			StopIteratingOnFailure:      options.StopIteratingOnFailure,
+			FailFast:                    options.FailFast,
+			ExecutionDeadline:           executionDeadline,
+			MetricsBaseline:             metricsBaseline,
+			QuarantinedTests:            quarantinedTests,
+			TestDurationHistory:         testDurationHistory,
+			TestDurationHistoryFilepath: runner.testDurationHistoryFilepath,
+			ShardIndex:                  shard.Index,
+			ShardCount:                  shard.Count,
+			JsonReportFilepath:          runner.jsonReportFilepath,
+			JunitReportFilepath:         runner.junitReportFilepath,
+		})
+
+	hookedTestSuite, hasSuiteHooks := runner.testSuite.(testsuite.HookedTestSuite)
+	if hasSuiteHooks {
+		defer func() {
+			logrus.Info("Running the test suite's AfterAllTests hook...")
+			if err := hookedTestSuite.AfterAllTests(); err != nil {
+				// If something else already went wrong, that error is the more useful one to return
+				if executionErr == nil {
+					allTestsPassed = false
+					executionErr = stacktrace.Propagate(err, "An error occurred running the test suite's AfterAllTests hook")
+				} else {
+					logrus.Errorf("An error occurred running the test suite's AfterAllTests hook: %v", err)
+				}
+				return
+			}
+			logrus.Info("Test suite's AfterAllTests hook completed")
+		}()
+
+		logrus.Info("Running the test suite's BeforeAllTests hook...")
+		if err := hookedTestSuite.BeforeAllTests(); err != nil {
+			return false, stacktrace.Propagate(err, "An error occurred running the test suite's BeforeAllTests hook")
+		}
+		logrus.Info("Test suite's BeforeAllTests hook completed")
+	}
 
 	logrus.Infof("Running %v tests with execution ID %v...", len(testsToRun), executionInstanceId.String())
 	allTestsPassed = testExecutor.RunInParallelAndPrintResults(testParams)
@@ -130,40 +369,64 @@ func (runner TestSuiteRunner) RunTests(testNamesToRun map[string]bool, testParal
 }
 
 /*
-Helper function to build, from the set of tests to run, the map of test params that we'll pass to the TestExecutorParallelizer
-
-Args:
-	testsToRun: A "set" of test names to run in parallel
+Checks that the options can be run with, returning an error describing the problem if not
  */
-func buildTestParams(executionInstanceId uuid.UUID, testsToRun map[string]testsuite.Test, networkWidthBits uint32) (map[string]parallelism.ParallelTestParams, error) {
-	subnetMaskBits := BITS_IN_IP4_ADDR - networkWidthBits
+func (options RunTestsOptions) validate() error {
+	if options.Parallelism == 0 {
+		return stacktrace.NewError("Test parallelism must be at least 1")
+	}
+	if options.RunUntilFailure && options.Iterations > 1 {
+		return stacktrace.NewError(
+			"Tests can't be run both until they fail and a fixed number of times (%v iterations)",
+			options.Iterations)
+	}
+	return nil
+}
 
-	subnetStartIp := net.ParseIP(SUBNET_START_ADDR)
-	if subnetStartIp == nil {
-		return nil, stacktrace.NewError("Subnet start IP %v was not a valid IP address; this is a code problem", SUBNET_START_ADDR)
+/*
+Helper function to print the tests that were selected to run, with their tags and whether they're quarantined, so the
+	user can verify the selection
+ */
+func logSelectedTests(testsToRun map[string]testsuite.Test, quarantinedTests map[string]string) {
+	testNames := make([]string, 0, len(testsToRun))
+	for testName, _ := range testsToRun {
+		testNames = append(testNames, testName)
 	}
+	sort.Strings(testNames)
 
-	// The IP can be either 4 bytes or 16 bytes long; we need to handle both
-	//  else we'll get a silent 0 value for the int!
-	// See https://gist.github.com/ammario/649d4c0da650162efd404af23e25b86b
-	var subnetStartIpInt uint32
-	if len(subnetStartIp) == 16 {
-		subnetStartIpInt = binary.BigEndian.Uint32(subnetStartIp[12:16])
-	} else {
-		subnetStartIpInt = binary.BigEndian.Uint32(subnetStartIp)
+	logrus.Infof("Selected %v tests to run:", len(testNames))
+	for _, testName := range testNames {
+		tags := getSortedSetTestTags(testsToRun[testName])
+		logStr := fmt.Sprintf("- %v", testName)
+		if len(tags) > 0 {
+			logStr = fmt.Sprintf("%v [%v]", logStr, strings.Join(tags, ", "))
+		}
+		if _, isQuarantined := quarantinedTests[testName]; isQuarantined {
+			logStr = fmt.Sprintf("%v (quarantined)", logStr)
+		}
+		logrus.Info(logStr)
 	}
+}
+
+/*
+Helper function to build, from the set of tests to run, the map of test params that we'll pass to the TestExecutorParallelizer
 
-	testIndex := 0
+Args:
+	executionInstanceId: The ID of the test suite execution that the tests belong to
+	testsToRun: A "set" of test names to run in parallel
+	subnetAllocator: The allocator that each test's initial subnet will be taken from
+ */
+func buildTestParams(
+			executionInstanceId uuid.UUID,
+			testsToRun map[string]testsuite.Test,
+			subnetAllocator *parallelism.SubnetAllocator) (map[string]parallelism.ParallelTestParams, error) {
 	testParams := make(map[string]parallelism.ParallelTestParams)
 	for testName, test := range testsToRun {
-		// Pick the next free available subnet IP, considering all the tests we've started previously
-		subnetIpInt := subnetStartIpInt + uint32(testIndex) * uint32(math.Pow(2, float64(networkWidthBits)))
-		subnetIp := make(net.IP, 4)
-		binary.BigEndian.PutUint32(subnetIp, subnetIpInt)
-		subnetCidrStr := fmt.Sprintf("%v/%v", subnetIp.String(), subnetMaskBits)
-
+		subnetCidrStr, err := subnetAllocator.GetNextSubnetMask()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "An error occurred getting a subnet for test %v", testName)
+		}
 		testParams[testName] = *parallelism.NewParallelTestParams(testName, test, subnetCidrStr, executionInstanceId)
-		testIndex++
 	}
 	return testParams, nil
 }
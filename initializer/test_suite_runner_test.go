@@ -0,0 +1,21 @@
+package initializer
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestRunTestsOptionsValidation(t *testing.T) {
+	assert.NilError(t, RunTestsOptions{Parallelism: 4}.validate())
+	assert.NilError(t, RunTestsOptions{Parallelism: 4, Iterations: 20, StopIteratingOnFailure: true}.validate())
+	assert.NilError(t, RunTestsOptions{Parallelism: 4, Iterations: 1, RunUntilFailure: true}.validate())
+
+	assert.ErrorContains(t, RunTestsOptions{}.validate(), "at least 1")
+	assert.ErrorContains(t, RunTestsOptions{Parallelism: 4, Iterations: 20, RunUntilFailure: true}.validate(), "20 iterations")
+}
+
+func TestRunTestsRejectsZeroNetworkWidthBits(t *testing.T) {
+	runner := NewTestSuiteRunner(nil, "", "", map[string]string{}, TestSuiteRunnerOptions{})
+	_, err := runner.RunTests(map[string]bool{}, "", RunTestsOptions{Parallelism: 4})
+	assert.ErrorContains(t, err, "Network width bits")
+}